@@ -0,0 +1,58 @@
+// Command export writes everything stored about one user to stdout as
+// NDJSON, for answering data-access requests. Besides the profile, chats
+// and messages, it covers blocks, notification settings, drafts, scheduled
+// messages, owned bots with their API key metadata and poll votes:
+//
+//	MONGO_URI=... DB_NAME=... export -user 5f6a... > user.ndjson
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/flaambe/avito/internal/repository"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	userID := flag.String("user", "", "ID of the user to export")
+	flag.Parse()
+
+	if *userID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGO_URI")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database(os.Getenv("DB_NAME"))
+
+	chatService := service.NewChatService(
+		repository.NewUserRepository(db),
+		repository.NewChatRepository(db),
+		repository.NewMessageRepository(db),
+	)
+
+	out := bufio.NewWriter(os.Stdout)
+	if err := chatService.ExportUser(view.UserRequest{UserID: *userID}, out); err != nil {
+		log.Fatal(err)
+	}
+	if err := out.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
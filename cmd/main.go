@@ -2,16 +2,24 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/flaambe/avito/internal/events"
 	"github.com/flaambe/avito/internal/handler"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/presence"
 	"github.com/flaambe/avito/internal/repository"
 	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/unfurl"
+	"github.com/flaambe/avito/internal/webhook"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -38,15 +46,133 @@ func main() {
 	userRepo := repository.NewUserRepository(db)
 	chatRepo := repository.NewChatRepository(db)
 	messageRepo := repository.NewMessageRepository(db)
-	chatService := service.NewChatService(userRepo, chatRepo, messageRepo)
+
+	if err := userRepo.EnsureIndexes(); err != nil {
+		log.Fatal(err)
+	}
+	if err := chatRepo.EnsureIndexes(); err != nil {
+		log.Fatal(err)
+	}
+	if err := messageRepo.EnsureIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	var presenceStore service.PresenceStore = presence.NewMemoryStore()
+	if os.Getenv("PRESENCE_STORE") == "mongo" {
+		presenceStore = repository.NewPresenceRepository(db)
+	}
+
+	erasurePolicy := model.ErasureAnonymize
+	if policy := os.Getenv("ERASURE_POLICY"); policy != "" {
+		if policy != model.ErasureAnonymize && policy != model.ErasureDelete {
+			log.Fatalf("ERASURE_POLICY must be %q or %q", model.ErasureAnonymize, model.ErasureDelete)
+		}
+		erasurePolicy = policy
+	}
+
+	retentionDays := 0
+	if days := os.Getenv("MESSAGE_RETENTION_DAYS"); days != "" {
+		retentionDays, err = strconv.Atoi(days)
+		if err != nil || retentionDays < 0 {
+			log.Fatal("MESSAGE_RETENTION_DAYS must be a non-negative number of days")
+		}
+	}
+
+	var globalHooks []model.Webhook
+	if hookURL := os.Getenv("WEBHOOK_URL"); hookURL != "" {
+		hook := model.Webhook{URL: hookURL, Secret: os.Getenv("WEBHOOK_SECRET")}
+		if events := os.Getenv("WEBHOOK_EVENTS"); events != "" {
+			hook.Events = strings.Split(events, ",")
+		}
+		globalHooks = append(globalHooks, hook)
+	}
+	webhooks := webhook.New(chatRepo, 6, time.Second)
+
+	chatService := service.NewChatService(userRepo, chatRepo, messageRepo,
+		service.WithPresence(presenceStore,
+			durationEnv("PRESENCE_AWAY_TIMEOUT", time.Minute),
+			durationEnv("PRESENCE_OFFLINE_TIMEOUT", 5*time.Minute)),
+		service.WithEvents(events.NewHub(time.Minute)),
+		service.WithErasurePolicy(erasurePolicy),
+		service.WithRetention(retentionDays),
+		service.WithLinkPreviews(unfurl.New(durationEnv("LINK_PREVIEW_TIMEOUT", 5*time.Second), time.Hour), 8),
+		service.WithWebhooks(webhooks, globalHooks...),
+	)
 	chatHandler := handler.NewChatHandler(chatService)
 
+	if err := chatService.ResumeChatDeletions(); err != nil {
+		log.Println(err)
+	}
+	if err := chatService.ResumeErasures(); err != nil {
+		log.Println(err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	chatService.StartRetentionSweeper(durationEnv("RETENTION_SWEEP_INTERVAL", time.Hour), done)
+	chatService.StartScheduler(durationEnv("SCHEDULER_INTERVAL", time.Second), done)
+	webhooks.Start(4, done)
+
 	serveMux := http.NewServeMux()
 	serveMux.HandleFunc("/users/add", chatHandler.AddUser)
+	serveMux.HandleFunc("/users/get", chatHandler.GetUser)
+	serveMux.HandleFunc("/users/update", chatHandler.UpdateUser)
+	serveMux.HandleFunc("/users/delete", chatHandler.DeleteUser)
+	serveMux.HandleFunc("/users/lookup", chatHandler.LookupUsers)
+	serveMux.HandleFunc("/users/search", chatHandler.SearchUsers)
+	serveMux.HandleFunc("/users/ping", chatHandler.Ping)
+	serveMux.HandleFunc("/users/block", chatHandler.BlockUser)
+	serveMux.HandleFunc("/users/unblock", chatHandler.UnblockUser)
+	serveMux.HandleFunc("/users/blocked", chatHandler.GetBlockedUsers)
 	serveMux.HandleFunc("/chats/add", chatHandler.AddChat)
 	serveMux.HandleFunc("/chats/get", chatHandler.GetChats)
+	serveMux.HandleFunc("/chats/update", chatHandler.UpdateChat)
+	serveMux.HandleFunc("/chats/archive", chatHandler.ArchiveChat)
+	serveMux.HandleFunc("/chats/delete", chatHandler.DeleteChat)
+	serveMux.HandleFunc("/chats/notifications/get", chatHandler.GetNotificationSettings)
+	serveMux.HandleFunc("/chats/notifications/update", chatHandler.UpdateNotificationSettings)
+	serveMux.HandleFunc("/chats/discover", chatHandler.DiscoverChats)
+	serveMux.HandleFunc("/chats/join", chatHandler.JoinChat)
+	serveMux.HandleFunc("/chats/leave", chatHandler.LeaveChat)
+	serveMux.HandleFunc("/chats/bots/add", chatHandler.AddBotToChat)
+	serveMux.HandleFunc("/chats/typing", chatHandler.Typing)
+	serveMux.HandleFunc("/chats/commands", chatHandler.GetCommands)
+	serveMux.HandleFunc("/invites/add", chatHandler.AddInvite)
+	serveMux.HandleFunc("/invites/get", chatHandler.GetInvites)
+	serveMux.HandleFunc("/invites/revoke", chatHandler.RevokeInvite)
+	serveMux.HandleFunc("/invites/redeem", chatHandler.RedeemInvite)
+	serveMux.HandleFunc("/events/poll", chatHandler.PollEvents)
 	serveMux.HandleFunc("/messages/add", chatHandler.AddMessage)
 	serveMux.HandleFunc("/messages/get", chatHandler.GetMessages)
+	serveMux.HandleFunc("/messages/forward", chatHandler.ForwardMessages)
+	serveMux.HandleFunc("/messages/vote", chatHandler.Vote)
+	serveMux.HandleFunc("/messages/unvote", chatHandler.Unvote)
+	serveMux.HandleFunc("/messages/schedule", chatHandler.ScheduleMessage)
+	serveMux.HandleFunc("/messages/scheduled/get", chatHandler.GetScheduledMessages)
+	serveMux.HandleFunc("/messages/scheduled/update", chatHandler.UpdateScheduledMessage)
+	serveMux.HandleFunc("/messages/scheduled/cancel", chatHandler.CancelScheduledMessage)
+	serveMux.HandleFunc("/drafts/save", chatHandler.SaveDraft)
+	serveMux.HandleFunc("/drafts/get", chatHandler.GetDraft)
+	serveMux.HandleFunc("/drafts/clear", chatHandler.ClearDraft)
+	serveMux.HandleFunc("/webhooks/add", chatHandler.AddWebhook)
+	serveMux.HandleFunc("/webhooks/get", chatHandler.GetWebhooks)
+	serveMux.HandleFunc("/webhooks/delete", chatHandler.DeleteWebhook)
+	serveMux.HandleFunc("/webhooks/failures", chatHandler.GetWebhookFailures)
+	serveMux.HandleFunc("/webhooks/incoming/add", chatHandler.AddIncomingWebhook)
+	serveMux.HandleFunc("/webhooks/incoming/get", chatHandler.GetIncomingWebhooks)
+	serveMux.HandleFunc("/webhooks/incoming/delete", chatHandler.DeleteIncomingWebhook)
+	serveMux.HandleFunc("/bots/add", chatHandler.AddBot)
+	serveMux.HandleFunc("/bots/keys/add", chatHandler.AddBotKey)
+	serveMux.HandleFunc("/bots/keys/get", chatHandler.GetBotKeys)
+	serveMux.HandleFunc("/bots/keys/revoke", chatHandler.RevokeBotKey)
+	serveMux.HandleFunc("/bot/chats", chatHandler.BotChats)
+	serveMux.HandleFunc("/bot/messages/get", chatHandler.BotMessages)
+	serveMux.HandleFunc("/bot/messages/add", chatHandler.BotSendMessage)
+	serveMux.HandleFunc("/bot/events/poll", chatHandler.BotPollEvents)
+	serveMux.HandleFunc("/bot/webhook", chatHandler.SetBotWebhook)
+	serveMux.HandleFunc("/bot/commands/set", chatHandler.SetBotCommands)
+	serveMux.HandleFunc("/bot/commands/respond", chatHandler.BotRespondCommand)
+	serveMux.HandleFunc("/hooks/", chatHandler.PostIncomingWebhook)
 
 	srv := &http.Server{
 		Addr:         ":" + os.Getenv("PORT"),
@@ -60,6 +186,26 @@ func main() {
 		panic(srv.ListenAndServe())
 	}()
 
+	// Metrics are kept off the public port, on an address of their own.
+	var metricsSrv *http.Server
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/debug/vars", expvar.Handler())
+
+		metricsSrv = &http.Server{
+			Addr:         addr,
+			WriteTimeout: time.Second * 15,
+			ReadTimeout:  time.Second * 15,
+			Handler:      metricsMux,
+		}
+
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
 	// Create channel for shutdown signals.
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
@@ -83,4 +229,25 @@ func main() {
 	} else {
 		log.Println("Server gracefully stopped")
 	}
+
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down metrics server %s", err)
+		}
+	}
+}
+
+// durationEnv reads a duration such as "90s" from the environment.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s is invalid: %s", name, err)
+	}
+
+	return duration
 }
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/model"
+)
+
+const mailboxSize = 100
+
+// Hub delivers events to users polling this server instance. Each device of a
+// user has its own mailbox, so every device gets every event. Events are only
+// queued for devices that polled within the retention period, and expired
+// events are dropped.
+type Hub struct {
+	retain time.Duration
+
+	mu        sync.Mutex
+	mailboxes map[primitive.ObjectID]map[string]*mailbox
+	lastSweep time.Time
+}
+
+type mailbox struct {
+	events   []model.Event
+	wake     chan struct{}
+	lastPoll time.Time
+	polling  int
+}
+
+func NewHub(retain time.Duration) *Hub {
+	return &Hub{
+		retain:    retain,
+		mailboxes: make(map[primitive.ObjectID]map[string]*mailbox),
+		lastSweep: time.Now(),
+	}
+}
+
+func (h *Hub) Publish(users []primitive.ObjectID, event model.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.sweep(now)
+
+	for _, user := range users {
+		for _, box := range h.mailboxes[user] {
+			if len(box.events) == mailboxSize {
+				box.events = box.events[1:]
+			}
+			box.events = append(box.events, event)
+
+			close(box.wake)
+			box.wake = make(chan struct{})
+		}
+	}
+}
+
+// Poll waits until events are queued for the device of the user, the timeout
+// passes or ctx is done, and returns the unexpired events. Polls without a
+// device share one mailbox.
+func (h *Hub) Poll(ctx context.Context, user primitive.ObjectID, device string, timeout time.Duration) []model.Event {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	h.mu.Lock()
+	devices, ok := h.mailboxes[user]
+	if !ok {
+		devices = make(map[string]*mailbox)
+		h.mailboxes[user] = devices
+	}
+	box, ok := devices[device]
+	if !ok {
+		box = &mailbox{wake: make(chan struct{})}
+		devices[device] = box
+	}
+	box.polling++
+	defer func() {
+		h.mu.Lock()
+		box.polling--
+		box.lastPoll = time.Now()
+		h.mu.Unlock()
+	}()
+
+	for {
+		events := box.take(time.Now())
+		if len(events) > 0 {
+			h.mu.Unlock()
+			return events
+		}
+
+		wake := box.wake
+		h.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+
+		h.mu.Lock()
+	}
+}
+
+func (b *mailbox) take(now time.Time) []model.Event {
+	var events []model.Event
+	for _, event := range b.events {
+		if event.ExpiresAt.IsZero() || now.Before(event.ExpiresAt) {
+			events = append(events, event)
+		}
+	}
+	b.events = nil
+
+	return events
+}
+
+// sweep forgets devices that stopped polling. The caller must hold h.mu.
+func (h *Hub) sweep(now time.Time) {
+	if now.Sub(h.lastSweep) < h.retain {
+		return
+	}
+	h.lastSweep = now
+
+	for user, devices := range h.mailboxes {
+		for device, box := range devices {
+			if box.polling == 0 && now.Sub(box.lastPoll) > h.retain {
+				delete(devices, device)
+			}
+		}
+
+		if len(devices) == 0 {
+			delete(h.mailboxes, user)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package events_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/events"
+	"github.com/flaambe/avito/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub(t *testing.T) {
+	assert := assert.New(t)
+	testObj := events.NewHub(time.Minute)
+
+	user := primitive.NewObjectID()
+	event := model.Event{Type: model.EventTyping, User: primitive.NewObjectID(), ExpiresAt: time.Now().Add(time.Minute)}
+
+	// Users that never polled do not get events queued.
+	testObj.Publish([]primitive.ObjectID{user}, event)
+	assert.Empty(testObj.Poll(context.Background(), user, "", 10*time.Millisecond))
+
+	// The first poll registered the mailbox, so events are queued now.
+	testObj.Publish([]primitive.ObjectID{user}, event)
+	assert.Equal([]model.Event{event}, testObj.Poll(context.Background(), user, "", time.Second))
+
+	done := make(chan []model.Event)
+	go func() {
+		done <- testObj.Poll(context.Background(), user, "", time.Second)
+	}()
+	testObj.Publish([]primitive.ObjectID{user}, event)
+	assert.Equal([]model.Event{event}, <-done)
+
+	expired := event
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	testObj.Publish([]primitive.ObjectID{user}, expired)
+	assert.Empty(testObj.Poll(context.Background(), user, "", 10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Empty(testObj.Poll(ctx, user, "", time.Second))
+}
+
+func TestHubDevices(t *testing.T) {
+	assert := assert.New(t)
+	testObj := events.NewHub(time.Minute)
+
+	user := primitive.NewObjectID()
+	event := model.Event{Type: model.EventTyping, User: primitive.NewObjectID(), ExpiresAt: time.Now().Add(time.Minute)}
+
+	// The devices registered their mailboxes and poll at the same time.
+	assert.Empty(testObj.Poll(context.Background(), user, "phone", time.Millisecond))
+	assert.Empty(testObj.Poll(context.Background(), user, "laptop", time.Millisecond))
+	phone := make(chan []model.Event)
+	laptop := make(chan []model.Event)
+	go func() {
+		phone <- testObj.Poll(context.Background(), user, "phone", time.Second)
+	}()
+	go func() {
+		laptop <- testObj.Poll(context.Background(), user, "laptop", time.Second)
+	}()
+	testObj.Publish([]primitive.ObjectID{user}, event)
+	assert.Equal([]model.Event{event}, <-phone)
+	assert.Equal([]model.Event{event}, <-laptop)
+
+	// Events wait in the mailbox of each device until it polls again.
+	testObj.Publish([]primitive.ObjectID{user}, event)
+	assert.Equal([]model.Event{event}, testObj.Poll(context.Background(), user, "phone", time.Second))
+	assert.Equal([]model.Event{event}, testObj.Poll(context.Background(), user, "laptop", time.Second))
+	assert.Empty(testObj.Poll(context.Background(), user, "phone", 10*time.Millisecond))
+}
@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/flaambe/avito/internal/errs"
 	"github.com/flaambe/avito/internal/view"
@@ -14,8 +16,62 @@ type ChatService interface {
 	AddUser(user view.NewUserRequest) (view.NewUserResponse, error)
 	AddChat(chat view.NewChatRequest) (view.NewChatResponse, error)
 	AddMessage(message view.NewMessageRequest) (view.NewMessageResponse, error)
+	UpdateChat(update view.UpdateChatRequest) (view.Chat, error)
+	ArchiveChat(archive view.ArchiveChatRequest) (view.ArchiveChatResponse, error)
+	DeleteChat(request view.DeleteChatRequest) (view.DeleteChatResponse, error)
+	GetNotificationSettings(request view.NotificationSettingsRequest) (view.NotificationSettings, error)
+	UpdateNotificationSettings(request view.UpdateNotificationSettingsRequest) (view.NotificationSettings, error)
 	GetChats(chats view.ChatsRequest) (view.ChatsResponse, error)
 	GetMessages(messages view.MessagesRequest) (view.MessagesResponse, error)
+	DiscoverChats(request view.DiscoverChatsRequest) (view.DiscoverChatsResponse, error)
+	JoinChat(request view.JoinChatRequest) (view.Chat, error)
+	AddInvite(request view.NewInviteRequest) (view.Invite, error)
+	GetInvites(request view.InvitesRequest) (view.InvitesResponse, error)
+	RevokeInvite(request view.RevokeInviteRequest) (view.Invite, error)
+	RedeemInvite(request view.RedeemInviteRequest) (view.Chat, error)
+	GetUser(request view.UserRequest) (view.UserProfile, error)
+	UpdateUser(update view.UpdateUserRequest) (view.UserProfile, error)
+	LookupUsers(request view.LookupUsersRequest) (view.UsersResponse, error)
+	SearchUsers(request view.SearchUsersRequest) (view.UsersResponse, error)
+	Ping(request view.UserRequest) (view.UserProfile, error)
+	Typing(request view.TypingRequest) (view.TypingResponse, error)
+	PollEvents(ctx context.Context, request view.PollEventsRequest) (view.EventsResponse, error)
+	BlockUser(request view.BlockUserRequest) (view.BlockUserResponse, error)
+	UnblockUser(request view.BlockUserRequest) (view.BlockUserResponse, error)
+	GetBlockedUsers(request view.UserRequest) (view.UsersResponse, error)
+	DeleteUser(request view.UserRequest) (view.DeleteUserResponse, error)
+	ScheduleMessage(request view.ScheduleMessageRequest) (view.ScheduledMessage, error)
+	GetScheduledMessages(request view.UserRequest) (view.ScheduledMessagesResponse, error)
+	UpdateScheduledMessage(update view.UpdateScheduledMessageRequest) (view.ScheduledMessage, error)
+	CancelScheduledMessage(request view.ScheduledMessageRequest) (view.ScheduledMessage, error)
+	SaveDraft(request view.SaveDraftRequest) (view.Draft, error)
+	GetDraft(request view.DraftRequest) (view.Draft, error)
+	ClearDraft(request view.DraftRequest) (view.Draft, error)
+	ForwardMessages(request view.ForwardMessagesRequest) (view.ForwardMessagesResponse, error)
+	Vote(request view.VoteRequest) (view.Message, error)
+	Unvote(request view.VoteRequest) (view.Message, error)
+	LeaveChat(request view.LeaveChatRequest) (view.LeaveChatResponse, error)
+	AddWebhook(request view.NewWebhookRequest) (view.Webhook, error)
+	GetWebhooks(request view.WebhooksRequest) (view.WebhooksResponse, error)
+	DeleteWebhook(request view.DeleteWebhookRequest) (view.DeleteWebhookResponse, error)
+	GetWebhookFailures(request view.WebhooksRequest) (view.WebhookFailuresResponse, error)
+	AddIncomingWebhook(request view.NewIncomingWebhookRequest) (view.IncomingWebhook, error)
+	GetIncomingWebhooks(request view.WebhooksRequest) (view.IncomingWebhooksResponse, error)
+	DeleteIncomingWebhook(request view.DeleteWebhookRequest) (view.DeleteWebhookResponse, error)
+	PostIncomingWebhook(token string, message view.IncomingWebhookMessage) (view.NewMessageResponse, error)
+	AddBot(request view.NewBotRequest) (view.NewBotResponse, error)
+	AddBotKey(request view.BotRequest) (view.BotKey, error)
+	GetBotKeys(request view.BotRequest) (view.BotKeysResponse, error)
+	RevokeBotKey(request view.RevokeBotKeyRequest) (view.RevokeBotKeyResponse, error)
+	AddBotToChat(request view.AddBotToChatRequest) (view.Chat, error)
+	BotChats(key string) (view.ChatsResponse, error)
+	BotMessages(key string, request view.BotChatRequest) (view.MessagesResponse, error)
+	BotSendMessage(key string, request view.BotMessageRequest) (view.NewMessageResponse, error)
+	BotPollEvents(ctx context.Context, key string, request view.BotPollEventsRequest) (view.EventsResponse, error)
+	SetBotWebhook(key string, request view.BotWebhookRequest) (view.Webhook, error)
+	SetBotCommands(key string, request view.BotCommandsRequest) (view.CommandsResponse, error)
+	BotRespondCommand(key string, request view.BotCommandResponse) (view.NewMessageResponse, error)
+	GetCommands(request view.CommandsRequest) (view.CommandsResponse, error)
 }
 
 type ChatHandler struct {
@@ -100,7 +156,7 @@ func (c *ChatHandler) AddMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if body.Text == "" || body.ChatID == "" || body.UserID == "" {
+	if (body.Text == "" && body.Poll == nil) || body.ChatID == "" || body.UserID == "" {
 		respondWithError(w, http.StatusBadRequest, "chat, user or text not found")
 		return
 	}
@@ -126,6 +182,176 @@ func (c *ChatHandler) AddMessage(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusCreated, response)
 }
 
+func (c *ChatHandler) UpdateChat(w http.ResponseWriter, r *http.Request) {
+	var body view.UpdateChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.UpdateChat(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) ArchiveChat(w http.ResponseWriter, r *http.Request) {
+	var body view.ArchiveChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.ArchiveChat(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) DeleteChat(w http.ResponseWriter, r *http.Request) {
+	var body view.DeleteChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.DeleteChat(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, response)
+}
+
+func (c *ChatHandler) GetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	var body view.NotificationSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.GetNotificationSettings(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) UpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	var body view.UpdateNotificationSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" || body.Mode == "" {
+		respondWithError(w, http.StatusBadRequest, "chat, user or mode not found")
+		return
+	}
+
+	response, err := c.chatService.UpdateNotificationSettings(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
 func (c *ChatHandler) GetChats(w http.ResponseWriter, r *http.Request) {
 	var body view.ChatsRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
@@ -184,6 +410,1709 @@ func (c *ChatHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, response)
 }
 
+func (c *ChatHandler) DiscoverChats(w http.ResponseWriter, r *http.Request) {
+	var body view.DiscoverChatsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	response, err := c.chatService.DiscoverChats(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) JoinChat(w http.ResponseWriter, r *http.Request) {
+	var body view.JoinChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.JoinChat(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) AddInvite(w http.ResponseWriter, r *http.Request) {
+	var body view.NewInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" || body.ExpiresAt == "" {
+		respondWithError(w, http.StatusBadRequest, "chat, user or expires_at not found")
+		return
+	}
+
+	response, err := c.chatService.AddInvite(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (c *ChatHandler) GetInvites(w http.ResponseWriter, r *http.Request) {
+	var body view.InvitesRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.GetInvites(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	var body view.RevokeInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.Token == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "token or user not found")
+		return
+	}
+
+	response, err := c.chatService.RevokeInvite(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) RedeemInvite(w http.ResponseWriter, r *http.Request) {
+	var body view.RedeemInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.Token == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "token or user not found")
+		return
+	}
+
+	response, err := c.chatService.RedeemInvite(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	var body view.UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "user not found")
+		return
+	}
+
+	response, err := c.chatService.GetUser(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var body view.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "user not found")
+		return
+	}
+
+	response, err := c.chatService.UpdateUser(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) LookupUsers(w http.ResponseWriter, r *http.Request) {
+	var body view.LookupUsersRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if len(body.UsersID) < 1 {
+		respondWithError(w, http.StatusBadRequest, "users not found")
+		return
+	}
+
+	response, err := c.chatService.LookupUsers(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	var body view.SearchUsersRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.Query == "" {
+		respondWithError(w, http.StatusBadRequest, "query not found")
+		return
+	}
+
+	response, err := c.chatService.SearchUsers(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) Ping(w http.ResponseWriter, r *http.Request) {
+	var body view.UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "user not found")
+		return
+	}
+
+	response, err := c.chatService.Ping(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) Typing(w http.ResponseWriter, r *http.Request) {
+	var body view.TypingRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.Typing(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) PollEvents(w http.ResponseWriter, r *http.Request) {
+	var body view.PollEventsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "user not found")
+		return
+	}
+
+	response, err := c.chatService.PollEvents(r.Context(), body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	var body view.BlockUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.UserID == "" || body.BlockedID == "" {
+		respondWithError(w, http.StatusBadRequest, "user or blocked not found")
+		return
+	}
+
+	response, err := c.chatService.BlockUser(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	var body view.BlockUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.UserID == "" || body.BlockedID == "" {
+		respondWithError(w, http.StatusBadRequest, "user or blocked not found")
+		return
+	}
+
+	response, err := c.chatService.UnblockUser(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) GetBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	var body view.UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "user not found")
+		return
+	}
+
+	response, err := c.chatService.GetBlockedUsers(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	var body view.UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "user not found")
+		return
+	}
+
+	response, err := c.chatService.DeleteUser(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, response)
+}
+
+func (c *ChatHandler) ScheduleMessage(w http.ResponseWriter, r *http.Request) {
+	var body view.ScheduleMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.Text == "" || body.ChatID == "" || body.UserID == "" || body.SendAt == "" {
+		respondWithError(w, http.StatusBadRequest, "chat, user, text or send_at not found")
+		return
+	}
+
+	response, err := c.chatService.ScheduleMessage(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (c *ChatHandler) GetScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	var body view.UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "user not found")
+		return
+	}
+
+	response, err := c.chatService.GetScheduledMessages(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) UpdateScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	var body view.UpdateScheduledMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "id or user not found")
+		return
+	}
+
+	response, err := c.chatService.UpdateScheduledMessage(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) CancelScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	var body view.ScheduledMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "id or user not found")
+		return
+	}
+
+	response, err := c.chatService.CancelScheduledMessage(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) SaveDraft(w http.ResponseWriter, r *http.Request) {
+	var body view.SaveDraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.SaveDraft(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) GetDraft(w http.ResponseWriter, r *http.Request) {
+	var body view.DraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.GetDraft(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) ClearDraft(w http.ResponseWriter, r *http.Request) {
+	var body view.DraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.ClearDraft(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) ForwardMessages(w http.ResponseWriter, r *http.Request) {
+	var body view.ForwardMessagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.FromChatID == "" || body.ChatID == "" || body.UserID == "" || len(body.MessagesID) == 0 {
+		respondWithError(w, http.StatusBadRequest, "from_chat, chat, user or messages not found")
+		return
+	}
+
+	response, err := c.chatService.ForwardMessages(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (c *ChatHandler) Vote(w http.ResponseWriter, r *http.Request) {
+	var body view.VoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.MessageID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "message or user not found")
+		return
+	}
+
+	response, err := c.chatService.Vote(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) Unvote(w http.ResponseWriter, r *http.Request) {
+	var body view.VoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.MessageID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "message or user not found")
+		return
+	}
+
+	response, err := c.chatService.Unvote(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) LeaveChat(w http.ResponseWriter, r *http.Request) {
+	var body view.LeaveChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.LeaveChat(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	var body view.NewWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" || body.URL == "" {
+		respondWithError(w, http.StatusBadRequest, "chat, user or url not found")
+		return
+	}
+
+	response, err := c.chatService.AddWebhook(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (c *ChatHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	var body view.WebhooksRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.GetWebhooks(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	var body view.DeleteWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.WebhookID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "webhook or user not found")
+		return
+	}
+
+	response, err := c.chatService.DeleteWebhook(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) GetWebhookFailures(w http.ResponseWriter, r *http.Request) {
+	var body view.WebhooksRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.GetWebhookFailures(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) AddIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	var body view.NewIncomingWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" || body.BotName == "" {
+		respondWithError(w, http.StatusBadRequest, "chat, user or bot_name not found")
+		return
+	}
+
+	response, err := c.chatService.AddIncomingWebhook(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (c *ChatHandler) GetIncomingWebhooks(w http.ResponseWriter, r *http.Request) {
+	var body view.WebhooksRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.GetIncomingWebhooks(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) DeleteIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	var body view.DeleteWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.WebhookID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "webhook or user not found")
+		return
+	}
+
+	response, err := c.chatService.DeleteIncomingWebhook(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// PostIncomingWebhook serves /hooks/{token}, the URL external systems post
+// their messages to.
+func (c *ChatHandler) PostIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, "/hooks/")
+	if token == "" || strings.Contains(token, "/") {
+		respondWithError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+
+	var body view.IncomingWebhookMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.Text == "" {
+		respondWithError(w, http.StatusBadRequest, "text not found")
+		return
+	}
+
+	response, err := c.chatService.PostIncomingWebhook(token, body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (c *ChatHandler) AddBot(w http.ResponseWriter, r *http.Request) {
+	var body view.NewBotRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.UserID == "" || body.UserName == "" {
+		respondWithError(w, http.StatusBadRequest, "user or username not found")
+		return
+	}
+
+	response, err := c.chatService.AddBot(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (c *ChatHandler) AddBotKey(w http.ResponseWriter, r *http.Request) {
+	var body view.BotRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.BotID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "bot or user not found")
+		return
+	}
+
+	response, err := c.chatService.AddBotKey(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (c *ChatHandler) GetBotKeys(w http.ResponseWriter, r *http.Request) {
+	var body view.BotRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.BotID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "bot or user not found")
+		return
+	}
+
+	response, err := c.chatService.GetBotKeys(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) RevokeBotKey(w http.ResponseWriter, r *http.Request) {
+	var body view.RevokeBotKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.BotID == "" || body.UserID == "" || body.KeyID == "" {
+		respondWithError(w, http.StatusBadRequest, "bot, user or key not found")
+		return
+	}
+
+	response, err := c.chatService.RevokeBotKey(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) AddBotToChat(w http.ResponseWriter, r *http.Request) {
+	var body view.AddBotToChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" || body.BotID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat, user or bot not found")
+		return
+	}
+
+	response, err := c.chatService.AddBotToChat(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// BotChats and the other handlers of the bot API authenticate with the API
+// key of the bot instead of taking the user in the body.
+func (c *ChatHandler) BotChats(w http.ResponseWriter, r *http.Request) {
+	key := botKey(r)
+	if key == "" {
+		respondWithError(w, http.StatusUnauthorized, "API key not found")
+		return
+	}
+
+	response, err := c.chatService.BotChats(key)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) BotMessages(w http.ResponseWriter, r *http.Request) {
+	key := botKey(r)
+	if key == "" {
+		respondWithError(w, http.StatusUnauthorized, "API key not found")
+		return
+	}
+
+	var body view.BotChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat not found")
+		return
+	}
+
+	response, err := c.chatService.BotMessages(key, body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) BotSendMessage(w http.ResponseWriter, r *http.Request) {
+	key := botKey(r)
+	if key == "" {
+		respondWithError(w, http.StatusUnauthorized, "API key not found")
+		return
+	}
+
+	var body view.BotMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || (body.Text == "" && body.Poll == nil) {
+		respondWithError(w, http.StatusBadRequest, "chat or text not found")
+		return
+	}
+
+	response, err := c.chatService.BotSendMessage(key, body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (c *ChatHandler) BotPollEvents(w http.ResponseWriter, r *http.Request) {
+	key := botKey(r)
+	if key == "" {
+		respondWithError(w, http.StatusUnauthorized, "API key not found")
+		return
+	}
+
+	var body view.BotPollEventsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	response, err := c.chatService.BotPollEvents(r.Context(), key, body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) SetBotWebhook(w http.ResponseWriter, r *http.Request) {
+	key := botKey(r)
+	if key == "" {
+		respondWithError(w, http.StatusUnauthorized, "API key not found")
+		return
+	}
+
+	var body view.BotWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	response, err := c.chatService.SetBotWebhook(key, body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) SetBotCommands(w http.ResponseWriter, r *http.Request) {
+	key := botKey(r)
+	if key == "" {
+		respondWithError(w, http.StatusUnauthorized, "API key not found")
+		return
+	}
+
+	var body view.BotCommandsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	response, err := c.chatService.SetBotCommands(key, body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c *ChatHandler) BotRespondCommand(w http.ResponseWriter, r *http.Request) {
+	key := botKey(r)
+	if key == "" {
+		respondWithError(w, http.StatusUnauthorized, "API key not found")
+		return
+	}
+
+	var body view.BotCommandResponse
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.CallID == "" {
+		respondWithError(w, http.StatusBadRequest, "command call not found")
+		return
+	}
+
+	response, err := c.chatService.BotRespondCommand(key, body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+// botKey reads the API key from the "Authorization: Bearer <key>" header.
+func botKey(r *http.Request) string {
+	const scheme = "Bearer "
+
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, scheme) {
+		return ""
+	}
+
+	return strings.TrimSpace(header[len(scheme):])
+}
+
+func (c *ChatHandler) GetCommands(w http.ResponseWriter, r *http.Request) {
+	var body view.CommandsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "json is invalid: "+err.Error())
+
+		return
+	}
+
+	if body.ChatID == "" || body.UserID == "" {
+		respondWithError(w, http.StatusBadRequest, "chat or user not found")
+		return
+	}
+
+	response, err := c.chatService.GetCommands(body)
+	if err != nil {
+		var responseError *errs.ResponseError
+		if errors.As(err, &responseError) {
+			if responseError.Err != nil {
+				log.Println(responseError.Err.Error())
+			}
+
+			respondWithError(w, responseError.Status, responseError.Message)
+
+			return
+		}
+
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, view.ErrorResponse{ErrorMessage: view.ErrorDetails{Code: code, Message: message}})
 }
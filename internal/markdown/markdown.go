@@ -0,0 +1,331 @@
+// Package markdown parses the restricted Markdown accepted in messages:
+// **bold**, *italic* or _italic_, `code`, [links](https://example.com) and
+// lines quoted with "> ". A backslash escapes a marker. Anything else,
+// including unmatched markers, is kept as plain text.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/flaambe/avito/internal/model"
+)
+
+// Parse strips the markup from source and returns the plain text together
+// with the entities that format it.
+func Parse(source string) (string, []model.Entity) {
+	p := &parser{}
+
+	for i, line := range strings.Split(source, "\n") {
+		if i > 0 {
+			p.write('\n')
+		}
+
+		if strings.HasPrefix(line, ">") {
+			start := p.pos
+			p.inline([]rune(strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")))
+			p.addQuote(start)
+
+			continue
+		}
+
+		p.inline([]rune(line))
+	}
+
+	sort.SliceStable(p.entities, func(i, j int) bool {
+		if p.entities[i].Offset != p.entities[j].Offset {
+			return p.entities[i].Offset < p.entities[j].Offset
+		}
+
+		return p.entities[i].Length > p.entities[j].Length
+	})
+
+	return p.text.String(), p.entities
+}
+
+type parser struct {
+	text     strings.Builder
+	pos      int
+	entities []model.Entity
+}
+
+func (p *parser) write(r rune) {
+	p.text.WriteRune(r)
+	p.pos += utf16Len(r)
+}
+
+func (p *parser) add(kind string, start int, link string) {
+	if p.pos > start {
+		p.entities = append(p.entities, model.Entity{Type: kind, Offset: start, Length: p.pos - start, URL: link})
+	}
+}
+
+// addQuote merges quoted lines that follow each other into one quote.
+func (p *parser) addQuote(start int) {
+	if n := len(p.entities); n > 0 {
+		last := &p.entities[n-1]
+		if last.Type == model.EntityQuote && last.Offset+last.Length+1 == start {
+			last.Length = p.pos - last.Offset
+
+			return
+		}
+	}
+
+	p.add(model.EntityQuote, start, "")
+}
+
+func (p *parser) inline(src []rune) {
+	for i := 0; i < len(src); {
+		r := src[i]
+
+		switch {
+		case r == '\\' && i+1 < len(src) && isMarker(src[i+1]):
+			p.write(src[i+1])
+			i += 2
+
+			continue
+
+		case r == '`':
+			if end := indexRune(src, i+1, '`'); end > i+1 {
+				start := p.pos
+				for _, c := range src[i+1 : end] {
+					p.write(c)
+				}
+				p.add(model.EntityCode, start, "")
+				i = end + 1
+
+				continue
+			}
+
+		case r == '*' && i+1 < len(src) && src[i+1] == '*':
+			if end := indexDouble(src, i+2, '*'); end > i+2 {
+				start := p.pos
+				p.inline(src[i+2 : end])
+				p.add(model.EntityBold, start, "")
+				i = end + 2
+
+				continue
+			}
+
+		case r == '*' || (r == '_' && (i == 0 || !isWord(src[i-1]))):
+			if end := indexItalic(src, i+1, r); end > i+1 {
+				start := p.pos
+				p.inline(src[i+1 : end])
+				p.add(model.EntityItalic, start, "")
+				i = end + 1
+
+				continue
+			}
+
+		case r == '[':
+			if label, link, end := parseLink(src, i); end > 0 {
+				start := p.pos
+				p.inline(label)
+				p.add(model.EntityLink, start, link)
+				i = end
+
+				continue
+			}
+		}
+
+		p.write(r)
+		i++
+	}
+}
+
+// parseLink reads [label](url) at src[i] and returns the index after it, or
+// zero when there is no link with a safe URL there.
+func parseLink(src []rune, i int) ([]rune, string, int) {
+	close := indexRune(src, i+1, ']')
+	if close <= i+1 || close+1 >= len(src) || src[close+1] != '(' {
+		return nil, "", 0
+	}
+
+	end := indexRune(src, close+2, ')')
+	if end < 0 {
+		return nil, "", 0
+	}
+
+	link := string(src[close+2 : end])
+	if !SafeURL(link) {
+		return nil, "", 0
+	}
+
+	return src[i+1 : close], link, end + 1
+}
+
+// SafeURL allows absolute http, https and mailto links only.
+func SafeURL(link string) bool {
+	if strings.ContainsAny(link, " \t\n\"'<>") {
+		return false
+	}
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		return parsed.Host != ""
+	case "mailto":
+		return parsed.Opaque != ""
+	}
+
+	return false
+}
+
+func indexRune(src []rune, from int, marker rune) int {
+	for k := from; k < len(src); k++ {
+		if src[k] == '\\' && marker != '`' {
+			k++
+
+			continue
+		}
+
+		if src[k] == marker {
+			return k
+		}
+	}
+
+	return -1
+}
+
+func indexDouble(src []rune, from int, marker rune) int {
+	for k := from; k+1 < len(src); k++ {
+		if src[k] == '\\' {
+			k++
+
+			continue
+		}
+
+		if src[k] == marker && src[k+1] == marker {
+			return k
+		}
+	}
+
+	return -1
+}
+
+// indexItalic finds the closing marker of an italic run. Bold markers are
+// skipped and an underscore inside a word, as in snake_case, doesn't close.
+func indexItalic(src []rune, from int, marker rune) int {
+	for k := from; k < len(src); k++ {
+		switch {
+		case src[k] == '\\':
+			k++
+		case src[k] != marker:
+		case marker == '*' && k+1 < len(src) && src[k+1] == '*':
+			k++
+		case marker == '_' && k+1 < len(src) && isWord(src[k+1]):
+		default:
+			return k
+		}
+	}
+
+	return -1
+}
+
+// HTML renders the text with its entities, ordered as Parse returns them,
+// as sanitized HTML for web clients. Tags are always balanced, even for
+// entities that overlap.
+func HTML(text string, entities []model.Entity) string {
+	var out strings.Builder
+	var open []model.Entity
+
+	closeUntil := func(pos int) {
+		for len(open) > 0 {
+			top := open[len(open)-1]
+			if top.Offset+top.Length > pos {
+				return
+			}
+
+			out.WriteString(closeTag(top))
+			open = open[:len(open)-1]
+		}
+	}
+
+	next, pos := 0, 0
+	for _, r := range text {
+		closeUntil(pos)
+
+		for ; next < len(entities) && entities[next].Offset <= pos; next++ {
+			entity := entities[next]
+			if entity.Offset < pos || entity.Length <= 0 {
+				continue
+			}
+
+			out.WriteString(openTag(entity))
+			open = append(open, entity)
+		}
+
+		if r == '\n' {
+			out.WriteString("<br>")
+		} else {
+			out.WriteString(html.EscapeString(string(r)))
+		}
+		pos += utf16Len(r)
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString(closeTag(open[i]))
+	}
+
+	return out.String()
+}
+
+func openTag(entity model.Entity) string {
+	switch entity.Type {
+	case model.EntityBold:
+		return "<strong>"
+	case model.EntityItalic:
+		return "<em>"
+	case model.EntityCode:
+		return "<code>"
+	case model.EntityQuote:
+		return "<blockquote>"
+	case model.EntityLink:
+		if SafeURL(entity.URL) {
+			return `<a href="` + html.EscapeString(entity.URL) + `" rel="nofollow noopener noreferrer">`
+		}
+	}
+
+	return "<span>"
+}
+
+func closeTag(entity model.Entity) string {
+	switch entity.Type {
+	case model.EntityBold:
+		return "</strong>"
+	case model.EntityItalic:
+		return "</em>"
+	case model.EntityCode:
+		return "</code>"
+	case model.EntityQuote:
+		return "</blockquote>"
+	case model.EntityLink:
+		if SafeURL(entity.URL) {
+			return "</a>"
+		}
+	}
+
+	return "</span>"
+}
+
+func isMarker(r rune) bool {
+	return strings.ContainsRune("\\*_`[]()>", r)
+}
+
+func isWord(r rune) bool {
+	return r == '_' || ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || r > 0x7f
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+
+	return 1
+}
@@ -0,0 +1,63 @@
+package markdown_test
+
+import (
+	"testing"
+
+	"github.com/flaambe/avito/internal/markdown"
+	"github.com/flaambe/avito/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		source   string
+		text     string
+		entities []model.Entity
+	}{
+		{"plain text", "plain text", nil},
+		{"**bold** and *italic*", "bold and italic", []model.Entity{
+			{Type: model.EntityBold, Offset: 0, Length: 4},
+			{Type: model.EntityItalic, Offset: 9, Length: 6},
+		}},
+		{"**bold _italic_**", "bold italic", []model.Entity{
+			{Type: model.EntityBold, Offset: 0, Length: 11},
+			{Type: model.EntityItalic, Offset: 5, Length: 6},
+		}},
+		{"run `go *test*`", "run go *test*", []model.Entity{
+			{Type: model.EntityCode, Offset: 4, Length: 9},
+		}},
+		{"see [docs](https://example.com/a?b=c)", "see docs", []model.Entity{
+			{Type: model.EntityLink, Offset: 4, Length: 4, URL: "https://example.com/a?b=c"},
+		}},
+		{"> first\n> second\nreply", "first\nsecond\nreply", []model.Entity{
+			{Type: model.EntityQuote, Offset: 0, Length: 12},
+		}},
+		{"😀 *hi*", "😀 hi", []model.Entity{
+			{Type: model.EntityItalic, Offset: 3, Length: 2},
+		}},
+		{"[x](javascript:alert(1))", "[x](javascript:alert(1))", nil},
+		{"snake_case_name and 2*3", "snake_case_name and 2*3", nil},
+		{`\*not italic\*`, "*not italic*", nil},
+		{"**", "**", nil},
+	}
+
+	for _, test := range tests {
+		text, entities := markdown.Parse(test.source)
+		assert.Equal(test.text, text, test.source)
+		assert.Equal(test.entities, entities, test.source)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	assert := assert.New(t)
+
+	text, entities := markdown.Parse("> **a** <b>\n[link](https://example.com/?a=1&b=2)")
+	assert.Equal(`<blockquote><strong>a</strong> &lt;b&gt;</blockquote><br><a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener noreferrer">link</a>`,
+		markdown.HTML(text, entities))
+
+	unsafe := []model.Entity{{Type: model.EntityLink, Offset: 0, Length: 1, URL: "javascript:alert(1)"}}
+	assert.Equal("<span>x</span>", markdown.HTML("x", unsafe))
+}
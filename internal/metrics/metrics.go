@@ -0,0 +1,8 @@
+// Package metrics holds the server counters. They are published through
+// expvar and served at /debug/vars.
+package metrics
+
+import "expvar"
+
+// MessagesExpired counts messages deleted by the retention sweeper.
+var MessagesExpired = expvar.NewInt("messages_expired")
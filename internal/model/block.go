@@ -0,0 +1,10 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type Block struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	User      primitive.ObjectID `bson:"user"`
+	Blocked   primitive.ObjectID `bson:"blocked"`
+	CreatedAt primitive.DateTime `bson:"created_at"`
+}
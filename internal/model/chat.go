@@ -3,8 +3,40 @@ package model
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Chat struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty"`
-	Name      string             `bson:"name"`
-	Users     []User             `bson:"users"`
-	CreatedAt primitive.DateTime `bson:"created_at"`
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Name        string             `bson:"name"`
+	Description string             `bson:"description"`
+	Avatar      string             `bson:"avatar"`
+	Owner       primitive.ObjectID `bson:"owner,omitempty"`
+	Public      bool               `bson:"public"`
+	// Direct chats are private conversations of two users, in which blocks
+	// apply. They stay direct when bots join them.
+	Direct    bool                 `bson:"direct"`
+	Users     []User               `bson:"users"`
+	Archived  []primitive.ObjectID `bson:"archived,omitempty"`
+	CreatedAt primitive.DateTime   `bson:"created_at"`
+
+	// RetentionDays overrides the global message retention when positive.
+	RetentionDays int `bson:"retention_days,omitempty"`
+}
+
+// ChatSummary describes a chat without loading its members.
+type ChatSummary struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Name        string             `bson:"name"`
+	Description string             `bson:"description"`
+	Avatar      string             `bson:"avatar"`
+	Members     int                `bson:"members"`
+	CreatedAt   primitive.DateTime `bson:"created_at"`
+}
+
+// ChatDeletion is kept after the chat document is removed so that the
+// background cleanup of its messages can be resumed and reported.
+type ChatDeletion struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Owner      primitive.ObjectID `bson:"owner"`
+	Deleted    int64              `bson:"deleted"`
+	Done       bool               `bson:"done"`
+	CreatedAt  primitive.DateTime `bson:"created_at"`
+	FinishedAt primitive.DateTime `bson:"finished_at,omitempty"`
 }
@@ -0,0 +1,23 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Command describes a slash command, built into the chat or served by a bot.
+type Command struct {
+	Name        string `bson:"name"`
+	Usage       string `bson:"usage,omitempty"`
+	Description string `bson:"description"`
+}
+
+// CommandCall is a slash command sent by a user, delivered to the bot that
+// serves it. Calls are kept until ExpiresAt, while the bot can answer them.
+type CommandCall struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Chat      primitive.ObjectID `bson:"chat"`
+	User      primitive.ObjectID `bson:"user"`
+	Bot       primitive.ObjectID `bson:"bot"`
+	Name      string             `bson:"name"`
+	Args      []string           `bson:"args"`
+	Text      string             `bson:"text"`
+	ExpiresAt primitive.DateTime `bson:"expires_at"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Draft is the unsent message of a user in a chat, shared by all their
+// devices. There is at most one per user and chat.
+type Draft struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Chat      primitive.ObjectID `bson:"chat"`
+	User      primitive.ObjectID `bson:"user"`
+	Text      string             `bson:"text"`
+	ReplyTo   primitive.ObjectID `bson:"reply_to,omitempty"`
+	UpdatedAt primitive.DateTime `bson:"updated_at"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	ErasureAnonymize = "anonymize"
+	ErasureDelete    = "delete"
+)
+
+const (
+	ErasureStageMembership = "membership"
+	ErasureStageMessages   = "messages"
+	ErasureStageDone       = "done"
+)
+
+// ErasureJob tracks the erasure of a deactivated user so that it can be
+// resumed after a restart. Its ID is the ID of the user.
+type ErasureJob struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Policy     string             `bson:"policy"`
+	Stage      string             `bson:"stage"`
+	Messages   int64              `bson:"messages"`
+	CreatedAt  primitive.DateTime `bson:"created_at"`
+	FinishedAt primitive.DateTime `bson:"finished_at,omitempty"`
+}
+
+type AuditRecord struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Action    string             `bson:"action"`
+	Subject   primitive.ObjectID `bson:"subject"`
+	Details   string             `bson:"details"`
+	CreatedAt primitive.DateTime `bson:"created_at"`
+}
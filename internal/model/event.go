@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	EventTyping       = "typing"
+	EventMessage      = "message"
+	EventNotification = "notification"
+	EventCommand      = "command"
+	EventEphemeral    = "ephemeral"
+)
+
+// Event is delivered to connected users and is never persisted.
+type Event struct {
+	Type      string
+	Chat      primitive.ObjectID
+	User      primitive.ObjectID
+	Message   *Message
+	Command   *CommandCall
+	ExpiresAt time.Time
+}
@@ -0,0 +1,15 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type Invite struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Token     string             `bson:"token"`
+	Chat      primitive.ObjectID `bson:"chat"`
+	Creator   primitive.ObjectID `bson:"creator"`
+	MaxUses   int                `bson:"max_uses"`
+	Remaining int                `bson:"remaining"`
+	Revoked   bool               `bson:"revoked"`
+	ExpiresAt primitive.DateTime `bson:"expires_at"`
+	CreatedAt primitive.DateTime `bson:"created_at"`
+}
@@ -2,10 +2,84 @@ package model
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// The message type tells which payload a message carries. Every message
+// keeps a readable text, so clients that don't know a type can show it.
+const (
+	MessageTypeText   = "text"
+	MessageTypeSystem = "system"
+	MessageTypePoll   = "poll"
+	MessageTypeAction = "action"
+
+	// Ephemeral messages answer slash commands. They are shown to the
+	// caller only and never stored.
+	MessageTypeEphemeral = "ephemeral"
+)
+
+const (
+	SystemChatCreated  = "chat_created"
+	SystemChatRenamed  = "chat_renamed"
+	SystemChatUpdated  = "chat_updated"
+	SystemMemberJoined = "member_joined"
+	SystemMemberLeft   = "member_left"
+)
+
 type Message struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty"`
 	Chat      primitive.ObjectID `bson:"chat"`
 	Author    primitive.ObjectID `bson:"author"`
+	Bot       bool               `bson:"bot,omitempty"`
+	Type      string             `bson:"type,omitempty"`
 	Text      string             `bson:"text"`
+	Entities  []Entity           `bson:"entities,omitempty"`
 	CreatedAt primitive.DateTime `bson:"created_at"`
+
+	// ExpiresAt is set on self-destructing messages. A TTL index purges
+	// them once it has passed.
+	ExpiresAt primitive.DateTime `bson:"expires_at,omitempty"`
+
+	ForwardedFrom *ForwardedFrom `bson:"forwarded_from,omitempty"`
+	Poll          *Poll          `bson:"poll,omitempty"`
+	System        *SystemEvent   `bson:"system,omitempty"`
+
+	// Previews are filled in asynchronously after the message is sent.
+	Previews []Preview `bson:"previews,omitempty"`
+}
+
+const (
+	EntityBold   = "bold"
+	EntityItalic = "italic"
+	EntityCode   = "code"
+	EntityLink   = "link"
+	EntityQuote  = "quote"
+)
+
+// Entity formats a part of the message text. Offset and Length count UTF-16
+// code units, the way web and mobile clients index strings.
+type Entity struct {
+	Type   string `bson:"type"`
+	Offset int    `bson:"offset"`
+	Length int    `bson:"length"`
+	URL    string `bson:"url,omitempty"`
+}
+
+// SystemEvent is the payload of a system message. The author of the message
+// is the user the event is about.
+type SystemEvent struct {
+	Event string `bson:"event"`
+	// By is the member who added the new member to the chat.
+	By primitive.ObjectID `bson:"by,omitempty"`
+	// Name is the chat name for created and renamed chats.
+	Name string `bson:"name,omitempty"`
+	// Field is the setting changed by a chat_updated event.
+	Field string `bson:"field,omitempty"`
+	// Via tells how a member joined: "public" or "invite".
+	Via string `bson:"via,omitempty"`
+}
+
+// ForwardedFrom points a forwarded copy at the original message. Copies of
+// copies keep pointing at the original.
+type ForwardedFrom struct {
+	Message primitive.ObjectID `bson:"message"`
+	Chat    primitive.ObjectID `bson:"chat"`
+	Author  primitive.ObjectID `bson:"author"`
 }
@@ -0,0 +1,19 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	NotifyAll      = "all"
+	NotifyMentions = "mentions"
+	NotifyMuted    = "muted"
+)
+
+// NotificationSettings are kept per user and per chat. A muted chat without
+// MutedUntil stays muted until the user changes the settings again.
+type NotificationSettings struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Chat       primitive.ObjectID `bson:"chat"`
+	User       primitive.ObjectID `bson:"user"`
+	Mode       string             `bson:"mode"`
+	MutedUntil primitive.DateTime `bson:"muted_until,omitempty"`
+}
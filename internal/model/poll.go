@@ -0,0 +1,19 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Poll is the payload of a poll message. Votes are kept as voter sets on the
+// options, so voting is a single atomic update of the message and results
+// are counted when the message is read.
+type Poll struct {
+	Question  string             `bson:"question"`
+	Options   []PollOption       `bson:"options"`
+	Multiple  bool               `bson:"multiple"`
+	Anonymous bool               `bson:"anonymous"`
+	ClosesAt  primitive.DateTime `bson:"closes_at,omitempty"`
+}
+
+type PollOption struct {
+	Text   string               `bson:"text"`
+	Voters []primitive.ObjectID `bson:"voters"`
+}
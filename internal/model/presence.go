@@ -0,0 +1,17 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+// Presence is the raw activity of a user. Whether they are online, away or
+// offline is derived from it using the configured timeouts.
+type Presence struct {
+	User        primitive.ObjectID `bson:"_id"`
+	LastSeen    primitive.DateTime `bson:"last_seen"`
+	Connections int                `bson:"connections"`
+}
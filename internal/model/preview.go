@@ -0,0 +1,9 @@
+package model
+
+// Preview is the card shown for a link in a message.
+type Preview struct {
+	URL         string `bson:"url"`
+	Title       string `bson:"title,omitempty"`
+	Description string `bson:"description,omitempty"`
+	Image       string `bson:"image,omitempty"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	ScheduledPending   = "pending"
+	ScheduledSending   = "sending"
+	ScheduledSent      = "sent"
+	ScheduledFailed    = "failed"
+	ScheduledCancelled = "cancelled"
+)
+
+// ScheduledMessage waits for its send_at time. Once delivered, the message
+// is stored with the same ID, so a delivery can be repeated safely.
+type ScheduledMessage struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Chat      primitive.ObjectID `bson:"chat"`
+	Author    primitive.ObjectID `bson:"author"`
+	Text      string             `bson:"text"`
+	TTL       int64              `bson:"ttl,omitempty"`
+	SendAt    primitive.DateTime `bson:"send_at"`
+	Status    string             `bson:"status"`
+	Error     string             `bson:"error,omitempty"`
+	CreatedAt primitive.DateTime `bson:"created_at"`
+}
@@ -2,7 +2,31 @@ package model
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// User is also embedded into chats as a member. Profile fields are omitted
+// when empty so that the embedded copies only carry the ID and username.
 type User struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	UserName string             `bson:"username"`
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	UserName    string             `bson:"username"`
+	DisplayName string             `bson:"display_name,omitempty"`
+	Avatar      string             `bson:"avatar,omitempty"`
+	Bio         string             `bson:"bio,omitempty"`
+	Status      string             `bson:"status,omitempty"`
+	Deactivated bool               `bson:"deactivated,omitempty"`
+
+	// Bot accounts post on behalf of integrations such as incoming webhooks.
+	// Bots created through the bot API authenticate with API keys and are
+	// managed by their owner.
+	Bot      bool               `bson:"bot,omitempty"`
+	Owner    primitive.ObjectID `bson:"owner,omitempty"`
+	Commands []Command          `bson:"commands,omitempty"`
+}
+
+// APIKey authenticates a bot. Only a hash of the key is stored, the prefix
+// tells the keys of a bot apart.
+type APIKey struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Bot       primitive.ObjectID `bson:"bot"`
+	Hash      string             `bson:"hash"`
+	Prefix    string             `bson:"prefix"`
+	CreatedAt primitive.DateTime `bson:"created_at"`
 }
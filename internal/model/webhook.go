@@ -0,0 +1,72 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Events that webhooks can subscribe to.
+const (
+	WebhookMessageCreated = "message.created"
+	WebhookChatCreated    = "chat.created"
+	WebhookMemberJoined   = "member.joined"
+)
+
+// WebhookCommandInvoked is only sent to the webhooks of the bot serving the
+// slash command.
+const WebhookCommandInvoked = "command.invoked"
+
+// WebhookEvents lists every event, in the order they are documented.
+var WebhookEvents = []string{WebhookMessageCreated, WebhookChatCreated, WebhookMemberJoined}
+
+// Webhook subscribes a URL to the events of a chat. Global webhooks have no
+// chat and receive the events of every chat. Webhooks of a bot receive the
+// events of the chats the bot is a member of.
+type Webhook struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Chat      primitive.ObjectID `bson:"chat,omitempty"`
+	Bot       primitive.ObjectID `bson:"bot,omitempty"`
+	Creator   primitive.ObjectID `bson:"creator,omitempty"`
+	URL       string             `bson:"url"`
+	Secret    string             `bson:"secret"`
+	Events    []string           `bson:"events"`
+	CreatedAt primitive.DateTime `bson:"created_at"`
+}
+
+// Subscribed reports whether the webhook receives the event. A webhook
+// without events receives all of them.
+func (w Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, subscribed := range w.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookFailure is a dead letter: a delivery that failed after all its
+// attempts.
+type WebhookFailure struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	Webhook  primitive.ObjectID `bson:"webhook,omitempty"`
+	Chat     primitive.ObjectID `bson:"chat,omitempty"`
+	URL      string             `bson:"url"`
+	Event    string             `bson:"event"`
+	Payload  string             `bson:"payload"`
+	Attempts int                `bson:"attempts"`
+	Error    string             `bson:"error"`
+	FailedAt primitive.DateTime `bson:"failed_at"`
+}
+
+// IncomingWebhook lets an external system post into a chat as its bot by
+// knowing the token.
+type IncomingWebhook struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Chat      primitive.ObjectID `bson:"chat"`
+	Creator   primitive.ObjectID `bson:"creator"`
+	Bot       primitive.ObjectID `bson:"bot"`
+	Token     string             `bson:"token"`
+	CreatedAt primitive.DateTime `bson:"created_at"`
+}
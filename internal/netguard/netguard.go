@@ -0,0 +1,84 @@
+// Package netguard keeps the requests made on behalf of users, such as link
+// previews and webhooks, away from loopback, private and other internal
+// addresses.
+package netguard
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for hosts that resolve to loopback,
+// private or otherwise internal addresses.
+var ErrForbiddenAddress = errors.New("netguard: address is not public")
+
+// Transport returns an HTTP transport that only connects to the addresses
+// allow accepts. They are checked when dialing, after DNS resolution, so
+// that neither rebinding nor redirects reach internal hosts. Proxies are
+// never used, since they would be dialed instead of the host.
+func Transport(timeout time.Duration, allow func(net.IP) bool) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !allow(ip) {
+				return ErrForbiddenAddress
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       time.Minute,
+	}
+}
+
+// IsPublic reports whether ip is a public unicast address.
+func IsPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+
+	for _, block := range privateBlocks {
+		if block.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+var privateBlocks = func() []*net.IPNet {
+	var blocks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"240.0.0.0/4",
+		"fc00::/7",
+		"64:ff9b::/96",
+	} {
+		_, block, _ := net.ParseCIDR(cidr)
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}()
@@ -0,0 +1,88 @@
+package presence
+
+import (
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/model"
+)
+
+// MemoryStore keeps presence in the memory of a single server instance.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	presence map[primitive.ObjectID]model.Presence
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		presence: make(map[primitive.ObjectID]model.Presence),
+	}
+}
+
+func (m *MemoryStore) Touch(user primitive.ObjectID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.presence[user] = seen(m.presence[user], user, at)
+
+	return nil
+}
+
+func (m *MemoryStore) Connect(user primitive.ObjectID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := seen(m.presence[user], user, at)
+	p.Connections++
+	m.presence[user] = p
+
+	return nil
+}
+
+func (m *MemoryStore) Disconnect(user primitive.ObjectID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := seen(m.presence[user], user, at)
+	if p.Connections > 0 {
+		p.Connections--
+	}
+	m.presence[user] = p
+
+	return nil
+}
+
+func (m *MemoryStore) Find(users []primitive.ObjectID) (map[primitive.ObjectID]model.Presence, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := make(map[primitive.ObjectID]model.Presence, len(users))
+	for _, user := range users {
+		if p, ok := m.presence[user]; ok {
+			found[user] = p
+		}
+	}
+
+	return found, nil
+}
+
+// Forget drops the presence of the user.
+func (m *MemoryStore) Forget(user primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.presence, user)
+
+	return nil
+}
+
+func seen(p model.Presence, user primitive.ObjectID, at time.Time) model.Presence {
+	p.User = user
+	if lastSeen := primitive.NewDateTimeFromTime(at); lastSeen > p.LastSeen {
+		p.LastSeen = lastSeen
+	}
+
+	return p
+}
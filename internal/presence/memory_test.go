@@ -0,0 +1,45 @@
+package presence_test
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/presence"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	assert := assert.New(t)
+	testObj := presence.NewMemoryStore()
+
+	user := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+	now := time.Now().Truncate(time.Millisecond)
+
+	assert.NoError(testObj.Touch(user, now))
+	assert.NoError(testObj.Touch(user, now.Add(-time.Minute)))
+	assert.NoError(testObj.Connect(user, now))
+	assert.NoError(testObj.Connect(user, now))
+	assert.NoError(testObj.Disconnect(user, now))
+
+	found, err := testObj.Find([]primitive.ObjectID{user, other})
+	assert.NoError(err)
+	assert.Len(found, 1)
+	assert.Equal(user, found[user].User)
+	assert.Equal(now, found[user].LastSeen.Time())
+	assert.Equal(1, found[user].Connections)
+
+	assert.NoError(testObj.Disconnect(user, now))
+	assert.NoError(testObj.Disconnect(user, now))
+	found, err = testObj.Find([]primitive.ObjectID{user})
+	assert.NoError(err)
+	assert.Equal(0, found[user].Connections)
+
+	assert.NoError(testObj.Forget(user))
+	found, err = testObj.Find([]primitive.ObjectID{user})
+	assert.NoError(err)
+	assert.Empty(found)
+}
@@ -0,0 +1,31 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	testObj := New(1, 2)
+	testObj.now = func() time.Time { return now }
+
+	assert.True(testObj.Allow("a"))
+	assert.True(testObj.Allow("a"))
+	assert.False(testObj.Allow("a"))
+	assert.True(testObj.Allow("b"))
+
+	now = now.Add(time.Second)
+	assert.True(testObj.Allow("a"))
+	assert.False(testObj.Allow("a"))
+
+	now = now.Add(time.Hour)
+	assert.True(testObj.Allow("a"))
+	assert.True(testObj.Allow("a"))
+	assert.False(testObj.Allow("a"))
+	assert.Len(testObj.buckets, 1)
+}
@@ -5,6 +5,7 @@ package mocks
 import (
 	model "github.com/flaambe/avito/internal/model"
 	mock "github.com/stretchr/testify/mock"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // ChatRepository is an autogenerated mock type for the ChatRepository type
@@ -12,6 +13,155 @@ type ChatRepository struct {
 	mock.Mock
 }
 
+// AddChatMember provides a mock function with given fields: chat, user
+func (_m *ChatRepository) AddChatMember(chat model.Chat, user model.User) error {
+	ret := _m.Called(chat, user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.Chat, model.User) error); ok {
+		r0 = rf(chat, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteBotWebhooks provides a mock function with given fields: bot
+func (_m *ChatRepository) DeleteBotWebhooks(bot primitive.ObjectID) error {
+	ret := _m.Called(bot)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) error); ok {
+		r0 = rf(bot)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteChat provides a mock function with given fields: chat
+func (_m *ChatRepository) DeleteChat(chat model.Chat) error {
+	ret := _m.Called(chat)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.Chat) error); ok {
+		r0 = rf(chat)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteChatInvites provides a mock function with given fields: chat
+func (_m *ChatRepository) DeleteChatInvites(chat primitive.ObjectID) error {
+	ret := _m.Called(chat)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) error); ok {
+		r0 = rf(chat)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteChatNotificationSettings provides a mock function with given fields: chat
+func (_m *ChatRepository) DeleteChatNotificationSettings(chat primitive.ObjectID) error {
+	ret := _m.Called(chat)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) error); ok {
+		r0 = rf(chat)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteChatWebhooks provides a mock function with given fields: chat
+func (_m *ChatRepository) DeleteChatWebhooks(chat primitive.ObjectID) error {
+	ret := _m.Called(chat)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) error); ok {
+		r0 = rf(chat)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteIncomingWebhook provides a mock function with given fields: hook
+func (_m *ChatRepository) DeleteIncomingWebhook(hook model.IncomingWebhook) error {
+	ret := _m.Called(hook)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.IncomingWebhook) error); ok {
+		r0 = rf(hook)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteWebhook provides a mock function with given fields: hook
+func (_m *ChatRepository) DeleteWebhook(hook model.Webhook) error {
+	ret := _m.Called(hook)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.Webhook) error); ok {
+		r0 = rf(hook)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EachChat provides a mock function with given fields: user, fn
+func (_m *ChatRepository) EachChat(user model.User, fn func(model.Chat) error) error {
+	ret := _m.Called(user, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.User, func(model.Chat) error) error); ok {
+		r0 = rf(user, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FindBotWebhooks provides a mock function with given fields: bots
+func (_m *ChatRepository) FindBotWebhooks(bots []primitive.ObjectID) ([]model.Webhook, error) {
+	ret := _m.Called(bots)
+
+	var r0 []model.Webhook
+	if rf, ok := ret.Get(0).(func([]primitive.ObjectID) []model.Webhook); ok {
+		r0 = rf(bots)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]primitive.ObjectID) error); ok {
+		r1 = rf(bots)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FindChatByID provides a mock function with given fields: id
 func (_m *ChatRepository) FindChatByID(id string) (model.Chat, error) {
 	ret := _m.Called(id)
@@ -33,6 +183,50 @@ func (_m *ChatRepository) FindChatByID(id string) (model.Chat, error) {
 	return r0, r1
 }
 
+// FindChatDeletion provides a mock function with given fields: id
+func (_m *ChatRepository) FindChatDeletion(id string) (model.ChatDeletion, error) {
+	ret := _m.Called(id)
+
+	var r0 model.ChatDeletion
+	if rf, ok := ret.Get(0).(func(string) model.ChatDeletion); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(model.ChatDeletion)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindChatNotificationSettings provides a mock function with given fields: chat
+func (_m *ChatRepository) FindChatNotificationSettings(chat model.Chat) ([]model.NotificationSettings, error) {
+	ret := _m.Called(chat)
+
+	var r0 []model.NotificationSettings
+	if rf, ok := ret.Get(0).(func(model.Chat) []model.NotificationSettings); ok {
+		r0 = rf(chat)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.NotificationSettings)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Chat) error); ok {
+		r1 = rf(chat)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FindChats provides a mock function with given fields: user
 func (_m *ChatRepository) FindChats(user model.User) ([]model.Chat, error) {
 	ret := _m.Called(user)
@@ -56,20 +250,547 @@ func (_m *ChatRepository) FindChats(user model.User) ([]model.Chat, error) {
 	return r0, r1
 }
 
-// InsertChat provides a mock function with given fields: name, users
-func (_m *ChatRepository) InsertChat(name string, users []model.User) (string, error) {
-	ret := _m.Called(name, users)
+// FindChatsWithRetention provides a mock function with given fields:
+func (_m *ChatRepository) FindChatsWithRetention() ([]model.Chat, error) {
+	ret := _m.Called()
+
+	var r0 []model.Chat
+	if rf, ok := ret.Get(0).(func() []model.Chat); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Chat)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindCommandCall provides a mock function with given fields: id
+func (_m *ChatRepository) FindCommandCall(id string) (model.CommandCall, error) {
+	ret := _m.Called(id)
+
+	var r0 model.CommandCall
+	if rf, ok := ret.Get(0).(func(string) model.CommandCall); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(model.CommandCall)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindIncomingWebhookByID provides a mock function with given fields: id
+func (_m *ChatRepository) FindIncomingWebhookByID(id string) (model.IncomingWebhook, error) {
+	ret := _m.Called(id)
+
+	var r0 model.IncomingWebhook
+	if rf, ok := ret.Get(0).(func(string) model.IncomingWebhook); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(model.IncomingWebhook)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindIncomingWebhookByToken provides a mock function with given fields: token
+func (_m *ChatRepository) FindIncomingWebhookByToken(token string) (model.IncomingWebhook, error) {
+	ret := _m.Called(token)
+
+	var r0 model.IncomingWebhook
+	if rf, ok := ret.Get(0).(func(string) model.IncomingWebhook); ok {
+		r0 = rf(token)
+	} else {
+		r0 = ret.Get(0).(model.IncomingWebhook)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindIncomingWebhooks provides a mock function with given fields: chat
+func (_m *ChatRepository) FindIncomingWebhooks(chat primitive.ObjectID) ([]model.IncomingWebhook, error) {
+	ret := _m.Called(chat)
+
+	var r0 []model.IncomingWebhook
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) []model.IncomingWebhook); ok {
+		r0 = rf(chat)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.IncomingWebhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID) error); ok {
+		r1 = rf(chat)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindInviteByToken provides a mock function with given fields: token
+func (_m *ChatRepository) FindInviteByToken(token string) (model.Invite, error) {
+	ret := _m.Called(token)
+
+	var r0 model.Invite
+	if rf, ok := ret.Get(0).(func(string) model.Invite); ok {
+		r0 = rf(token)
+	} else {
+		r0 = ret.Get(0).(model.Invite)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindInvites provides a mock function with given fields: chat
+func (_m *ChatRepository) FindInvites(chat model.Chat) ([]model.Invite, error) {
+	ret := _m.Called(chat)
+
+	var r0 []model.Invite
+	if rf, ok := ret.Get(0).(func(model.Chat) []model.Invite); ok {
+		r0 = rf(chat)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Invite)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Chat) error); ok {
+		r1 = rf(chat)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindNotificationSettings provides a mock function with given fields: chat, user
+func (_m *ChatRepository) FindNotificationSettings(chat model.Chat, user model.User) (model.NotificationSettings, error) {
+	ret := _m.Called(chat, user)
+
+	var r0 model.NotificationSettings
+	if rf, ok := ret.Get(0).(func(model.Chat, model.User) model.NotificationSettings); ok {
+		r0 = rf(chat, user)
+	} else {
+		r0 = ret.Get(0).(model.NotificationSettings)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Chat, model.User) error); ok {
+		r1 = rf(chat, user)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindPendingChatDeletions provides a mock function with given fields:
+func (_m *ChatRepository) FindPendingChatDeletions() ([]model.ChatDeletion, error) {
+	ret := _m.Called()
+
+	var r0 []model.ChatDeletion
+	if rf, ok := ret.Get(0).(func() []model.ChatDeletion); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ChatDeletion)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindPublicChats provides a mock function with given fields: query, limit
+func (_m *ChatRepository) FindPublicChats(query string, limit int64) ([]model.ChatSummary, error) {
+	ret := _m.Called(query, limit)
+
+	var r0 []model.ChatSummary
+	if rf, ok := ret.Get(0).(func(string, int64) []model.ChatSummary); ok {
+		r0 = rf(query, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ChatSummary)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int64) error); ok {
+		r1 = rf(query, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindUserNotificationSettings provides a mock function with given fields: user
+func (_m *ChatRepository) FindUserNotificationSettings(user model.User) ([]model.NotificationSettings, error) {
+	ret := _m.Called(user)
+
+	var r0 []model.NotificationSettings
+	if rf, ok := ret.Get(0).(func(model.User) []model.NotificationSettings); ok {
+		r0 = rf(user)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.NotificationSettings)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.User) error); ok {
+		r1 = rf(user)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindWebhookByID provides a mock function with given fields: id
+func (_m *ChatRepository) FindWebhookByID(id string) (model.Webhook, error) {
+	ret := _m.Called(id)
+
+	var r0 model.Webhook
+	if rf, ok := ret.Get(0).(func(string) model.Webhook); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(model.Webhook)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindWebhookFailures provides a mock function with given fields: chat, limit
+func (_m *ChatRepository) FindWebhookFailures(chat primitive.ObjectID, limit int64) ([]model.WebhookFailure, error) {
+	ret := _m.Called(chat, limit)
+
+	var r0 []model.WebhookFailure
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, int64) []model.WebhookFailure); ok {
+		r0 = rf(chat, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.WebhookFailure)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID, int64) error); ok {
+		r1 = rf(chat, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindWebhooks provides a mock function with given fields: chat
+func (_m *ChatRepository) FindWebhooks(chat primitive.ObjectID) ([]model.Webhook, error) {
+	ret := _m.Called(chat)
+
+	var r0 []model.Webhook
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) []model.Webhook); ok {
+		r0 = rf(chat)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID) error); ok {
+		r1 = rf(chat)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InsertChat provides a mock function with given fields: name, users, public, direct
+func (_m *ChatRepository) InsertChat(name string, users []model.User, public bool, direct bool) (string, error) {
+	ret := _m.Called(name, users, public, direct)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, []model.User, bool, bool) string); ok {
+		r0 = rf(name, users, public, direct)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, []model.User, bool, bool) error); ok {
+		r1 = rf(name, users, public, direct)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InsertChatDeletion provides a mock function with given fields: deletion
+func (_m *ChatRepository) InsertChatDeletion(deletion model.ChatDeletion) error {
+	ret := _m.Called(deletion)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.ChatDeletion) error); ok {
+		r0 = rf(deletion)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// InsertCommandCall provides a mock function with given fields: call
+func (_m *ChatRepository) InsertCommandCall(call model.CommandCall) (string, error) {
+	ret := _m.Called(call)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(string, []model.User) string); ok {
-		r0 = rf(name, users)
+	if rf, ok := ret.Get(0).(func(model.CommandCall) string); ok {
+		r0 = rf(call)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, []model.User) error); ok {
-		r1 = rf(name, users)
+	if rf, ok := ret.Get(1).(func(model.CommandCall) error); ok {
+		r1 = rf(call)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InsertIncomingWebhook provides a mock function with given fields: hook
+func (_m *ChatRepository) InsertIncomingWebhook(hook model.IncomingWebhook) (string, error) {
+	ret := _m.Called(hook)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(model.IncomingWebhook) string); ok {
+		r0 = rf(hook)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.IncomingWebhook) error); ok {
+		r1 = rf(hook)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InsertInvite provides a mock function with given fields: invite
+func (_m *ChatRepository) InsertInvite(invite model.Invite) (string, error) {
+	ret := _m.Called(invite)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(model.Invite) string); ok {
+		r0 = rf(invite)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Invite) error); ok {
+		r1 = rf(invite)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InsertWebhook provides a mock function with given fields: hook
+func (_m *ChatRepository) InsertWebhook(hook model.Webhook) (string, error) {
+	ret := _m.Called(hook)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(model.Webhook) string); ok {
+		r0 = rf(hook)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Webhook) error); ok {
+		r1 = rf(hook)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RemoveChatMember provides a mock function with given fields: chat, user
+func (_m *ChatRepository) RemoveChatMember(chat model.Chat, user model.User) error {
+	ret := _m.Called(chat, user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.Chat, model.User) error); ok {
+		r0 = rf(chat, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveUserFromChats provides a mock function with given fields: user
+func (_m *ChatRepository) RemoveUserFromChats(user primitive.ObjectID) error {
+	ret := _m.Called(user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) error); ok {
+		r0 = rf(user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeInvite provides a mock function with given fields: invite
+func (_m *ChatRepository) RevokeInvite(invite model.Invite) error {
+	ret := _m.Called(invite)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.Invite) error); ok {
+		r0 = rf(invite)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetArchived provides a mock function with given fields: chat, user, archived
+func (_m *ChatRepository) SetArchived(chat model.Chat, user model.User, archived bool) error {
+	ret := _m.Called(chat, user, archived)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.Chat, model.User, bool) error); ok {
+		r0 = rf(chat, user, archived)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateChat provides a mock function with given fields: chat
+func (_m *ChatRepository) UpdateChat(chat model.Chat) error {
+	ret := _m.Called(chat)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.Chat) error); ok {
+		r0 = rf(chat)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateChatDeletion provides a mock function with given fields: deletion
+func (_m *ChatRepository) UpdateChatDeletion(deletion model.ChatDeletion) error {
+	ret := _m.Called(deletion)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.ChatDeletion) error); ok {
+		r0 = rf(deletion)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpsertNotificationSettings provides a mock function with given fields: settings
+func (_m *ChatRepository) UpsertNotificationSettings(settings model.NotificationSettings) error {
+	ret := _m.Called(settings)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.NotificationSettings) error); ok {
+		r0 = rf(settings)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UseInvite provides a mock function with given fields: invite
+func (_m *ChatRepository) UseInvite(invite model.Invite) (model.Invite, error) {
+	ret := _m.Called(invite)
+
+	var r0 model.Invite
+	if rf, ok := ret.Get(0).(func(model.Invite) model.Invite); ok {
+		r0 = rf(invite)
+	} else {
+		r0 = ret.Get(0).(model.Invite)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Invite) error); ok {
+		r1 = rf(invite)
 	} else {
 		r1 = ret.Error(1)
 	}
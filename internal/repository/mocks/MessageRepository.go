@@ -3,8 +3,11 @@
 package mocks
 
 import (
+	time "time"
+
 	model "github.com/flaambe/avito/internal/model"
 	mock "github.com/stretchr/testify/mock"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // MessageRepository is an autogenerated mock type for the MessageRepository type
@@ -12,6 +15,295 @@ type MessageRepository struct {
 	mock.Mock
 }
 
+// AnonymizeUserMessages provides a mock function with given fields: user, limit
+func (_m *MessageRepository) AnonymizeUserMessages(user primitive.ObjectID, limit int64) (int64, error) {
+	ret := _m.Called(user, limit)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, int64) int64); ok {
+		r0 = rf(user, limit)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID, int64) error); ok {
+		r1 = rf(user, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ClaimScheduledMessage provides a mock function with given fields: id
+func (_m *MessageRepository) ClaimScheduledMessage(id primitive.ObjectID) (model.ScheduledMessage, error) {
+	ret := _m.Called(id)
+
+	var r0 model.ScheduledMessage
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) model.ScheduledMessage); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(model.ScheduledMessage)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteChatDrafts provides a mock function with given fields: chat
+func (_m *MessageRepository) DeleteChatDrafts(chat primitive.ObjectID) error {
+	ret := _m.Called(chat)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) error); ok {
+		r0 = rf(chat)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteChatMessagesBefore provides a mock function with given fields: chatID, before, limit
+func (_m *MessageRepository) DeleteChatMessagesBefore(chatID primitive.ObjectID, before time.Time, limit int64) (int64, error) {
+	ret := _m.Called(chatID, before, limit)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, time.Time, int64) int64); ok {
+		r0 = rf(chatID, before, limit)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID, time.Time, int64) error); ok {
+		r1 = rf(chatID, before, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteChatScheduledMessages provides a mock function with given fields: chat
+func (_m *MessageRepository) DeleteChatScheduledMessages(chat primitive.ObjectID) error {
+	ret := _m.Called(chat)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) error); ok {
+		r0 = rf(chat)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteDraft provides a mock function with given fields: chat, user
+func (_m *MessageRepository) DeleteDraft(chat model.Chat, user model.User) error {
+	ret := _m.Called(chat, user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.Chat, model.User) error); ok {
+		r0 = rf(chat, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteMessages provides a mock function with given fields: chatID, limit
+func (_m *MessageRepository) DeleteMessages(chatID primitive.ObjectID, limit int64) (int64, error) {
+	ret := _m.Called(chatID, limit)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, int64) int64); ok {
+		r0 = rf(chatID, limit)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID, int64) error); ok {
+		r1 = rf(chatID, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteMessagesBefore provides a mock function with given fields: before, exclude, limit
+func (_m *MessageRepository) DeleteMessagesBefore(before time.Time, exclude []primitive.ObjectID, limit int64) (int64, error) {
+	ret := _m.Called(before, exclude, limit)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(time.Time, []primitive.ObjectID, int64) int64); ok {
+		r0 = rf(before, exclude, limit)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Time, []primitive.ObjectID, int64) error); ok {
+		r1 = rf(before, exclude, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteUserDrafts provides a mock function with given fields: user
+func (_m *MessageRepository) DeleteUserDrafts(user primitive.ObjectID) error {
+	ret := _m.Called(user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) error); ok {
+		r0 = rf(user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUserMessages provides a mock function with given fields: user, limit
+func (_m *MessageRepository) DeleteUserMessages(user primitive.ObjectID, limit int64) (int64, error) {
+	ret := _m.Called(user, limit)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, int64) int64); ok {
+		r0 = rf(user, limit)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID, int64) error); ok {
+		r1 = rf(user, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteUserScheduledMessages provides a mock function with given fields: author
+func (_m *MessageRepository) DeleteUserScheduledMessages(author primitive.ObjectID) error {
+	ret := _m.Called(author)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) error); ok {
+		r0 = rf(author)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EachUserMessage provides a mock function with given fields: user, fn
+func (_m *MessageRepository) EachUserMessage(user primitive.ObjectID, fn func(model.Message) error) error {
+	ret := _m.Called(user, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, func(model.Message) error) error); ok {
+		r0 = rf(user, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EachVotedPoll provides a mock function with given fields: user, fn
+func (_m *MessageRepository) EachVotedPoll(user primitive.ObjectID, fn func(model.Message) error) error {
+	ret := _m.Called(user, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, func(model.Message) error) error); ok {
+		r0 = rf(user, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FindDraft provides a mock function with given fields: chat, user
+func (_m *MessageRepository) FindDraft(chat model.Chat, user model.User) (model.Draft, error) {
+	ret := _m.Called(chat, user)
+
+	var r0 model.Draft
+	if rf, ok := ret.Get(0).(func(model.Chat, model.User) model.Draft); ok {
+		r0 = rf(chat, user)
+	} else {
+		r0 = ret.Get(0).(model.Draft)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Chat, model.User) error); ok {
+		r1 = rf(chat, user)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindDueScheduledMessages provides a mock function with given fields: now, limit
+func (_m *MessageRepository) FindDueScheduledMessages(now time.Time, limit int64) ([]model.ScheduledMessage, error) {
+	ret := _m.Called(now, limit)
+
+	var r0 []model.ScheduledMessage
+	if rf, ok := ret.Get(0).(func(time.Time, int64) []model.ScheduledMessage); ok {
+		r0 = rf(now, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ScheduledMessage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Time, int64) error); ok {
+		r1 = rf(now, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindMessageByID provides a mock function with given fields: id
+func (_m *MessageRepository) FindMessageByID(id string) (model.Message, error) {
+	ret := _m.Called(id)
+
+	var r0 model.Message
+	if rf, ok := ret.Get(0).(func(string) model.Message); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(model.Message)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FindMessages provides a mock function with given fields: chat
 func (_m *MessageRepository) FindMessages(chat model.Chat) ([]model.Message, error) {
 	ret := _m.Called(chat)
@@ -35,20 +327,280 @@ func (_m *MessageRepository) FindMessages(chat model.Chat) ([]model.Message, err
 	return r0, r1
 }
 
-// InsertMessage provides a mock function with given fields: chat, user, text
-func (_m *MessageRepository) InsertMessage(chat model.Chat, user model.User, text string) (string, error) {
-	ret := _m.Called(chat, user, text)
+// FindScheduledMessage provides a mock function with given fields: id
+func (_m *MessageRepository) FindScheduledMessage(id string) (model.ScheduledMessage, error) {
+	ret := _m.Called(id)
+
+	var r0 model.ScheduledMessage
+	if rf, ok := ret.Get(0).(func(string) model.ScheduledMessage); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(model.ScheduledMessage)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindScheduledMessages provides a mock function with given fields: author
+func (_m *MessageRepository) FindScheduledMessages(author primitive.ObjectID) ([]model.ScheduledMessage, error) {
+	ret := _m.Called(author)
+
+	var r0 []model.ScheduledMessage
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) []model.ScheduledMessage); ok {
+		r0 = rf(author)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ScheduledMessage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID) error); ok {
+		r1 = rf(author)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindUserDrafts provides a mock function with given fields: user
+func (_m *MessageRepository) FindUserDrafts(user primitive.ObjectID) ([]model.Draft, error) {
+	ret := _m.Called(user)
+
+	var r0 []model.Draft
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) []model.Draft); ok {
+		r0 = rf(user)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Draft)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID) error); ok {
+		r1 = rf(user)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindUserSystemMessages provides a mock function with given fields: user, limit
+func (_m *MessageRepository) FindUserSystemMessages(user primitive.ObjectID, limit int64) ([]model.Message, error) {
+	ret := _m.Called(user, limit)
+
+	var r0 []model.Message
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, int64) []model.Message); ok {
+		r0 = rf(user, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Message)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID, int64) error); ok {
+		r1 = rf(user, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FinishScheduledMessage provides a mock function with given fields: message
+func (_m *MessageRepository) FinishScheduledMessage(message model.ScheduledMessage) error {
+	ret := _m.Called(message)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.ScheduledMessage) error); ok {
+		r0 = rf(message)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// InsertMessage provides a mock function with given fields: message
+func (_m *MessageRepository) InsertMessage(message model.Message) (string, error) {
+	ret := _m.Called(message)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(model.Message) string); ok {
+		r0 = rf(message)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Message) error); ok {
+		r1 = rf(message)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InsertMessages provides a mock function with given fields: messages
+func (_m *MessageRepository) InsertMessages(messages []model.Message) ([]string, error) {
+	ret := _m.Called(messages)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func([]model.Message) []string); ok {
+		r0 = rf(messages)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]model.Message) error); ok {
+		r1 = rf(messages)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InsertScheduledMessage provides a mock function with given fields: message
+func (_m *MessageRepository) InsertScheduledMessage(message model.ScheduledMessage) (string, error) {
+	ret := _m.Called(message)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(model.Chat, model.User, string) string); ok {
-		r0 = rf(chat, user, text)
+	if rf, ok := ret.Get(0).(func(model.ScheduledMessage) string); ok {
+		r0 = rf(message)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(model.Chat, model.User, string) error); ok {
-		r1 = rf(chat, user, text)
+	if rf, ok := ret.Get(1).(func(model.ScheduledMessage) error); ok {
+		r1 = rf(message)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RemoveUserVotes provides a mock function with given fields: user
+func (_m *MessageRepository) RemoveUserVotes(user primitive.ObjectID) error {
+	ret := _m.Called(user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) error); ok {
+		r0 = rf(user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetPreviews provides a mock function with given fields: id, previews
+func (_m *MessageRepository) SetPreviews(id primitive.ObjectID, previews []model.Preview) error {
+	ret := _m.Called(id, previews)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, []model.Preview) error); ok {
+		r0 = rf(id, previews)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UnvotePoll provides a mock function with given fields: id, user, choices
+func (_m *MessageRepository) UnvotePoll(id primitive.ObjectID, user primitive.ObjectID, choices []int) (model.Message, error) {
+	ret := _m.Called(id, user, choices)
+
+	var r0 model.Message
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, primitive.ObjectID, []int) model.Message); ok {
+		r0 = rf(id, user, choices)
+	} else {
+		r0 = ret.Get(0).(model.Message)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID, primitive.ObjectID, []int) error); ok {
+		r1 = rf(id, user, choices)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateScheduledMessage provides a mock function with given fields: message
+func (_m *MessageRepository) UpdateScheduledMessage(message model.ScheduledMessage) error {
+	ret := _m.Called(message)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.ScheduledMessage) error); ok {
+		r0 = rf(message)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateSystemMessage provides a mock function with given fields: message
+func (_m *MessageRepository) UpdateSystemMessage(message model.Message) error {
+	ret := _m.Called(message)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.Message) error); ok {
+		r0 = rf(message)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpsertDraft provides a mock function with given fields: draft
+func (_m *MessageRepository) UpsertDraft(draft model.Draft) error {
+	ret := _m.Called(draft)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.Draft) error); ok {
+		r0 = rf(draft)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// VotePoll provides a mock function with given fields: id, user, choices, single
+func (_m *MessageRepository) VotePoll(id primitive.ObjectID, user primitive.ObjectID, choices []int, single bool) (model.Message, error) {
+	ret := _m.Called(id, user, choices, single)
+
+	var r0 model.Message
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, primitive.ObjectID, []int, bool) model.Message); ok {
+		r0 = rf(id, user, choices, single)
+	} else {
+		r0 = ret.Get(0).(model.Message)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID, primitive.ObjectID, []int, bool) error); ok {
+		r1 = rf(id, user, choices, single)
 	} else {
 		r1 = ret.Error(1)
 	}
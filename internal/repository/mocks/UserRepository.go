@@ -5,6 +5,7 @@ package mocks
 import (
 	model "github.com/flaambe/avito/internal/model"
 	mock "github.com/stretchr/testify/mock"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // UserRepository is an autogenerated mock type for the UserRepository type
@@ -12,6 +13,219 @@ type UserRepository struct {
 	mock.Mock
 }
 
+// BlockUser provides a mock function with given fields: user, blocked
+func (_m *UserRepository) BlockUser(user model.User, blocked model.User) error {
+	ret := _m.Called(user, blocked)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.User, model.User) error); ok {
+		r0 = rf(user, blocked)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeactivateUser provides a mock function with given fields: user
+func (_m *UserRepository) DeactivateUser(user model.User) error {
+	ret := _m.Called(user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.User) error); ok {
+		r0 = rf(user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteAPIKey provides a mock function with given fields: bot, id
+func (_m *UserRepository) DeleteAPIKey(bot primitive.ObjectID, id string) error {
+	ret := _m.Called(bot, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, string) error); ok {
+		r0 = rf(bot, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteAPIKeys provides a mock function with given fields: bot
+func (_m *UserRepository) DeleteAPIKeys(bot primitive.ObjectID) error {
+	ret := _m.Called(bot)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) error); ok {
+		r0 = rf(bot)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FindAPIKeyByHash provides a mock function with given fields: hash
+func (_m *UserRepository) FindAPIKeyByHash(hash string) (model.APIKey, error) {
+	ret := _m.Called(hash)
+
+	var r0 model.APIKey
+	if rf, ok := ret.Get(0).(func(string) model.APIKey); ok {
+		r0 = rf(hash)
+	} else {
+		r0 = ret.Get(0).(model.APIKey)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(hash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindAPIKeys provides a mock function with given fields: bot
+func (_m *UserRepository) FindAPIKeys(bot primitive.ObjectID) ([]model.APIKey, error) {
+	ret := _m.Called(bot)
+
+	var r0 []model.APIKey
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) []model.APIKey); ok {
+		r0 = rf(bot)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.APIKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID) error); ok {
+		r1 = rf(bot)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindBlockedBy provides a mock function with given fields: user
+func (_m *UserRepository) FindBlockedBy(user model.User) ([]model.Block, error) {
+	ret := _m.Called(user)
+
+	var r0 []model.Block
+	if rf, ok := ret.Get(0).(func(model.User) []model.Block); ok {
+		r0 = rf(user)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Block)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.User) error); ok {
+		r1 = rf(user)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindBlocks provides a mock function with given fields: user
+func (_m *UserRepository) FindBlocks(user model.User) ([]model.Block, error) {
+	ret := _m.Called(user)
+
+	var r0 []model.Block
+	if rf, ok := ret.Get(0).(func(model.User) []model.Block); ok {
+		r0 = rf(user)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Block)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.User) error); ok {
+		r1 = rf(user)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindErasureJob provides a mock function with given fields: id
+func (_m *UserRepository) FindErasureJob(id string) (model.ErasureJob, error) {
+	ret := _m.Called(id)
+
+	var r0 model.ErasureJob
+	if rf, ok := ret.Get(0).(func(string) model.ErasureJob); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Get(0).(model.ErasureJob)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindOwnedBots provides a mock function with given fields: owner
+func (_m *UserRepository) FindOwnedBots(owner primitive.ObjectID) ([]model.User, error) {
+	ret := _m.Called(owner)
+
+	var r0 []model.User
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID) []model.User); ok {
+		r0 = rf(owner)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(primitive.ObjectID) error); ok {
+		r1 = rf(owner)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindPendingErasureJobs provides a mock function with given fields:
+func (_m *UserRepository) FindPendingErasureJobs() ([]model.ErasureJob, error) {
+	ret := _m.Called()
+
+	var r0 []model.ErasureJob
+	if rf, ok := ret.Get(0).(func() []model.ErasureJob); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ErasureJob)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FindUserByID provides a mock function with given fields: id
 func (_m *UserRepository) FindUserByID(id string) (model.User, error) {
 	ret := _m.Called(id)
@@ -33,6 +247,99 @@ func (_m *UserRepository) FindUserByID(id string) (model.User, error) {
 	return r0, r1
 }
 
+// FindUsersByIDs provides a mock function with given fields: ids
+func (_m *UserRepository) FindUsersByIDs(ids []primitive.ObjectID) ([]model.User, error) {
+	ret := _m.Called(ids)
+
+	var r0 []model.User
+	if rf, ok := ret.Get(0).(func([]primitive.ObjectID) []model.User); ok {
+		r0 = rf(ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]primitive.ObjectID) error); ok {
+		r1 = rf(ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InsertAPIKey provides a mock function with given fields: key
+func (_m *UserRepository) InsertAPIKey(key model.APIKey) (string, error) {
+	ret := _m.Called(key)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(model.APIKey) string); ok {
+		r0 = rf(key)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.APIKey) error); ok {
+		r1 = rf(key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InsertAuditRecord provides a mock function with given fields: record
+func (_m *UserRepository) InsertAuditRecord(record model.AuditRecord) error {
+	ret := _m.Called(record)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.AuditRecord) error); ok {
+		r0 = rf(record)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// InsertBot provides a mock function with given fields: bot
+func (_m *UserRepository) InsertBot(bot model.User) (string, error) {
+	ret := _m.Called(bot)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(model.User) string); ok {
+		r0 = rf(bot)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.User) error); ok {
+		r1 = rf(bot)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InsertErasureJob provides a mock function with given fields: job
+func (_m *UserRepository) InsertErasureJob(job model.ErasureJob) error {
+	ret := _m.Called(job)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.ErasureJob) error); ok {
+		r0 = rf(job)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // InsertUser provides a mock function with given fields: name
 func (_m *UserRepository) InsertUser(name string) (string, error) {
 	ret := _m.Called(name)
@@ -53,3 +360,103 @@ func (_m *UserRepository) InsertUser(name string) (string, error) {
 
 	return r0, r1
 }
+
+// IsBlocked provides a mock function with given fields: user, other
+func (_m *UserRepository) IsBlocked(user model.User, other model.User) (bool, error) {
+	ret := _m.Called(user, other)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(model.User, model.User) bool); ok {
+		r0 = rf(user, other)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.User, model.User) error); ok {
+		r1 = rf(user, other)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SearchUsers provides a mock function with given fields: prefix, limit
+func (_m *UserRepository) SearchUsers(prefix string, limit int64) ([]model.User, error) {
+	ret := _m.Called(prefix, limit)
+
+	var r0 []model.User
+	if rf, ok := ret.Get(0).(func(string, int64) []model.User); ok {
+		r0 = rf(prefix, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int64) error); ok {
+		r1 = rf(prefix, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetBotCommands provides a mock function with given fields: bot, commands
+func (_m *UserRepository) SetBotCommands(bot primitive.ObjectID, commands []model.Command) error {
+	ret := _m.Called(bot, commands)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(primitive.ObjectID, []model.Command) error); ok {
+		r0 = rf(bot, commands)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UnblockUser provides a mock function with given fields: user, blocked
+func (_m *UserRepository) UnblockUser(user model.User, blocked model.User) error {
+	ret := _m.Called(user, blocked)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.User, model.User) error); ok {
+		r0 = rf(user, blocked)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateErasureJob provides a mock function with given fields: job
+func (_m *UserRepository) UpdateErasureJob(job model.ErasureJob) error {
+	ret := _m.Called(job)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.ErasureJob) error); ok {
+		r0 = rf(job)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateUser provides a mock function with given fields: user
+func (_m *UserRepository) UpdateUser(user model.User) error {
+	ret := _m.Called(user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(model.User) error); ok {
+		r0 = rf(user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -2,6 +2,10 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -9,8 +13,12 @@ import (
 	"github.com/flaambe/avito/internal/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// webhookFailureTTL is how long dead letters are kept, in seconds.
+const webhookFailureTTL = 30 * 24 * 60 * 60
+
 type UserRepository struct {
 	Db *mongo.Database
 }
@@ -23,6 +31,11 @@ type MessageRepository struct {
 	Db *mongo.Database
 }
 
+// PresenceRepository shares presence between the instances of a cluster.
+type PresenceRepository struct {
+	Db *mongo.Database
+}
+
 func NewUserRepository(db *mongo.Database) *UserRepository {
 	return &UserRepository{db}
 }
@@ -35,6 +48,10 @@ func NewMessageRepository(db *mongo.Database) *MessageRepository {
 	return &MessageRepository{db}
 }
 
+func NewPresenceRepository(db *mongo.Database) *PresenceRepository {
+	return &PresenceRepository{db}
+}
+
 // User
 func (u *UserRepository) FindUserByID(id string) (model.User, error) {
 	user := model.User{}
@@ -43,7 +60,7 @@ func (u *UserRepository) FindUserByID(id string) (model.User, error) {
 		return model.User{}, err
 	}
 
-	err = u.Db.Collection("users").FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&user)
+	err = u.Db.Collection("users").FindOne(context.TODO(), bson.M{"_id": userID, "deactivated": bson.M{"$ne": true}}).Decode(&user)
 	if err != nil {
 		return model.User{}, err
 	}
@@ -51,8 +68,143 @@ func (u *UserRepository) FindUserByID(id string) (model.User, error) {
 	return user, nil
 }
 
+// EnsureIndexes backfills the lowercased usernames of users created before
+// they were stored and makes them unique, renaming the users that took a
+// username differing in case only. Block lists are indexed per user and API
+// keys by their hash.
+func (u *UserRepository) EnsureIndexes() error {
+	filter := bson.M{"username_lower": bson.M{"$exists": false}}
+	backfill := bson.A{bson.M{"$set": bson.M{"username_lower": bson.M{"$toLower": "$username"}}}}
+	_, err := u.Db.Collection("users").UpdateMany(context.TODO(), filter, backfill)
+	if err != nil {
+		return err
+	}
+
+	if err := u.renameDuplicateUserNames(); err != nil {
+		return err
+	}
+
+	index := mongo.IndexModel{
+		Keys: bson.M{"username_lower": 1},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"username_lower": bson.M{"$exists": true}}),
+	}
+	_, err = u.Db.Collection("users").Indexes().CreateOne(context.TODO(), index)
+	if err != nil {
+		return err
+	}
+
+	blocks := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user", Value: 1}, {Key: "blocked", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"blocked": 1}},
+	}
+	_, err = u.Db.Collection("blocks").Indexes().CreateMany(context.TODO(), blocks)
+	if err != nil {
+		return err
+	}
+
+	keys := []mongo.IndexModel{
+		{Keys: bson.M{"hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"bot": 1}},
+	}
+	_, err = u.Db.Collection("api_keys").Indexes().CreateMany(context.TODO(), keys)
+
+	return err
+}
+
+// renameDuplicateUserNames keeps the username of the oldest user of each
+// case-insensitive duplicate and renames the others after their ID. The
+// renames are logged so that the users can be told.
+func (u *UserRepository) renameDuplicateUserNames() error {
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"username_lower": bson.M{"$exists": true}}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+		bson.M{"$group": bson.M{
+			"_id":   "$username_lower",
+			"users": bson.M{"$push": bson.M{"_id": "$_id", "username": "$username"}},
+			"count": bson.M{"$sum": 1},
+		}},
+		bson.M{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	}
+	cur, err := u.Db.Collection("users").Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return err
+	}
+
+	var duplicates []struct {
+		Users []model.User `bson:"users"`
+	}
+	if err := cur.All(context.TODO(), &duplicates); err != nil {
+		return err
+	}
+
+	for _, duplicate := range duplicates {
+		for _, user := range duplicate.Users[1:] {
+			name, err := u.freeUserName(user)
+			if err != nil {
+				return err
+			}
+
+			update := bson.M{"$set": bson.M{"username": name, "username_lower": strings.ToLower(name)}}
+			_, err = u.Db.Collection("users").UpdateOne(context.TODO(), bson.M{"_id": user.ID}, update)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("renamed user %s from %s to %s, the username was taken", user.ID.Hex(), user.UserName, name)
+		}
+	}
+
+	return nil
+}
+
+// freeUserName suffixes the username with the end of the user ID, keeping it
+// within 32 characters, and falls back to the whole ID when that is taken.
+func (u *UserRepository) freeUserName(user model.User) (string, error) {
+	id := user.ID.Hex()
+	name := user.UserName
+	if len(name) > 25 {
+		name = name[:25]
+	}
+	name += "_" + id[len(id)-6:]
+
+	taken, err := u.Db.Collection("users").CountDocuments(context.TODO(), bson.M{"username_lower": strings.ToLower(name)})
+	if err != nil {
+		return "", err
+	}
+
+	if taken > 0 {
+		return "user_" + id, nil
+	}
+
+	return name, nil
+}
+
 func (u *UserRepository) InsertUser(name string) (string, error) {
-	result, err := u.Db.Collection("users").InsertOne(context.TODO(), bson.M{"username": name})
+	user := bson.M{"username": name, "username_lower": strings.ToLower(name)}
+	result, err := u.Db.Collection("users").InsertOne(context.TODO(), user)
+	if err != nil {
+		return "", err
+	}
+
+	oid, _ := result.InsertedID.(primitive.ObjectID)
+
+	return oid.Hex(), nil
+}
+
+// InsertBot creates a bot account. Bots share the namespace of usernames.
+func (u *UserRepository) InsertBot(bot model.User) (string, error) {
+	user := bson.M{
+		"username":       bot.UserName,
+		"username_lower": strings.ToLower(bot.UserName),
+		"display_name":   bot.DisplayName,
+		"bot":            true,
+	}
+	if !bot.Owner.IsZero() {
+		user["owner"] = bot.Owner
+	}
+	result, err := u.Db.Collection("users").InsertOne(context.TODO(), user)
 	if err != nil {
 		return "", err
 	}
@@ -62,6 +214,300 @@ func (u *UserRepository) InsertUser(name string) (string, error) {
 	return oid.Hex(), nil
 }
 
+func (u *UserRepository) InsertAPIKey(key model.APIKey) (string, error) {
+	result, err := u.Db.Collection("api_keys").InsertOne(context.TODO(), key)
+	if err != nil {
+		return "-1", err
+	}
+
+	oid, _ := result.InsertedID.(primitive.ObjectID)
+
+	return oid.Hex(), nil
+}
+
+func (u *UserRepository) FindAPIKeyByHash(hash string) (model.APIKey, error) {
+	key := model.APIKey{}
+
+	err := u.Db.Collection("api_keys").FindOne(context.TODO(), bson.M{"hash": hash}).Decode(&key)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+func (u *UserRepository) FindAPIKeys(bot primitive.ObjectID) ([]model.APIKey, error) {
+	keys := []model.APIKey{}
+
+	cur, err := u.Db.Collection("api_keys").Find(context.TODO(), bson.M{"bot": bot})
+	if err != nil {
+		return []model.APIKey{}, err
+	}
+
+	err = cur.All(context.TODO(), &keys)
+	if err != nil {
+		return []model.APIKey{}, err
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey deletes the key of the bot. It returns mongo.ErrNoDocuments
+// when the bot has no such key.
+func (u *UserRepository) DeleteAPIKey(bot primitive.ObjectID, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := u.Db.Collection("api_keys").DeleteOne(context.TODO(), bson.M{"_id": oid, "bot": bot})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// DeleteAPIKeys deletes every key of the bot.
+func (u *UserRepository) DeleteAPIKeys(bot primitive.ObjectID) error {
+	_, err := u.Db.Collection("api_keys").DeleteMany(context.TODO(), bson.M{"bot": bot})
+
+	return err
+}
+
+func (u *UserRepository) FindUsersByIDs(ids []primitive.ObjectID) ([]model.User, error) {
+	users := []model.User{}
+
+	cur, err := u.Db.Collection("users").Find(context.TODO(), bson.M{"_id": bson.M{"$in": ids}, "deactivated": bson.M{"$ne": true}})
+	if err != nil {
+		return []model.User{}, err
+	}
+
+	err = cur.All(context.TODO(), &users)
+	if err != nil {
+		return []model.User{}, err
+	}
+
+	return users, nil
+}
+
+// FindOwnedBots returns the bots of the owner, deactivated ones included.
+func (u *UserRepository) FindOwnedBots(owner primitive.ObjectID) ([]model.User, error) {
+	bots := []model.User{}
+
+	cur, err := u.Db.Collection("users").Find(context.TODO(), bson.M{"owner": owner, "bot": true})
+	if err != nil {
+		return bots, err
+	}
+
+	err = cur.All(context.TODO(), &bots)
+
+	return bots, err
+}
+
+// SearchUsers finds users whose username starts with prefix, ignoring case.
+func (u *UserRepository) SearchUsers(prefix string, limit int64) ([]model.User, error) {
+	users := []model.User{}
+
+	filter := bson.M{
+		"username_lower": bson.M{"$regex": "^" + regexp.QuoteMeta(strings.ToLower(prefix))},
+		"deactivated":    bson.M{"$ne": true},
+	}
+	opts := options.Find().SetSort(bson.M{"username_lower": 1}).SetLimit(limit)
+
+	cur, err := u.Db.Collection("users").Find(context.TODO(), filter, opts)
+	if err != nil {
+		return []model.User{}, err
+	}
+
+	err = cur.All(context.TODO(), &users)
+	if err != nil {
+		return []model.User{}, err
+	}
+
+	return users, nil
+}
+
+func (u *UserRepository) UpdateUser(user model.User) error {
+	update := bson.M{"$set": bson.M{
+		"display_name": user.DisplayName,
+		"avatar":       user.Avatar,
+		"bio":          user.Bio,
+		"status":       user.Status,
+	}}
+
+	_, err := u.Db.Collection("users").UpdateOne(context.TODO(), bson.M{"_id": user.ID}, update)
+
+	return err
+}
+
+// SetBotCommands replaces the slash commands served by the bot.
+func (u *UserRepository) SetBotCommands(bot primitive.ObjectID, commands []model.Command) error {
+	_, err := u.Db.Collection("users").UpdateOne(context.TODO(), bson.M{"_id": bot, "bot": true}, bson.M{"$set": bson.M{"commands": commands}})
+
+	return err
+}
+
+// DeactivateUser hides the user from every lookup, replaces the username with
+// one that cannot be registered, clears the profile and drops their blocks.
+func (u *UserRepository) DeactivateUser(user model.User) error {
+	name := "_deleted_" + user.ID.Hex()
+	update := bson.M{
+		"$set": bson.M{
+			"deactivated":    true,
+			"username":       name,
+			"username_lower": name,
+		},
+		"$unset": bson.M{
+			"display_name": "",
+			"avatar":       "",
+			"bio":          "",
+			"status":       "",
+		},
+	}
+
+	_, err := u.Db.Collection("users").UpdateOne(context.TODO(), bson.M{"_id": user.ID}, update)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"$or": bson.A{bson.M{"user": user.ID}, bson.M{"blocked": user.ID}}}
+	_, err = u.Db.Collection("blocks").DeleteMany(context.TODO(), filter)
+
+	return err
+}
+
+// Erasure
+func (u *UserRepository) InsertErasureJob(job model.ErasureJob) error {
+	opts := options.Update().SetUpsert(true)
+	update := bson.M{"$setOnInsert": job}
+
+	_, err := u.Db.Collection("erasure_jobs").UpdateOne(context.TODO(), bson.M{"_id": job.ID}, update, opts)
+
+	return err
+}
+
+func (u *UserRepository) FindErasureJob(id string) (model.ErasureJob, error) {
+	job := model.ErasureJob{}
+
+	userID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.ErasureJob{}, err
+	}
+
+	err = u.Db.Collection("erasure_jobs").FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&job)
+	if err != nil {
+		return model.ErasureJob{}, err
+	}
+
+	return job, nil
+}
+
+func (u *UserRepository) FindPendingErasureJobs() ([]model.ErasureJob, error) {
+	jobs := []model.ErasureJob{}
+
+	filter := bson.M{"stage": bson.M{"$ne": model.ErasureStageDone}}
+	cur, err := u.Db.Collection("erasure_jobs").Find(context.TODO(), filter)
+	if err != nil {
+		return []model.ErasureJob{}, err
+	}
+
+	err = cur.All(context.TODO(), &jobs)
+	if err != nil {
+		return []model.ErasureJob{}, err
+	}
+
+	return jobs, nil
+}
+
+func (u *UserRepository) UpdateErasureJob(job model.ErasureJob) error {
+	update := bson.M{"$set": bson.M{
+		"stage":       job.Stage,
+		"messages":    job.Messages,
+		"finished_at": job.FinishedAt,
+	}}
+
+	_, err := u.Db.Collection("erasure_jobs").UpdateOne(context.TODO(), bson.M{"_id": job.ID}, update)
+
+	return err
+}
+
+func (u *UserRepository) InsertAuditRecord(record model.AuditRecord) error {
+	_, err := u.Db.Collection("audit_log").InsertOne(context.TODO(), record)
+
+	return err
+}
+
+// Block
+func (u *UserRepository) BlockUser(user model.User, blocked model.User) error {
+	opts := options.Update().SetUpsert(true)
+	filter := bson.M{"user": user.ID, "blocked": blocked.ID}
+	update := bson.M{"$setOnInsert": bson.M{"created_at": primitive.NewDateTimeFromTime(time.Now())}}
+
+	_, err := u.Db.Collection("blocks").UpdateOne(context.TODO(), filter, update, opts)
+
+	return err
+}
+
+func (u *UserRepository) UnblockUser(user model.User, blocked model.User) error {
+	filter := bson.M{"user": user.ID, "blocked": blocked.ID}
+	_, err := u.Db.Collection("blocks").DeleteOne(context.TODO(), filter)
+
+	return err
+}
+
+func (u *UserRepository) FindBlocks(user model.User) ([]model.Block, error) {
+	blocks := []model.Block{}
+
+	cur, err := u.Db.Collection("blocks").Find(context.TODO(), bson.M{"user": user.ID})
+	if err != nil {
+		return []model.Block{}, err
+	}
+
+	err = cur.All(context.TODO(), &blocks)
+	if err != nil {
+		return []model.Block{}, err
+	}
+
+	return blocks, nil
+}
+
+// FindBlockedBy returns the blocks other users put on the user.
+func (u *UserRepository) FindBlockedBy(user model.User) ([]model.Block, error) {
+	blocks := []model.Block{}
+
+	cur, err := u.Db.Collection("blocks").Find(context.TODO(), bson.M{"blocked": user.ID})
+	if err != nil {
+		return []model.Block{}, err
+	}
+
+	err = cur.All(context.TODO(), &blocks)
+	if err != nil {
+		return []model.Block{}, err
+	}
+
+	return blocks, nil
+}
+
+// IsBlocked reports whether either of the users blocked the other.
+func (u *UserRepository) IsBlocked(user model.User, other model.User) (bool, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"user": user.ID, "blocked": other.ID},
+		bson.M{"user": other.ID, "blocked": user.ID},
+	}}
+
+	count, err := u.Db.Collection("blocks").CountDocuments(context.TODO(), filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
 // Chat
 func (c *ChatRepository) FindChatByID(id string) (model.Chat, error) {
 	chat := model.Chat{}
@@ -82,7 +528,7 @@ func (c *ChatRepository) FindChatByID(id string) (model.Chat, error) {
 func (c *ChatRepository) FindChats(user model.User) ([]model.Chat, error) {
 	chats := []model.Chat{}
 
-	cur, err := c.Db.Collection("chats").Find(context.TODO(), bson.M{"users": user})
+	cur, err := c.Db.Collection("chats").Find(context.TODO(), bson.M{"users._id": user.ID})
 	if err != nil {
 		return []model.Chat{}, err
 	}
@@ -95,12 +541,39 @@ func (c *ChatRepository) FindChats(user model.User) ([]model.Chat, error) {
 	return chats, nil
 }
 
-func (c *ChatRepository) InsertChat(name string, users []model.User) (string, error) {
+// EachChat calls fn for every chat of the user, one document at a time.
+func (c *ChatRepository) EachChat(user model.User, fn func(model.Chat) error) error {
+	cur, err := c.Db.Collection("chats").Find(context.TODO(), bson.M{"users._id": user.ID})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+		chat := model.Chat{}
+		if err := cur.Decode(&chat); err != nil {
+			return err
+		}
+
+		if err := fn(chat); err != nil {
+			return err
+		}
+	}
+
+	return cur.Err()
+}
+
+func (c *ChatRepository) InsertChat(name string, users []model.User, public bool, direct bool) (string, error) {
 	chat := model.Chat{
 		Name:      name,
 		Users:     users,
+		Public:    public,
+		Direct:    direct,
 		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
 	}
+	if len(users) > 0 {
+		chat.Owner = users[0].ID
+	}
 	result, err := c.Db.Collection("chats").InsertOne(context.TODO(), chat)
 	if err != nil {
 		return "-1", err
@@ -111,36 +584,1215 @@ func (c *ChatRepository) InsertChat(name string, users []model.User) (string, er
 	return oid.Hex(), nil
 }
 
-// Message
-func (m *MessageRepository) InsertMessage(chat model.Chat, user model.User, text string) (string, error) {
-	message := model.Message{
-		Chat:      chat.ID,
-		Author:    user.ID,
-		Text:      text,
-		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+func (c *ChatRepository) UpdateChat(chat model.Chat) error {
+	update := bson.M{"$set": bson.M{
+		"name":           chat.Name,
+		"description":    chat.Description,
+		"avatar":         chat.Avatar,
+		"public":         chat.Public,
+		"retention_days": chat.RetentionDays,
+	}}
+
+	_, err := c.Db.Collection("chats").UpdateOne(context.TODO(), bson.M{"_id": chat.ID}, update)
+
+	return err
+}
+
+func (c *ChatRepository) SetArchived(chat model.Chat, user model.User, archived bool) error {
+	operator := "$addToSet"
+	if !archived {
+		operator = "$pull"
 	}
-	result, err := m.Db.Collection("messages").InsertOne(context.TODO(), message)
+
+	update := bson.M{operator: bson.M{"archived": user.ID}}
+	_, err := c.Db.Collection("chats").UpdateOne(context.TODO(), bson.M{"_id": chat.ID}, update)
+
+	return err
+}
+
+// FindChatsWithRetention returns the chats that override the global message
+// retention, without their members.
+func (c *ChatRepository) FindChatsWithRetention() ([]model.Chat, error) {
+	chats := []model.Chat{}
+
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "retention_days": 1})
+	cur, err := c.Db.Collection("chats").Find(context.TODO(), bson.M{"retention_days": bson.M{"$gt": 0}}, opts)
 	if err != nil {
-		return "-1", err
+		return chats, err
 	}
 
-	oid, _ := result.InsertedID.(primitive.ObjectID)
+	err = cur.All(context.TODO(), &chats)
 
-	return oid.Hex(), nil
+	return chats, err
 }
 
-func (m *MessageRepository) FindMessages(chat model.Chat) ([]model.Message, error) {
-	messages := []model.Message{}
+// FindPublicChats returns public chats whose name contains query, ignoring
+// case, together with their member counts.
+func (c *ChatRepository) FindPublicChats(query string, limit int64) ([]model.ChatSummary, error) {
+	chats := []model.ChatSummary{}
 
-	cur, err := m.Db.Collection("messages").Find(context.TODO(), bson.M{"chat": chat.ID})
+	match := bson.M{"public": true}
+	if query != "" {
+		match["name"] = bson.M{"$regex": regexp.QuoteMeta(query), "$options": "i"}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.M{"name": 1}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$project", Value: bson.M{
+			"name":        1,
+			"description": 1,
+			"avatar":      1,
+			"created_at":  1,
+			"members":     bson.M{"$size": "$users"},
+		}}},
+	}
+
+	cur, err := c.Db.Collection("chats").Aggregate(context.TODO(), pipeline)
 	if err != nil {
-		return []model.Message{}, err
+		return []model.ChatSummary{}, err
 	}
 
-	err = cur.All(context.TODO(), &messages)
+	err = cur.All(context.TODO(), &chats)
 	if err != nil {
-		return []model.Message{}, err
+		return []model.ChatSummary{}, err
 	}
 
-	return messages, nil
+	return chats, nil
+}
+
+// AddChatMember adds the user to the chat unless they are already a member.
+func (c *ChatRepository) AddChatMember(chat model.Chat, user model.User) error {
+	filter := bson.M{"_id": chat.ID, "users._id": bson.M{"$ne": user.ID}}
+	update := bson.M{"$push": bson.M{"users": user}}
+
+	_, err := c.Db.Collection("chats").UpdateOne(context.TODO(), filter, update)
+
+	return err
+}
+
+// RemoveChatMember takes the user out of the chat, including their archive
+// flag.
+func (c *ChatRepository) RemoveChatMember(chat model.Chat, user model.User) error {
+	update := bson.M{"$pull": bson.M{
+		"users":    bson.M{"_id": user.ID},
+		"archived": user.ID,
+	}}
+
+	_, err := c.Db.Collection("chats").UpdateOne(context.TODO(), bson.M{"_id": chat.ID}, update)
+
+	return err
+}
+
+// RemoveUserFromChats takes the user out of every chat, including their
+// archive flags and notification settings. The chats the user owned fall
+// back to their first remaining member as the owner.
+func (c *ChatRepository) RemoveUserFromChats(user primitive.ObjectID) error {
+	update := bson.M{"$pull": bson.M{
+		"users":    bson.M{"_id": user},
+		"archived": user,
+	}}
+
+	_, err := c.Db.Collection("chats").UpdateMany(context.TODO(), bson.M{"users._id": user}, update)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Db.Collection("chats").UpdateMany(context.TODO(), bson.M{"owner": user}, bson.M{"$unset": bson.M{"owner": ""}})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Db.Collection("notification_settings").DeleteMany(context.TODO(), bson.M{"user": user})
+
+	return err
+}
+
+func (c *ChatRepository) DeleteChat(chat model.Chat) error {
+	_, err := c.Db.Collection("chats").DeleteOne(context.TODO(), bson.M{"_id": chat.ID})
+
+	return err
+}
+
+// Chat deletion
+func (c *ChatRepository) InsertChatDeletion(deletion model.ChatDeletion) error {
+	opts := options.Update().SetUpsert(true)
+	update := bson.M{"$setOnInsert": deletion}
+
+	_, err := c.Db.Collection("chat_deletions").UpdateOne(context.TODO(), bson.M{"_id": deletion.ID}, update, opts)
+
+	return err
+}
+
+func (c *ChatRepository) FindChatDeletion(id string) (model.ChatDeletion, error) {
+	deletion := model.ChatDeletion{}
+
+	chatID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.ChatDeletion{}, err
+	}
+
+	err = c.Db.Collection("chat_deletions").FindOne(context.TODO(), bson.M{"_id": chatID}).Decode(&deletion)
+	if err != nil {
+		return model.ChatDeletion{}, err
+	}
+
+	return deletion, nil
+}
+
+func (c *ChatRepository) FindPendingChatDeletions() ([]model.ChatDeletion, error) {
+	deletions := []model.ChatDeletion{}
+
+	cur, err := c.Db.Collection("chat_deletions").Find(context.TODO(), bson.M{"done": false})
+	if err != nil {
+		return []model.ChatDeletion{}, err
+	}
+
+	err = cur.All(context.TODO(), &deletions)
+	if err != nil {
+		return []model.ChatDeletion{}, err
+	}
+
+	return deletions, nil
+}
+
+func (c *ChatRepository) UpdateChatDeletion(deletion model.ChatDeletion) error {
+	update := bson.M{"$set": bson.M{
+		"deleted":     deletion.Deleted,
+		"done":        deletion.Done,
+		"finished_at": deletion.FinishedAt,
+	}}
+
+	_, err := c.Db.Collection("chat_deletions").UpdateOne(context.TODO(), bson.M{"_id": deletion.ID}, update)
+
+	return err
+}
+
+// Notification settings
+func (c *ChatRepository) FindNotificationSettings(chat model.Chat, user model.User) (model.NotificationSettings, error) {
+	settings := model.NotificationSettings{}
+
+	filter := bson.M{"chat": chat.ID, "user": user.ID}
+	err := c.Db.Collection("notification_settings").FindOne(context.TODO(), filter).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return model.NotificationSettings{Chat: chat.ID, User: user.ID, Mode: model.NotifyAll}, nil
+	}
+	if err != nil {
+		return model.NotificationSettings{}, err
+	}
+
+	return settings, nil
+}
+
+func (c *ChatRepository) FindUserNotificationSettings(user model.User) ([]model.NotificationSettings, error) {
+	settings := []model.NotificationSettings{}
+
+	cur, err := c.Db.Collection("notification_settings").Find(context.TODO(), bson.M{"user": user.ID})
+	if err != nil {
+		return []model.NotificationSettings{}, err
+	}
+
+	err = cur.All(context.TODO(), &settings)
+	if err != nil {
+		return []model.NotificationSettings{}, err
+	}
+
+	return settings, nil
+}
+
+func (c *ChatRepository) FindChatNotificationSettings(chat model.Chat) ([]model.NotificationSettings, error) {
+	settings := []model.NotificationSettings{}
+
+	cur, err := c.Db.Collection("notification_settings").Find(context.TODO(), bson.M{"chat": chat.ID})
+	if err != nil {
+		return []model.NotificationSettings{}, err
+	}
+
+	err = cur.All(context.TODO(), &settings)
+	if err != nil {
+		return []model.NotificationSettings{}, err
+	}
+
+	return settings, nil
+}
+
+func (c *ChatRepository) UpsertNotificationSettings(settings model.NotificationSettings) error {
+	opts := options.Update().SetUpsert(true)
+	filter := bson.M{"chat": settings.Chat, "user": settings.User}
+	update := bson.M{"$set": bson.M{
+		"mode":        settings.Mode,
+		"muted_until": settings.MutedUntil,
+	}}
+
+	_, err := c.Db.Collection("notification_settings").UpdateOne(context.TODO(), filter, update, opts)
+
+	return err
+}
+
+// DeleteChatNotificationSettings removes the settings of every member of a
+// deleted chat.
+func (c *ChatRepository) DeleteChatNotificationSettings(chat primitive.ObjectID) error {
+	_, err := c.Db.Collection("notification_settings").DeleteMany(context.TODO(), bson.M{"chat": chat})
+
+	return err
+}
+
+// Invite
+func (c *ChatRepository) InsertInvite(invite model.Invite) (string, error) {
+	result, err := c.Db.Collection("invites").InsertOne(context.TODO(), invite)
+	if err != nil {
+		return "-1", err
+	}
+
+	oid, _ := result.InsertedID.(primitive.ObjectID)
+
+	return oid.Hex(), nil
+}
+
+func (c *ChatRepository) FindInviteByToken(token string) (model.Invite, error) {
+	invite := model.Invite{}
+
+	err := c.Db.Collection("invites").FindOne(context.TODO(), bson.M{"token": token}).Decode(&invite)
+	if err != nil {
+		return model.Invite{}, err
+	}
+
+	return invite, nil
+}
+
+func (c *ChatRepository) FindInvites(chat model.Chat) ([]model.Invite, error) {
+	invites := []model.Invite{}
+
+	cur, err := c.Db.Collection("invites").Find(context.TODO(), bson.M{"chat": chat.ID})
+	if err != nil {
+		return []model.Invite{}, err
+	}
+
+	err = cur.All(context.TODO(), &invites)
+	if err != nil {
+		return []model.Invite{}, err
+	}
+
+	return invites, nil
+}
+
+func (c *ChatRepository) RevokeInvite(invite model.Invite) error {
+	update := bson.M{"$set": bson.M{"revoked": true}}
+	_, err := c.Db.Collection("invites").UpdateOne(context.TODO(), bson.M{"_id": invite.ID}, update)
+
+	return err
+}
+
+// DeleteChatInvites removes the invites of a deleted chat.
+func (c *ChatRepository) DeleteChatInvites(chat primitive.ObjectID) error {
+	_, err := c.Db.Collection("invites").DeleteMany(context.TODO(), bson.M{"chat": chat})
+
+	return err
+}
+
+// UseInvite atomically takes one use of a valid invite. It returns
+// mongo.ErrNoDocuments when the invite is revoked, expired or used up.
+func (c *ChatRepository) UseInvite(invite model.Invite) (model.Invite, error) {
+	used := model.Invite{}
+
+	filter := bson.M{
+		"_id":        invite.ID,
+		"revoked":    false,
+		"remaining":  bson.M{"$gt": 0},
+		"expires_at": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())},
+	}
+	update := bson.M{"$inc": bson.M{"remaining": -1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := c.Db.Collection("invites").FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&used)
+	if err != nil {
+		return model.Invite{}, err
+	}
+
+	return used, nil
+}
+
+// Webhook
+
+// EnsureIndexes marks the chats created before direct chats were flagged,
+// telling them apart by their two members as they used to be. Chats older
+// than public chats have no public field and count as private. It indexes
+// the webhooks by chat and bot and keeps the dead letters of failed
+// deliveries for webhookFailureTTL. Incoming webhooks and invites are found
+// by their unique token, and command calls expire with a TTL index.
+func (c *ChatRepository) EnsureIndexes() error {
+	unflagged := bson.M{"direct": bson.M{"$exists": false}}
+	backfill := bson.A{bson.M{"$set": bson.M{"direct": bson.M{"$and": bson.A{
+		bson.M{"$ne": bson.A{"$public", true}},
+		bson.M{"$eq": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$users", bson.A{}}}}, 2}},
+	}}}}}
+	_, err := c.Db.Collection("chats").UpdateMany(context.TODO(), unflagged, backfill)
+	if err != nil {
+		return err
+	}
+
+	hooks := []mongo.IndexModel{
+		{Keys: bson.M{"chat": 1}},
+		{Keys: bson.M{"bot": 1}, Options: options.Index().SetSparse(true)},
+	}
+	_, err = c.Db.Collection("webhooks").Indexes().CreateMany(context.TODO(), hooks)
+	if err != nil {
+		return err
+	}
+
+	incoming := []mongo.IndexModel{
+		{Keys: bson.M{"token": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"chat": 1}},
+	}
+	_, err = c.Db.Collection("incoming_webhooks").Indexes().CreateMany(context.TODO(), incoming)
+	if err != nil {
+		return err
+	}
+
+	invites := []mongo.IndexModel{
+		{Keys: bson.M{"token": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"chat": 1}},
+	}
+	_, err = c.Db.Collection("invites").Indexes().CreateMany(context.TODO(), invites)
+	if err != nil {
+		return err
+	}
+
+	failures := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "chat", Value: 1}, {Key: "failed_at", Value: -1}}},
+		{Keys: bson.M{"failed_at": 1}, Options: options.Index().SetExpireAfterSeconds(webhookFailureTTL)},
+	}
+	_, err = c.Db.Collection("webhook_failures").Indexes().CreateMany(context.TODO(), failures)
+	if err != nil {
+		return err
+	}
+
+	calls := mongo.IndexModel{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)}
+	_, err = c.Db.Collection("command_calls").Indexes().CreateOne(context.TODO(), calls)
+
+	return err
+}
+
+func (c *ChatRepository) InsertWebhook(hook model.Webhook) (string, error) {
+	result, err := c.Db.Collection("webhooks").InsertOne(context.TODO(), hook)
+	if err != nil {
+		return "-1", err
+	}
+
+	oid, _ := result.InsertedID.(primitive.ObjectID)
+
+	return oid.Hex(), nil
+}
+
+func (c *ChatRepository) FindWebhookByID(id string) (model.Webhook, error) {
+	hook := model.Webhook{}
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+
+	err = c.Db.Collection("webhooks").FindOne(context.TODO(), bson.M{"_id": oid}).Decode(&hook)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+
+	return hook, nil
+}
+
+func (c *ChatRepository) FindWebhooks(chat primitive.ObjectID) ([]model.Webhook, error) {
+	hooks := []model.Webhook{}
+
+	cur, err := c.Db.Collection("webhooks").Find(context.TODO(), bson.M{"chat": chat})
+	if err != nil {
+		return []model.Webhook{}, err
+	}
+
+	err = cur.All(context.TODO(), &hooks)
+	if err != nil {
+		return []model.Webhook{}, err
+	}
+
+	return hooks, nil
+}
+
+// FindBotWebhooks returns the webhooks of the given bots.
+func (c *ChatRepository) FindBotWebhooks(bots []primitive.ObjectID) ([]model.Webhook, error) {
+	hooks := []model.Webhook{}
+
+	cur, err := c.Db.Collection("webhooks").Find(context.TODO(), bson.M{"bot": bson.M{"$in": bots}})
+	if err != nil {
+		return []model.Webhook{}, err
+	}
+
+	err = cur.All(context.TODO(), &hooks)
+	if err != nil {
+		return []model.Webhook{}, err
+	}
+
+	return hooks, nil
+}
+
+func (c *ChatRepository) DeleteBotWebhooks(bot primitive.ObjectID) error {
+	_, err := c.Db.Collection("webhooks").DeleteMany(context.TODO(), bson.M{"bot": bot})
+
+	return err
+}
+
+// DeleteChatWebhooks removes the webhooks of a deleted chat.
+func (c *ChatRepository) DeleteChatWebhooks(chat primitive.ObjectID) error {
+	_, err := c.Db.Collection("webhooks").DeleteMany(context.TODO(), bson.M{"chat": chat})
+
+	return err
+}
+
+func (c *ChatRepository) DeleteWebhook(hook model.Webhook) error {
+	_, err := c.Db.Collection("webhooks").DeleteOne(context.TODO(), bson.M{"_id": hook.ID})
+
+	return err
+}
+
+func (c *ChatRepository) InsertWebhookFailure(failure model.WebhookFailure) error {
+	_, err := c.Db.Collection("webhook_failures").InsertOne(context.TODO(), failure)
+
+	return err
+}
+
+// FindWebhookFailures returns the latest dead letters of the chat webhooks.
+func (c *ChatRepository) FindWebhookFailures(chat primitive.ObjectID, limit int64) ([]model.WebhookFailure, error) {
+	failures := []model.WebhookFailure{}
+
+	opts := options.Find().SetSort(bson.M{"failed_at": -1}).SetLimit(limit)
+	cur, err := c.Db.Collection("webhook_failures").Find(context.TODO(), bson.M{"chat": chat}, opts)
+	if err != nil {
+		return []model.WebhookFailure{}, err
+	}
+
+	err = cur.All(context.TODO(), &failures)
+	if err != nil {
+		return []model.WebhookFailure{}, err
+	}
+
+	return failures, nil
+}
+
+func (c *ChatRepository) InsertIncomingWebhook(hook model.IncomingWebhook) (string, error) {
+	result, err := c.Db.Collection("incoming_webhooks").InsertOne(context.TODO(), hook)
+	if err != nil {
+		return "-1", err
+	}
+
+	oid, _ := result.InsertedID.(primitive.ObjectID)
+
+	return oid.Hex(), nil
+}
+
+func (c *ChatRepository) FindIncomingWebhookByID(id string) (model.IncomingWebhook, error) {
+	hook := model.IncomingWebhook{}
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.IncomingWebhook{}, err
+	}
+
+	err = c.Db.Collection("incoming_webhooks").FindOne(context.TODO(), bson.M{"_id": oid}).Decode(&hook)
+	if err != nil {
+		return model.IncomingWebhook{}, err
+	}
+
+	return hook, nil
+}
+
+func (c *ChatRepository) FindIncomingWebhookByToken(token string) (model.IncomingWebhook, error) {
+	hook := model.IncomingWebhook{}
+
+	err := c.Db.Collection("incoming_webhooks").FindOne(context.TODO(), bson.M{"token": token}).Decode(&hook)
+	if err != nil {
+		return model.IncomingWebhook{}, err
+	}
+
+	return hook, nil
+}
+
+func (c *ChatRepository) FindIncomingWebhooks(chat primitive.ObjectID) ([]model.IncomingWebhook, error) {
+	hooks := []model.IncomingWebhook{}
+
+	cur, err := c.Db.Collection("incoming_webhooks").Find(context.TODO(), bson.M{"chat": chat})
+	if err != nil {
+		return []model.IncomingWebhook{}, err
+	}
+
+	err = cur.All(context.TODO(), &hooks)
+	if err != nil {
+		return []model.IncomingWebhook{}, err
+	}
+
+	return hooks, nil
+}
+
+func (c *ChatRepository) DeleteIncomingWebhook(hook model.IncomingWebhook) error {
+	_, err := c.Db.Collection("incoming_webhooks").DeleteOne(context.TODO(), bson.M{"_id": hook.ID})
+
+	return err
+}
+
+// Command calls
+
+func (c *ChatRepository) InsertCommandCall(call model.CommandCall) (string, error) {
+	result, err := c.Db.Collection("command_calls").InsertOne(context.TODO(), call)
+	if err != nil {
+		return "-1", err
+	}
+
+	oid, _ := result.InsertedID.(primitive.ObjectID)
+
+	return oid.Hex(), nil
+}
+
+// FindCommandCall returns the call unless it expired. The TTL index removes
+// expired calls only eventually.
+func (c *ChatRepository) FindCommandCall(id string) (model.CommandCall, error) {
+	call := model.CommandCall{}
+
+	callID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.CommandCall{}, err
+	}
+
+	filter := bson.M{"_id": callID, "expires_at": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())}}
+	err = c.Db.Collection("command_calls").FindOne(context.TODO(), filter).Decode(&call)
+	if err != nil {
+		return model.CommandCall{}, err
+	}
+
+	return call, nil
+}
+
+// Message
+
+// EnsureIndexes creates the indexes used to page through a chat and to find
+// expired messages. Self-destructing messages are purged by a TTL index.
+// It also indexes the scheduled messages for the scheduler and their authors,
+// and keeps drafts unique per user and chat.
+func (m *MessageRepository) EnsureIndexes() error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "chat", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.M{"created_at": 1}},
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+	_, err := m.Db.Collection("messages").Indexes().CreateMany(context.TODO(), indexes)
+	if err != nil {
+		return err
+	}
+
+	scheduled := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "send_at", Value: 1}}},
+		{Keys: bson.D{{Key: "author", Value: 1}, {Key: "send_at", Value: 1}}},
+	}
+	_, err = m.Db.Collection("scheduled_messages").Indexes().CreateMany(context.TODO(), scheduled)
+	if err != nil {
+		return err
+	}
+
+	drafts := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user", Value: 1}, {Key: "chat", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err = m.Db.Collection("drafts").Indexes().CreateOne(context.TODO(), drafts)
+
+	return err
+}
+
+// InsertMessage stores a message built by the service. The type defaults to
+// text and the creation time to now.
+func (m *MessageRepository) InsertMessage(message model.Message) (string, error) {
+	if message.Type == "" {
+		message.Type = model.MessageTypeText
+	}
+	if message.CreatedAt == 0 {
+		message.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	}
+
+	result, err := m.Db.Collection("messages").InsertOne(context.TODO(), message)
+	if err != nil {
+		return "-1", err
+	}
+
+	oid, _ := result.InsertedID.(primitive.ObjectID)
+
+	return oid.Hex(), nil
+}
+
+// InsertMessages stores new messages at once, in order, like InsertMessage
+// does one. The messages always get new IDs, so when the insert fails part
+// way, the ones already stored can be removed again and either all of them
+// are stored or none.
+func (m *MessageRepository) InsertMessages(messages []model.Message) ([]string, error) {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	ids := make([]primitive.ObjectID, 0, len(messages))
+	documents := make([]interface{}, 0, len(messages))
+	for _, message := range messages {
+		message.ID = primitive.NewObjectID()
+		if message.Type == "" {
+			message.Type = model.MessageTypeText
+		}
+		if message.CreatedAt == 0 {
+			message.CreatedAt = now
+		}
+
+		ids = append(ids, message.ID)
+		documents = append(documents, message)
+	}
+
+	_, err := m.Db.Collection("messages").InsertMany(context.TODO(), documents)
+	if err != nil {
+		filter := bson.M{"_id": bson.M{"$in": ids}}
+		if _, deleteErr := m.Db.Collection("messages").DeleteMany(context.TODO(), filter); deleteErr != nil {
+			return nil, fmt.Errorf("%w, and removing the stored messages failed: %s", err, deleteErr)
+		}
+
+		return nil, err
+	}
+
+	hexIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		hexIDs = append(hexIDs, id.Hex())
+	}
+
+	return hexIDs, nil
+}
+
+// DeleteMessages removes at most limit messages of the chat and returns how
+// many were deleted, so large chats can be cleaned up in batches.
+func (m *MessageRepository) DeleteMessages(chatID primitive.ObjectID, limit int64) (int64, error) {
+	return m.deleteMessages(bson.M{"chat": chatID}, limit)
+}
+
+// DeleteChatMessagesBefore removes at most limit messages of the chat created
+// before the given time.
+func (m *MessageRepository) DeleteChatMessagesBefore(chatID primitive.ObjectID, before time.Time, limit int64) (int64, error) {
+	filter := bson.M{"chat": chatID, "created_at": bson.M{"$lt": primitive.NewDateTimeFromTime(before)}}
+
+	return m.deleteMessages(filter, limit)
+}
+
+// DeleteMessagesBefore removes at most limit messages created before the
+// given time, skipping the excluded chats.
+func (m *MessageRepository) DeleteMessagesBefore(before time.Time, exclude []primitive.ObjectID, limit int64) (int64, error) {
+	filter := bson.M{"created_at": bson.M{"$lt": primitive.NewDateTimeFromTime(before)}}
+	if len(exclude) > 0 {
+		filter["chat"] = bson.M{"$nin": exclude}
+	}
+
+	return m.deleteMessages(filter, limit)
+}
+
+func (m *MessageRepository) deleteMessages(filter bson.M, limit int64) (int64, error) {
+	ids, err := m.findMessageIDs(filter, limit)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	result, err := m.Db.Collection("messages").DeleteMany(context.TODO(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// DeleteUserMessages removes at most limit messages written by the user,
+// forwarded copies of them included.
+func (m *MessageRepository) DeleteUserMessages(user primitive.ObjectID, limit int64) (int64, error) {
+	ids, err := m.findUserMessageIDs(user, limit)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	result, err := m.Db.Collection("messages").DeleteMany(context.TODO(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// AnonymizeUserMessages detaches at most limit messages from their author,
+// and forwarded copies of them from the original author.
+func (m *MessageRepository) AnonymizeUserMessages(user primitive.ObjectID, limit int64) (int64, error) {
+	ids, err := m.findUserMessageIDs(user, limit)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	authored := bson.M{"_id": bson.M{"$in": ids}, "author": user}
+	update := bson.M{"$set": bson.M{"author": primitive.NilObjectID}}
+	_, err = m.Db.Collection("messages").UpdateMany(context.TODO(), authored, update)
+	if err != nil {
+		return 0, err
+	}
+
+	forwarded := bson.M{"_id": bson.M{"$in": ids}, "forwarded_from.author": user}
+	update = bson.M{"$set": bson.M{"forwarded_from.author": primitive.NilObjectID}}
+	_, err = m.Db.Collection("messages").UpdateMany(context.TODO(), forwarded, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(ids)), nil
+}
+
+// FindUserSystemMessages returns at most limit system messages about the
+// user or naming them as the member who added someone.
+func (m *MessageRepository) FindUserSystemMessages(user primitive.ObjectID, limit int64) ([]model.Message, error) {
+	messages := []model.Message{}
+
+	filter := bson.M{
+		"type": model.MessageTypeSystem,
+		"$or":  bson.A{bson.M{"author": user}, bson.M{"system.by": user}},
+	}
+	cur, err := m.Db.Collection("messages").Find(context.TODO(), filter, options.Find().SetLimit(limit))
+	if err != nil {
+		return []model.Message{}, err
+	}
+
+	err = cur.All(context.TODO(), &messages)
+	if err != nil {
+		return []model.Message{}, err
+	}
+
+	return messages, nil
+}
+
+// UpdateSystemMessage replaces the text, author and event of a system message.
+func (m *MessageRepository) UpdateSystemMessage(message model.Message) error {
+	update := bson.M{"$set": bson.M{
+		"text":   message.Text,
+		"author": message.Author,
+		"system": message.System,
+	}}
+	_, err := m.Db.Collection("messages").UpdateOne(context.TODO(), bson.M{"_id": message.ID}, update)
+
+	return err
+}
+
+func (m *MessageRepository) findUserMessageIDs(user primitive.ObjectID, limit int64) ([]primitive.ObjectID, error) {
+	filter := bson.M{"$or": bson.A{bson.M{"author": user}, bson.M{"forwarded_from.author": user}}}
+
+	return m.findMessageIDs(filter, limit)
+}
+
+func (m *MessageRepository) findMessageIDs(filter bson.M, limit int64) ([]primitive.ObjectID, error) {
+	opts := options.Find().SetLimit(limit).SetProjection(bson.M{"_id": 1})
+
+	cur, err := m.Db.Collection("messages").Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch []model.Message
+	err = cur.All(context.TODO(), &batch)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(batch))
+	for _, message := range batch {
+		ids = append(ids, message.ID)
+	}
+
+	return ids, nil
+}
+
+// EachUserMessage calls fn for every message written by the user, one
+// document at a time.
+func (m *MessageRepository) EachUserMessage(user primitive.ObjectID, fn func(model.Message) error) error {
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+
+	cur, err := m.Db.Collection("messages").Find(context.TODO(), bson.M{"author": user}, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+		message := model.Message{}
+		if err := cur.Decode(&message); err != nil {
+			return err
+		}
+
+		if err := fn(message); err != nil {
+			return err
+		}
+	}
+
+	return cur.Err()
+}
+
+// EachVotedPoll calls fn with every poll the user voted in, oldest first.
+func (m *MessageRepository) EachVotedPoll(user primitive.ObjectID, fn func(model.Message) error) error {
+	filter := bson.M{"type": model.MessageTypePoll, "poll.options.voters": user}
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+
+	cur, err := m.Db.Collection("messages").Find(context.TODO(), filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+		message := model.Message{}
+		if err := cur.Decode(&message); err != nil {
+			return err
+		}
+
+		if err := fn(message); err != nil {
+			return err
+		}
+	}
+
+	return cur.Err()
+}
+
+func (m *MessageRepository) FindMessageByID(id string) (model.Message, error) {
+	message := model.Message{}
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return message, err
+	}
+
+	err = m.Db.Collection("messages").FindOne(context.TODO(), bson.M{"_id": oid}).Decode(&message)
+
+	return message, err
+}
+
+// VotePoll atomically adds the user to the voters of the options. A single
+// choice vote first withdraws the previous one and only succeeds if no other
+// vote of the user got in between, otherwise mongo.ErrNoDocuments is returned.
+func (m *MessageRepository) VotePoll(id primitive.ObjectID, user primitive.ObjectID, choices []int, single bool) (model.Message, error) {
+	message := model.Message{}
+
+	filter := bson.M{"_id": id, "type": model.MessageTypePoll}
+	if single {
+		pull := bson.M{"$pull": bson.M{"poll.options.$[].voters": user}}
+		if _, err := m.Db.Collection("messages").UpdateOne(context.TODO(), filter, pull); err != nil {
+			return message, err
+		}
+
+		filter["poll.options.voters"] = bson.M{"$ne": user}
+	}
+
+	voters := bson.M{}
+	for _, choice := range choices {
+		voters[fmt.Sprintf("poll.options.%d.voters", choice)] = user
+	}
+	update := bson.M{"$addToSet": voters}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := m.Db.Collection("messages").FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&message)
+
+	return message, err
+}
+
+// UnvotePoll atomically removes the user from the voters of the options, or
+// of every option when none are given.
+func (m *MessageRepository) UnvotePoll(id primitive.ObjectID, user primitive.ObjectID, choices []int) (model.Message, error) {
+	message := model.Message{}
+
+	voters := bson.M{"poll.options.$[].voters": user}
+	if len(choices) > 0 {
+		voters = bson.M{}
+		for _, choice := range choices {
+			voters[fmt.Sprintf("poll.options.%d.voters", choice)] = user
+		}
+	}
+
+	filter := bson.M{"_id": id, "type": model.MessageTypePoll}
+	update := bson.M{"$pull": voters}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := m.Db.Collection("messages").FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&message)
+
+	return message, err
+}
+
+// RemoveUserVotes withdraws every vote of the user, in every poll.
+func (m *MessageRepository) RemoveUserVotes(user primitive.ObjectID) error {
+	filter := bson.M{"type": model.MessageTypePoll, "poll.options.voters": user}
+	update := bson.M{"$pull": bson.M{"poll.options.$[].voters": user}}
+	_, err := m.Db.Collection("messages").UpdateMany(context.TODO(), filter, update)
+
+	return err
+}
+
+// SetPreviews attaches the link previews to a message.
+func (m *MessageRepository) SetPreviews(id primitive.ObjectID, previews []model.Preview) error {
+	update := bson.M{"$set": bson.M{"previews": previews}}
+	_, err := m.Db.Collection("messages").UpdateOne(context.TODO(), bson.M{"_id": id}, update)
+
+	return err
+}
+
+// Drafts
+func (m *MessageRepository) UpsertDraft(draft model.Draft) error {
+	opts := options.Update().SetUpsert(true)
+	filter := bson.M{"chat": draft.Chat, "user": draft.User}
+	update := bson.M{"$set": bson.M{
+		"text":       draft.Text,
+		"reply_to":   draft.ReplyTo,
+		"updated_at": draft.UpdatedAt,
+	}}
+
+	_, err := m.Db.Collection("drafts").UpdateOne(context.TODO(), filter, update, opts)
+
+	return err
+}
+
+func (m *MessageRepository) FindDraft(chat model.Chat, user model.User) (model.Draft, error) {
+	draft := model.Draft{}
+
+	filter := bson.M{"chat": chat.ID, "user": user.ID}
+	err := m.Db.Collection("drafts").FindOne(context.TODO(), filter).Decode(&draft)
+
+	return draft, err
+}
+
+func (m *MessageRepository) FindUserDrafts(user primitive.ObjectID) ([]model.Draft, error) {
+	drafts := []model.Draft{}
+
+	cur, err := m.Db.Collection("drafts").Find(context.TODO(), bson.M{"user": user})
+	if err != nil {
+		return drafts, err
+	}
+
+	err = cur.All(context.TODO(), &drafts)
+
+	return drafts, err
+}
+
+func (m *MessageRepository) DeleteDraft(chat model.Chat, user model.User) error {
+	_, err := m.Db.Collection("drafts").DeleteOne(context.TODO(), bson.M{"chat": chat.ID, "user": user.ID})
+
+	return err
+}
+
+// DeleteUserDrafts removes the drafts of the user in every chat.
+func (m *MessageRepository) DeleteUserDrafts(user primitive.ObjectID) error {
+	_, err := m.Db.Collection("drafts").DeleteMany(context.TODO(), bson.M{"user": user})
+
+	return err
+}
+
+// DeleteChatDrafts removes the drafts of every member of a deleted chat.
+func (m *MessageRepository) DeleteChatDrafts(chat primitive.ObjectID) error {
+	_, err := m.Db.Collection("drafts").DeleteMany(context.TODO(), bson.M{"chat": chat})
+
+	return err
+}
+
+// Scheduled messages
+func (m *MessageRepository) InsertScheduledMessage(message model.ScheduledMessage) (string, error) {
+	result, err := m.Db.Collection("scheduled_messages").InsertOne(context.TODO(), message)
+	if err != nil {
+		return "-1", err
+	}
+
+	oid, _ := result.InsertedID.(primitive.ObjectID)
+
+	return oid.Hex(), nil
+}
+
+func (m *MessageRepository) FindScheduledMessage(id string) (model.ScheduledMessage, error) {
+	message := model.ScheduledMessage{}
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return message, err
+	}
+
+	err = m.Db.Collection("scheduled_messages").FindOne(context.TODO(), bson.M{"_id": oid}).Decode(&message)
+
+	return message, err
+}
+
+// FindScheduledMessages returns the messages of the author that are not
+// delivered or cancelled yet, including the failed ones.
+func (m *MessageRepository) FindScheduledMessages(author primitive.ObjectID) ([]model.ScheduledMessage, error) {
+	messages := []model.ScheduledMessage{}
+
+	filter := bson.M{
+		"author": author,
+		"status": bson.M{"$in": bson.A{model.ScheduledPending, model.ScheduledSending, model.ScheduledFailed}},
+	}
+	opts := options.Find().SetSort(bson.M{"send_at": 1})
+
+	cur, err := m.Db.Collection("scheduled_messages").Find(context.TODO(), filter, opts)
+	if err != nil {
+		return messages, err
+	}
+
+	err = cur.All(context.TODO(), &messages)
+
+	return messages, err
+}
+
+// UpdateScheduledMessage saves an edit or a cancellation. It returns
+// mongo.ErrNoDocuments when the message is no longer pending.
+func (m *MessageRepository) UpdateScheduledMessage(message model.ScheduledMessage) error {
+	filter := bson.M{"_id": message.ID, "status": model.ScheduledPending}
+	update := bson.M{"$set": bson.M{
+		"text":    message.Text,
+		"ttl":     message.TTL,
+		"send_at": message.SendAt,
+		"status":  message.Status,
+	}}
+
+	result, err := m.Db.Collection("scheduled_messages").UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// DeleteUserScheduledMessages removes every scheduled message of the author,
+// so that none of them is delivered anymore.
+func (m *MessageRepository) DeleteUserScheduledMessages(author primitive.ObjectID) error {
+	_, err := m.Db.Collection("scheduled_messages").DeleteMany(context.TODO(), bson.M{"author": author})
+
+	return err
+}
+
+// DeleteChatScheduledMessages removes the pending scheduled messages of a
+// deleted chat. Delivered and failed ones stay listed for their authors.
+func (m *MessageRepository) DeleteChatScheduledMessages(chat primitive.ObjectID) error {
+	filter := bson.M{"chat": chat, "status": model.ScheduledPending}
+	_, err := m.Db.Collection("scheduled_messages").DeleteMany(context.TODO(), filter)
+
+	return err
+}
+
+// FindDueScheduledMessages returns at most limit messages whose send_at has
+// passed, including those whose delivery was interrupted.
+func (m *MessageRepository) FindDueScheduledMessages(now time.Time, limit int64) ([]model.ScheduledMessage, error) {
+	messages := []model.ScheduledMessage{}
+
+	filter := bson.M{
+		"status":  bson.M{"$in": bson.A{model.ScheduledPending, model.ScheduledSending}},
+		"send_at": bson.M{"$lte": primitive.NewDateTimeFromTime(now)},
+	}
+	opts := options.Find().SetSort(bson.M{"send_at": 1}).SetLimit(limit)
+
+	cur, err := m.Db.Collection("scheduled_messages").Find(context.TODO(), filter, opts)
+	if err != nil {
+		return messages, err
+	}
+
+	err = cur.All(context.TODO(), &messages)
+
+	return messages, err
+}
+
+// ClaimScheduledMessage atomically moves the message to sending, so it can
+// no longer be edited or cancelled, and returns its latest version. It
+// returns mongo.ErrNoDocuments when the message was cancelled or delivered.
+func (m *MessageRepository) ClaimScheduledMessage(id primitive.ObjectID) (model.ScheduledMessage, error) {
+	claimed := model.ScheduledMessage{}
+
+	filter := bson.M{
+		"_id":    id,
+		"status": bson.M{"$in": bson.A{model.ScheduledPending, model.ScheduledSending}},
+	}
+	update := bson.M{"$set": bson.M{"status": model.ScheduledSending}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := m.Db.Collection("scheduled_messages").FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&claimed)
+
+	return claimed, err
+}
+
+// FinishScheduledMessage records the outcome of a delivery.
+func (m *MessageRepository) FinishScheduledMessage(message model.ScheduledMessage) error {
+	update := bson.M{"$set": bson.M{"status": message.Status, "error": message.Error}}
+	_, err := m.Db.Collection("scheduled_messages").UpdateOne(context.TODO(), bson.M{"_id": message.ID}, update)
+
+	return err
+}
+
+func (m *MessageRepository) FindMessages(chat model.Chat) ([]model.Message, error) {
+	messages := []model.Message{}
+
+	cur, err := m.Db.Collection("messages").Find(context.TODO(), bson.M{"chat": chat.ID})
+	if err != nil {
+		return []model.Message{}, err
+	}
+
+	err = cur.All(context.TODO(), &messages)
+	if err != nil {
+		return []model.Message{}, err
+	}
+
+	return messages, nil
+}
+
+// Presence
+func (p *PresenceRepository) Touch(user primitive.ObjectID, at time.Time) error {
+	return p.update(user, at, 0)
+}
+
+func (p *PresenceRepository) Connect(user primitive.ObjectID, at time.Time) error {
+	return p.update(user, at, 1)
+}
+
+func (p *PresenceRepository) Disconnect(user primitive.ObjectID, at time.Time) error {
+	return p.update(user, at, -1)
+}
+
+func (p *PresenceRepository) Find(users []primitive.ObjectID) (map[primitive.ObjectID]model.Presence, error) {
+	presence := []model.Presence{}
+
+	cur, err := p.Db.Collection("presence").Find(context.TODO(), bson.M{"_id": bson.M{"$in": users}})
+	if err != nil {
+		return nil, err
+	}
+
+	err = cur.All(context.TODO(), &presence)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[primitive.ObjectID]model.Presence, len(presence))
+	for _, p := range presence {
+		if p.Connections < 0 {
+			p.Connections = 0
+		}
+		found[p.User] = p
+	}
+
+	return found, nil
+}
+
+// Forget drops the presence of the user.
+func (p *PresenceRepository) Forget(user primitive.ObjectID) error {
+	_, err := p.Db.Collection("presence").DeleteOne(context.TODO(), bson.M{"_id": user})
+
+	return err
+}
+
+func (p *PresenceRepository) update(user primitive.ObjectID, at time.Time, connections int) error {
+	opts := options.Update().SetUpsert(true)
+	update := bson.M{
+		"$max": bson.M{"last_seen": primitive.NewDateTimeFromTime(at)},
+		"$inc": bson.M{"connections": connections},
+	}
+
+	_, err := p.Db.Collection("presence").UpdateOne(context.TODO(), bson.M{"_id": user}, update, opts)
+
+	return err
 }
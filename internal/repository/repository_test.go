@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/flaambe/avito/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testDatabase connects to the database at MONGO_URI and drops it after the
+// test. Tests that need it are skipped without MONGO_URI.
+func testDatabase(t *testing.T) *mongo.Database {
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		t.Skip("MONGO_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := client.Database("test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+
+	return db
+}
+
+func TestEnsureIndexesBackfillsDirect(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDatabase(t)
+	users := bson.A{bson.M{"_id": primitive.NewObjectID()}, bson.M{"_id": primitive.NewObjectID()}}
+	chats := []interface{}{
+		// Chats from before public chats have no public field.
+		bson.M{"_id": "legacy", "users": users},
+		bson.M{"_id": "private", "public": false, "users": users},
+		bson.M{"_id": "public", "public": true, "users": users},
+		bson.M{"_id": "group", "public": false, "users": append(bson.A{bson.M{"_id": primitive.NewObjectID()}}, users...)},
+	}
+	_, err := db.Collection("chats").InsertMany(context.Background(), chats)
+	assert.NoError(err)
+
+	assert.NoError(NewChatRepository(db).EnsureIndexes())
+
+	direct := map[string]bool{}
+	cur, err := db.Collection("chats").Find(context.Background(), bson.M{})
+	assert.NoError(err)
+	for cur.Next(context.Background()) {
+		var chat struct {
+			ID     string `bson:"_id"`
+			Direct bool   `bson:"direct"`
+		}
+		assert.NoError(cur.Decode(&chat))
+		direct[chat.ID] = chat.Direct
+	}
+	assert.Equal(map[string]bool{"legacy": true, "private": true, "public": false, "group": false}, direct)
+}
+
+func TestRemoveUserVotes(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDatabase(t)
+	user, other := primitive.NewObjectID(), primitive.NewObjectID()
+	poll := model.Message{
+		ID:   primitive.NewObjectID(),
+		Type: model.MessageTypePoll,
+		Poll: &model.Poll{Question: "Lunch?", Options: []model.PollOption{
+			{Text: "Pizza", Voters: []primitive.ObjectID{user, other}},
+			{Text: "Sushi", Voters: []primitive.ObjectID{user}},
+		}},
+	}
+	_, err := db.Collection("messages").InsertOne(context.Background(), poll)
+	assert.NoError(err)
+
+	messageRepo := NewMessageRepository(db)
+	assert.NoError(messageRepo.RemoveUserVotes(user))
+
+	voted, err := messageRepo.FindMessageByID(poll.ID.Hex())
+	assert.NoError(err)
+	assert.Equal([]primitive.ObjectID{other}, voted.Poll.Options[0].Voters)
+	assert.Empty(voted.Poll.Options[1].Voters)
+}
+
+func TestInsertMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testDatabase(t)
+	chat := primitive.NewObjectID()
+	messageRepo := NewMessageRepository(db)
+
+	ids, err := messageRepo.InsertMessages([]model.Message{{Chat: chat, Text: "first"}, {Chat: chat, Text: "second"}})
+	assert.NoError(err)
+	assert.Len(ids, 2)
+
+	for i, text := range []string{"first", "second"} {
+		message, err := messageRepo.FindMessageByID(ids[i])
+		assert.NoError(err)
+		assert.Equal(text, message.Text)
+		assert.Equal(model.MessageTypeText, message.Type)
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+func (c *ChatService) BlockUser(request view.BlockUserRequest) (view.BlockUserResponse, error) {
+	user, blocked, err := c.findBlockPair(request)
+	if err != nil {
+		return view.BlockUserResponse{}, err
+	}
+
+	if err := c.userRepo.BlockUser(user, blocked); err != nil {
+		return view.BlockUserResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	return view.BlockUserResponse{ID: blocked.ID.Hex(), Blocked: true}, nil
+}
+
+func (c *ChatService) UnblockUser(request view.BlockUserRequest) (view.BlockUserResponse, error) {
+	user, blocked, err := c.findBlockPair(request)
+	if err != nil {
+		return view.BlockUserResponse{}, err
+	}
+
+	if err := c.userRepo.UnblockUser(user, blocked); err != nil {
+		return view.BlockUserResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	return view.BlockUserResponse{ID: blocked.ID.Hex(), Blocked: false}, nil
+}
+
+func (c *ChatService) GetBlockedUsers(request view.UserRequest) (view.UsersResponse, error) {
+	var usersView []view.UserProfile
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.UsersResponse{}, err
+	}
+
+	blocks, err := c.userRepo.FindBlocks(user)
+	if err != nil {
+		return view.UsersResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	if len(blocks) == 0 {
+		return usersView, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(blocks))
+	for _, block := range blocks {
+		ids = append(ids, block.Blocked)
+	}
+
+	usersModel, err := c.userRepo.FindUsersByIDs(ids)
+	if err != nil {
+		return view.UsersResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	for _, userModel := range usersModel {
+		usersView = append(usersView, userToView(userModel))
+	}
+
+	return usersView, nil
+}
+
+func (c *ChatService) findBlockPair(request view.BlockUserRequest) (model.User, model.User, error) {
+	if request.UserID == request.BlockedID {
+		return model.User{}, model.User{}, errs.New(400, "users cannot block themselves", nil)
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return model.User{}, model.User{}, err
+	}
+
+	blocked, err := c.userRepo.FindUserByID(request.BlockedID)
+	if err != nil {
+		return model.User{}, model.User{}, errs.New(404, "blocked user not found", err)
+	}
+
+	return user, blocked, nil
+}
+
+// checkDirect rejects direct conversations between users when either of them
+// blocked the other.
+func (c *ChatService) checkDirect(user model.User, other model.User) error {
+	blocked, err := c.userRepo.IsBlocked(user, other)
+	if err != nil {
+		return errs.New(500, "internal server error", err)
+	}
+
+	if blocked {
+		return errs.New(403, "direct messages between blocked users are not allowed", nil)
+	}
+
+	return nil
+}
+
+// directPeer returns the other user of a direct chat. Bots in the chat don't
+// count, so adding one doesn't lift the blocks.
+func directPeer(chat model.Chat, user model.User) (model.User, bool) {
+	if !chat.Direct {
+		return model.User{}, false
+	}
+
+	for _, member := range chat.Users {
+		if member.ID != user.ID && !member.Bot {
+			return member, true
+		}
+	}
+
+	return model.User{}, false
+}
+
+// blockedAuthors returns the authors hidden from the user.
+func (c *ChatService) blockedAuthors(user model.User) (map[primitive.ObjectID]bool, error) {
+	blocks, err := c.userRepo.FindBlocks(user)
+	if err != nil {
+		return nil, err
+	}
+
+	blocked := make(map[primitive.ObjectID]bool, len(blocks))
+	for _, block := range blocks {
+		blocked[block.Blocked] = true
+	}
+
+	return blocked, nil
+}
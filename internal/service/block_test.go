@@ -0,0 +1,179 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBlockUser(t *testing.T) {
+	assert := assert.New(t)
+
+	harasserModel := model.User{ID: primitive.NewObjectID(), UserName: "Harasser"}
+	userBlockRepoMock := new(mocks.UserRepository)
+	userBlockRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userBlockRepoMock.On("FindUserByID", harasserModel.ID.Hex()).Return(harasserModel, nil)
+	userBlockRepoMock.On("BlockUser", userModel, harasserModel).Return(nil)
+	userBlockRepoMock.On("UnblockUser", userModel, harasserModel).Return(nil)
+	userBlockRepoMock.On("FindBlocks", userModel).Return([]model.Block{{User: userModel.ID, Blocked: harasserModel.ID}}, nil)
+	userBlockRepoMock.On("FindUsersByIDs", []primitive.ObjectID{harasserModel.ID}).Return([]model.User{harasserModel}, nil)
+	testObj := service.NewChatService(userBlockRepoMock, chatRepoMock, messageRepoMock)
+
+	blockRequest := view.BlockUserRequest{
+		UserID:    userModel.ID.Hex(),
+		BlockedID: harasserModel.ID.Hex(),
+	}
+
+	blockResponse, err := testObj.BlockUser(blockRequest)
+	assert.NoError(err)
+	assert.Equal(view.BlockUserResponse{ID: harasserModel.ID.Hex(), Blocked: true}, blockResponse)
+	userBlockRepoMock.AssertCalled(t, "BlockUser", userModel, harasserModel)
+
+	usersResponse, err := testObj.GetBlockedUsers(view.UserRequest{UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(harasserModel.ID.Hex(), usersResponse[0].ID)
+
+	blockResponse, err = testObj.UnblockUser(blockRequest)
+	assert.NoError(err)
+	assert.False(blockResponse.Blocked)
+	userBlockRepoMock.AssertCalled(t, "UnblockUser", userModel, harasserModel)
+
+	blockResponse, err = testObj.BlockUser(view.BlockUserRequest{UserID: userModel.ID.Hex(), BlockedID: userModel.ID.Hex()})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+	assert.Empty(blockResponse)
+}
+
+func TestBlockedDirectChat(t *testing.T) {
+	assert := assert.New(t)
+
+	harasserModel := model.User{ID: primitive.NewObjectID(), UserName: "Harasser"}
+	directChatModel := model.Chat{
+		ID:     primitive.NewObjectID(),
+		Name:   "direct_chat",
+		Direct: true,
+		Users:  []model.User{userModel, harasserModel},
+	}
+	// A bot in the chat doesn't make it a group.
+	botChatModel := directChatModel
+	botChatModel.ID = primitive.NewObjectID()
+	botChatModel.Users = append(botChatModel.Users, model.User{ID: primitive.NewObjectID(), UserName: "bot", Bot: true})
+	userBlockRepoMock := new(mocks.UserRepository)
+	userBlockRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userBlockRepoMock.On("FindUserByID", harasserModel.ID.Hex()).Return(harasserModel, nil)
+	userBlockRepoMock.On("IsBlocked", userModel, harasserModel).Return(true, nil)
+	userBlockRepoMock.On("IsBlocked", harasserModel, userModel).Return(true, nil)
+	chatDirectRepoMock := new(mocks.ChatRepository)
+	chatDirectRepoMock.On("FindChatByID", directChatModel.ID.Hex()).Return(directChatModel, nil)
+	chatDirectRepoMock.On("FindChatByID", botChatModel.ID.Hex()).Return(botChatModel, nil)
+	testObj := service.NewChatService(userBlockRepoMock, chatDirectRepoMock, messageRepoMock)
+
+	chatResponse, err := testObj.AddChat(view.NewChatRequest{
+		Name:    directChatModel.Name,
+		UsersID: []string{userModel.ID.Hex(), harasserModel.ID.Hex()},
+		Direct:  true,
+	})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	assert.Empty(chatResponse)
+
+	messageResponse, err := testObj.AddMessage(view.NewMessageRequest{
+		ChatID: directChatModel.ID.Hex(),
+		UserID: harasserModel.ID.Hex(),
+		Text:   "hello",
+	})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	assert.Empty(messageResponse)
+
+	_, err = testObj.AddMessage(view.NewMessageRequest{
+		ChatID: botChatModel.ID.Hex(),
+		UserID: harasserModel.ID.Hex(),
+		Text:   "hello",
+	})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+}
+
+func TestGetMessagesHidesBlockedAuthors(t *testing.T) {
+	assert := assert.New(t)
+
+	harasserModel := model.User{ID: primitive.NewObjectID(), UserName: "Harasser"}
+	harasserMessageModel := model.Message{
+		ID:        primitive.NewObjectID(),
+		Chat:      chatModel.ID,
+		Author:    harasserModel.ID,
+		Text:      "hidden",
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+	userBlockRepoMock := new(mocks.UserRepository)
+	userBlockRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userBlockRepoMock.On("FindBlocks", userModel).Return([]model.Block{{User: userModel.ID, Blocked: harasserModel.ID}}, nil)
+	messageBlockRepoMock := new(mocks.MessageRepository)
+	messageBlockRepoMock.On("FindMessages", chatModel).Return([]model.Message{messageModel, harasserMessageModel}, nil)
+	testObj := service.NewChatService(userBlockRepoMock, chatRepoMock, messageBlockRepoMock)
+
+	messagesResponse, err := testObj.GetMessages(view.MessagesRequest{СhatID: chatModel.ID.Hex(), UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Len(messagesResponse, 1)
+	assert.Equal(messageModel.ID.Hex(), messagesResponse[0].ID)
+
+	messagesResponse, err = testObj.GetMessages(view.MessagesRequest{СhatID: chatModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Len(messagesResponse, 2)
+}
+
+func TestEventsHideBlockedUsers(t *testing.T) {
+	assert := assert.New(t)
+
+	harasserModel := model.User{ID: primitive.NewObjectID(), UserName: "Harasser"}
+	otherModel := model.User{ID: primitive.NewObjectID(), UserName: "Other"}
+	groupChatModel := model.Chat{
+		ID:    primitive.NewObjectID(),
+		Name:  "group_chat",
+		Users: []model.User{userModel, harasserModel, otherModel},
+	}
+	userBlockRepoMock := new(mocks.UserRepository)
+	userBlockRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userBlockRepoMock.On("FindBlocks", userModel).Return([]model.Block{{User: userModel.ID, Blocked: harasserModel.ID}}, nil)
+	userBlockRepoMock.On("FindBlockedBy", model.User{ID: harasserModel.ID}).Return([]model.Block{{User: userModel.ID, Blocked: harasserModel.ID}}, nil)
+	chatBlockRepoMock := new(mocks.ChatRepository)
+	chatBlockRepoMock.On("FindChatNotificationSettings", groupChatModel).Return([]model.NotificationSettings{}, nil)
+	eventsMock := new(mocks.EventHub)
+	eventsMock.On("Poll", mock.Anything, userModel.ID, mock.Anything, mock.Anything).Return([]model.Event{
+		{Type: model.EventTyping, Chat: groupChatModel.ID, User: harasserModel.ID},
+		{Type: model.EventTyping, Chat: groupChatModel.ID, User: otherModel.ID},
+	})
+	testObj := service.NewChatService(userBlockRepoMock, chatBlockRepoMock, messageRepoMock, service.WithEvents(eventsMock))
+
+	eventsResponse, err := testObj.PollEvents(context.Background(), view.PollEventsRequest{UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(view.EventsResponse{{Type: model.EventTyping, ChatID: groupChatModel.ID.Hex(), UserID: otherModel.ID.Hex()}}, eventsResponse)
+
+	// Nor are members alerted about the messages of users they blocked.
+	recipients, err := testObj.NotificationRecipients(groupChatModel, model.Message{Chat: groupChatModel.ID, Author: harasserModel.ID, Text: "hello"})
+	assert.NoError(err)
+	assert.Equal([]model.User{otherModel}, recipients)
+}
@@ -0,0 +1,397 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	maxBotKeys   = 10
+	botKeyPrefix = "bot_"
+)
+
+// botWebhookEvents are the events bots subscribe to, the chat events of the
+// chats they are members of and the slash commands they serve.
+var botWebhookEvents = []string{model.WebhookMessageCreated, model.WebhookMemberJoined, model.WebhookCommandInvoked}
+
+// AddBot creates a bot owned by the user together with its first API key.
+func (c *ChatService) AddBot(request view.NewBotRequest) (view.NewBotResponse, error) {
+	if !validUserName.MatchString(request.UserName) {
+		return view.NewBotResponse{}, errs.New(400, "username must be 3 to 32 letters, digits, '_', '.' or '-' and start with a letter or digit", nil)
+	}
+
+	owner, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.NewBotResponse{}, err
+	}
+
+	if owner.Bot {
+		return view.NewBotResponse{}, errs.New(403, "bots can't own bots", nil)
+	}
+
+	displayName := request.DisplayName
+	if displayName == "" {
+		displayName = request.UserName
+	}
+
+	botID, err := c.userRepo.InsertBot(model.User{UserName: request.UserName, DisplayName: displayName, Bot: true, Owner: owner.ID})
+	if isDuplicateKey(err) {
+		return view.NewBotResponse{}, errs.New(409, "username is already taken", err)
+	}
+	if err != nil {
+		return view.NewBotResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	bot := model.User{UserName: request.UserName, Bot: true, Owner: owner.ID}
+	bot.ID, _ = primitive.ObjectIDFromHex(botID)
+
+	key, err := c.addBotKey(bot)
+	if err != nil {
+		return view.NewBotResponse{}, err
+	}
+
+	return view.NewBotResponse{ID: botID, Key: key}, nil
+}
+
+// AddBotKey issues another API key, so that keys can be rotated without
+// downtime.
+func (c *ChatService) AddBotKey(request view.BotRequest) (view.BotKey, error) {
+	bot, err := c.findOwnedBot(request.BotID, request.UserID)
+	if err != nil {
+		return view.BotKey{}, err
+	}
+
+	keys, err := c.userRepo.FindAPIKeys(bot.ID)
+	if err != nil {
+		return view.BotKey{}, errs.New(500, "internal server error", err)
+	}
+
+	if len(keys) >= maxBotKeys {
+		return view.BotKey{}, errs.New(409, fmt.Sprintf("a bot can have at most %d API keys", maxBotKeys), nil)
+	}
+
+	return c.addBotKey(bot)
+}
+
+func (c *ChatService) GetBotKeys(request view.BotRequest) (view.BotKeysResponse, error) {
+	keysView := view.BotKeysResponse{}
+
+	bot, err := c.findOwnedBot(request.BotID, request.UserID)
+	if err != nil {
+		return view.BotKeysResponse{}, err
+	}
+
+	keys, err := c.userRepo.FindAPIKeys(bot.ID)
+	if err != nil {
+		return view.BotKeysResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	for _, key := range keys {
+		keysView = append(keysView, botKeyToView(key))
+	}
+
+	return keysView, nil
+}
+
+func (c *ChatService) RevokeBotKey(request view.RevokeBotKeyRequest) (view.RevokeBotKeyResponse, error) {
+	bot, err := c.findOwnedBot(request.BotID, request.UserID)
+	if err != nil {
+		return view.RevokeBotKeyResponse{}, err
+	}
+
+	if err := c.userRepo.DeleteAPIKey(bot.ID, request.KeyID); err != nil {
+		return view.RevokeBotKeyResponse{}, errs.New(404, "API key not found", err)
+	}
+
+	return view.RevokeBotKeyResponse{ID: request.KeyID, Revoked: true}, nil
+}
+
+// AddBotToChat lets a member bring their own bot into the chat. Bots only see
+// the chats they are members of.
+func (c *ChatService) AddBotToChat(request view.AddBotToChatRequest) (view.Chat, error) {
+	chat, err := c.findChat(request.ChatID)
+	if err != nil {
+		return view.Chat{}, err
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.Chat{}, err
+	}
+
+	if !isMember(chat, user) {
+		return view.Chat{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	bot, err := c.userRepo.FindUserByID(request.BotID)
+	if err != nil || !bot.Bot {
+		return view.Chat{}, errs.New(404, "bot not found", err)
+	}
+
+	if bot.Owner != user.ID {
+		return view.Chat{}, errs.New(403, "only the owner of the bot can add it to chats", nil)
+	}
+
+	if isMember(chat, bot) {
+		return chatToView(chat, user), nil
+	}
+
+	chat, err = c.addMember(chat, bot, systemMessage{
+		model.SystemEvent{Event: model.SystemMemberJoined, Via: "added", By: user.ID},
+		fmt.Sprintf("%s added %s to the chat", user.UserName, bot.UserName),
+	})
+	if err != nil {
+		return view.Chat{}, err
+	}
+
+	return chatToView(chat, user), nil
+}
+
+// BotChats lists the chats of the bot that owns the API key.
+func (c *ChatService) BotChats(key string) (view.ChatsResponse, error) {
+	bot, err := c.findBot(key)
+	if err != nil {
+		return view.ChatsResponse{}, err
+	}
+
+	return c.getChats(bot, true)
+}
+
+func (c *ChatService) BotMessages(key string, request view.BotChatRequest) (view.MessagesResponse, error) {
+	bot, chat, err := c.findBotChat(key, request.ChatID)
+	if err != nil {
+		return view.MessagesResponse{}, err
+	}
+
+	return c.getMessages(chat, bot, request.HTML)
+}
+
+func (c *ChatService) BotSendMessage(key string, request view.BotMessageRequest) (view.NewMessageResponse, error) {
+	bot, _, err := c.findBotChat(key, request.ChatID)
+	if err != nil {
+		return view.NewMessageResponse{}, err
+	}
+
+	// Bots don't run slash commands, their text is posted as it is.
+	return c.addMessage(view.NewMessageRequest{
+		ChatID: request.ChatID,
+		UserID: bot.ID.Hex(),
+		Text:   request.Text,
+		TTL:    request.TTL,
+		Poll:   request.Poll,
+	}, primitive.NilObjectID)
+}
+
+// BotPollEvents long-polls the events of the chats of the bot, including the
+// new messages.
+func (c *ChatService) BotPollEvents(ctx context.Context, key string, request view.BotPollEventsRequest) (view.EventsResponse, error) {
+	bot, err := c.findBot(key)
+	if err != nil {
+		return view.EventsResponse{}, err
+	}
+
+	return c.pollEvents(ctx, bot, request.Device, request.Timeout)
+}
+
+// SetBotWebhook replaces the webhook that receives the events of the chats
+// of the bot. The secret is returned this time only.
+func (c *ChatService) SetBotWebhook(key string, request view.BotWebhookRequest) (view.Webhook, error) {
+	bot, err := c.findBot(key)
+	if err != nil {
+		return view.Webhook{}, err
+	}
+
+	if request.URL != "" {
+		if err := checkWebhookURL(request.URL); err != nil {
+			return view.Webhook{}, err
+		}
+
+		for _, event := range request.Events {
+			if !isBotWebhookEvent(event) {
+				return view.Webhook{}, errs.New(400, fmt.Sprintf("bots can't subscribe to %q", event), nil)
+			}
+		}
+	}
+
+	if err := c.chatRepo.DeleteBotWebhooks(bot.ID); err != nil {
+		return view.Webhook{}, errs.New(500, "internal server error", err)
+	}
+
+	if request.URL == "" {
+		return view.Webhook{}, nil
+	}
+
+	secret, err := newInviteToken()
+	if err != nil {
+		return view.Webhook{}, errs.New(500, "internal server error", err)
+	}
+
+	events := request.Events
+	if len(events) == 0 {
+		events = botWebhookEvents
+	}
+
+	hook := model.Webhook{
+		Bot:       bot.ID,
+		Creator:   bot.ID,
+		URL:       request.URL,
+		Secret:    secret,
+		Events:    events,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	id, err := c.chatRepo.InsertWebhook(hook)
+	if err != nil {
+		return view.Webhook{}, errs.New(500, "internal server error", err)
+	}
+	hook.ID, _ = primitive.ObjectIDFromHex(id)
+
+	hookView := webhookToView(hook)
+	hookView.ChatID = ""
+	hookView.Secret = hook.Secret
+
+	return hookView, nil
+}
+
+// findBot authenticates the API key.
+func (c *ChatService) findBot(key string) (model.User, error) {
+	apiKey, err := c.userRepo.FindAPIKeyByHash(hashBotKey(key))
+	if err != nil {
+		return model.User{}, errs.New(401, "invalid API key", err)
+	}
+
+	bot, err := c.userRepo.FindUserByID(apiKey.Bot.Hex())
+	if err != nil {
+		return model.User{}, errs.New(401, "invalid API key", err)
+	}
+
+	return bot, nil
+}
+
+func (c *ChatService) findBotChat(key string, chatID string) (model.User, model.Chat, error) {
+	bot, err := c.findBot(key)
+	if err != nil {
+		return model.User{}, model.Chat{}, err
+	}
+
+	chat, err := c.findChat(chatID)
+	if err != nil {
+		return model.User{}, model.Chat{}, err
+	}
+
+	if !isMember(chat, bot) {
+		return model.User{}, model.Chat{}, errs.New(403, "bot is not a member of the chat", nil)
+	}
+
+	return bot, chat, nil
+}
+
+func (c *ChatService) findOwnedBot(botID string, userID string) (model.User, error) {
+	bot, err := c.userRepo.FindUserByID(botID)
+	if err != nil || !bot.Bot {
+		return model.User{}, errs.New(404, "bot not found", err)
+	}
+
+	user, err := c.findUser(userID)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	if bot.Owner != user.ID {
+		return model.User{}, errs.New(403, "only the owner can manage the bot", nil)
+	}
+
+	return bot, nil
+}
+
+func (c *ChatService) addBotKey(bot model.User) (view.BotKey, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return view.BotKey{}, errs.New(500, "internal server error", err)
+	}
+	secret := botKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	key := model.APIKey{
+		Bot:       bot.ID,
+		Hash:      hashBotKey(secret),
+		Prefix:    secret[:len(botKeyPrefix)+8],
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	id, err := c.userRepo.InsertAPIKey(key)
+	if err != nil {
+		return view.BotKey{}, errs.New(500, "internal server error", err)
+	}
+	key.ID, _ = primitive.ObjectIDFromHex(id)
+
+	keyView := botKeyToView(key)
+	keyView.Key = secret
+
+	return keyView, nil
+}
+
+// hashBotKey is enough to store keys safely: unlike passwords they are long
+// random strings, so they can't be guessed from a fast hash.
+func hashBotKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// eraseBots shuts down the bots of an erased user: their keys and webhooks
+// are deleted and they leave their chats.
+func (c *ChatService) eraseBots(owner primitive.ObjectID) error {
+	bots, err := c.userRepo.FindOwnedBots(owner)
+	if err != nil {
+		return err
+	}
+
+	for _, bot := range bots {
+		if err := c.userRepo.DeactivateUser(bot); err != nil {
+			return err
+		}
+
+		if err := c.userRepo.DeleteAPIKeys(bot.ID); err != nil {
+			return err
+		}
+
+		if err := c.chatRepo.DeleteBotWebhooks(bot.ID); err != nil {
+			return err
+		}
+
+		if err := c.chatRepo.RemoveUserFromChats(bot.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isBotWebhookEvent(event string) bool {
+	for _, known := range botWebhookEvents {
+		if event == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func botKeyToView(key model.APIKey) view.BotKey {
+	return view.BotKey{
+		ID:        key.ID.Hex(),
+		Prefix:    key.Prefix,
+		CreatedAt: key.CreatedAt.Time().String(),
+	}
+}
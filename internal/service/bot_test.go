@@ -0,0 +1,216 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAddBot(t *testing.T) {
+	assert := assert.New(t)
+
+	botModel := model.User{ID: primitive.NewObjectID(), UserName: "weather", Bot: true, Owner: userModel.ID}
+
+	var keyModel model.APIKey
+	userBotRepoMock := new(mocks.UserRepository)
+	userBotRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userBotRepoMock.On("InsertBot", model.User{UserName: "weather", DisplayName: "Weather", Bot: true, Owner: userModel.ID}).Return(botModel.ID.Hex(), nil)
+	userBotRepoMock.On("InsertAPIKey", mock.Anything).Return(primitive.NewObjectID().Hex(), nil).Run(func(args mock.Arguments) {
+		keyModel = args.Get(0).(model.APIKey)
+	})
+	testObj := service.NewChatService(userBotRepoMock, chatRepoMock, messageRepoMock)
+
+	botResponse, err := testObj.AddBot(view.NewBotRequest{UserID: userModel.ID.Hex(), UserName: "weather", DisplayName: "Weather"})
+	assert.NoError(err)
+	assert.Equal(botModel.ID.Hex(), botResponse.ID)
+	assert.True(strings.HasPrefix(botResponse.Key.Key, botResponse.Key.Prefix))
+
+	// Only a hash of the key is stored.
+	sum := sha256.Sum256([]byte(botResponse.Key.Key))
+	assert.Equal(hex.EncodeToString(sum[:]), keyModel.Hash)
+	assert.Equal(botModel.ID, keyModel.Bot)
+
+	_, err = testObj.AddBot(view.NewBotRequest{UserID: userModel.ID.Hex(), UserName: "w"})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+}
+
+func TestAddBotToChat(t *testing.T) {
+	assert := assert.New(t)
+
+	otherModel := model.User{ID: primitive.NewObjectID(), UserName: "Other"}
+	botModel := model.User{ID: primitive.NewObjectID(), UserName: "weather", Bot: true, Owner: otherModel.ID}
+
+	userBotRepoMock := new(mocks.UserRepository)
+	userBotRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userBotRepoMock.On("FindUserByID", botModel.ID.Hex()).Return(botModel, nil)
+	testObj := service.NewChatService(userBotRepoMock, chatRepoMock, messageRepoMock)
+
+	// Someone else's bot can't be brought in.
+	_, err := testObj.AddBotToChat(view.AddBotToChatRequest{ChatID: chatModel.ID.Hex(), UserID: userModel.ID.Hex(), BotID: botModel.ID.Hex()})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+}
+
+func TestBotsUseTheBotAPI(t *testing.T) {
+	botModel := model.User{ID: primitive.NewObjectID(), UserName: "weather", Bot: true, Owner: userModel.ID}
+	botID := botModel.ID.Hex()
+	chatID := chatModel.ID.Hex()
+
+	userBotRepoMock := new(mocks.UserRepository)
+	userBotRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userBotRepoMock.On("FindUserByID", botID).Return(botModel, nil)
+	userBotRepoMock.On("FindErasureJob", botID).Return(model.ErasureJob{}, errors.New("no documents"))
+	eventHubMock := new(mocks.EventHub)
+	testObj := service.NewChatService(userBotRepoMock, chatRepoMock, messageRepoMock, service.WithEvents(eventHubMock))
+
+	entryPoints := map[string]func() error{
+		"AddMessage": func() error {
+			_, err := testObj.AddMessage(view.NewMessageRequest{ChatID: chatID, UserID: botID, Text: "Sunny"})
+			return err
+		},
+		"AddMessage command": func() error {
+			_, err := testObj.AddMessage(view.NewMessageRequest{ChatID: chatID, UserID: botID, Text: "/me is sunny"})
+			return err
+		},
+		"GetChats": func() error {
+			_, err := testObj.GetChats(view.ChatsRequest{UserID: botID})
+			return err
+		},
+		"GetMessages": func() error {
+			_, err := testObj.GetMessages(view.MessagesRequest{СhatID: chatID, UserID: botID})
+			return err
+		},
+		"PollEvents": func() error {
+			_, err := testObj.PollEvents(context.Background(), view.PollEventsRequest{UserID: botID})
+			return err
+		},
+		"AddChat": func() error {
+			_, err := testObj.AddChat(view.NewChatRequest{Name: "bots", UsersID: []string{userModel.ID.Hex(), botID}})
+			return err
+		},
+		"UpdateChat": func() error {
+			name := "renamed"
+			_, err := testObj.UpdateChat(view.UpdateChatRequest{ChatID: chatID, UserID: botID, Name: &name})
+			return err
+		},
+		"LeaveChat": func() error {
+			_, err := testObj.LeaveChat(view.LeaveChatRequest{ChatID: chatID, UserID: botID})
+			return err
+		},
+		"Typing": func() error {
+			_, err := testObj.Typing(view.TypingRequest{ChatID: chatID, UserID: botID})
+			return err
+		},
+		"SaveDraft": func() error {
+			_, err := testObj.SaveDraft(view.SaveDraftRequest{ChatID: chatID, UserID: botID, Text: "Sunny"})
+			return err
+		},
+		"JoinChat": func() error {
+			_, err := testObj.JoinChat(view.JoinChatRequest{ChatID: chatID, UserID: botID})
+			return err
+		},
+		"Ping": func() error {
+			_, err := testObj.Ping(view.UserRequest{UserID: botID})
+			return err
+		},
+		"ExportUser": func() error {
+			return testObj.ExportUser(view.UserRequest{UserID: botID}, new(bytes.Buffer))
+		},
+		"DeleteUser": func() error {
+			_, err := testObj.DeleteUser(view.UserRequest{UserID: botID})
+			return err
+		},
+	}
+
+	for name, call := range entryPoints {
+		call := call
+		t.Run(name, func(t *testing.T) {
+			err := call()
+			assert.Error(t, err)
+			var responseError *errs.ResponseError
+			if errors.As(err, &responseError) {
+				assert.Equal(t, 403, responseError.Status)
+			}
+		})
+	}
+}
+
+func TestBotSendMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	botModel := model.User{ID: primitive.NewObjectID(), UserName: "weather", Bot: true, Owner: userModel.ID}
+	botChatModel := chatModel
+	botChatModel.Users = []model.User{userModel, {ID: botModel.ID, UserName: botModel.UserName, Bot: true}}
+	otherChatModel := model.Chat{ID: primitive.NewObjectID(), Users: []model.User{userModel}}
+
+	key := "bot_key"
+	sum := sha256.Sum256([]byte(key))
+
+	userBotRepoMock := new(mocks.UserRepository)
+	userBotRepoMock.On("FindUserByID", botModel.ID.Hex()).Return(botModel, nil)
+	userBotRepoMock.On("FindAPIKeyByHash", hex.EncodeToString(sum[:])).Return(model.APIKey{Bot: botModel.ID}, nil)
+	userBotRepoMock.On("FindAPIKeyByHash", mock.Anything).Return(model.APIKey{}, errors.New("no documents"))
+	userBotRepoMock.On("IsBlocked", mock.Anything, mock.Anything).Return(false, nil)
+	userBotRepoMock.On("FindBlockedBy", mock.Anything).Return([]model.Block{}, nil)
+	chatBotRepoMock := new(mocks.ChatRepository)
+	chatBotRepoMock.On("FindChatByID", botChatModel.ID.Hex()).Return(botChatModel, nil)
+	chatBotRepoMock.On("FindChatByID", otherChatModel.ID.Hex()).Return(otherChatModel, nil)
+	chatBotRepoMock.On("FindChatNotificationSettings", botChatModel).Return([]model.NotificationSettings{}, nil)
+	messageBotRepoMock := new(mocks.MessageRepository)
+	messageBotRepoMock.On("InsertMessage", mock.Anything).Return(primitive.NewObjectID().Hex(), nil)
+
+	published := make(chan model.Event, 2)
+	eventHubMock := new(mocks.EventHub)
+	eventHubMock.On("Publish", []primitive.ObjectID{userModel.ID}, mock.Anything).Return().Run(func(args mock.Arguments) {
+		published <- args.Get(1).(model.Event)
+	})
+	testObj := service.NewChatService(userBotRepoMock, chatBotRepoMock, messageBotRepoMock, service.WithEvents(eventHubMock))
+
+	messageResponse, err := testObj.BotSendMessage(key, view.BotMessageRequest{ChatID: botChatModel.ID.Hex(), Text: "Sunny"})
+	assert.NoError(err)
+	messageBotRepoMock.AssertCalled(t, "InsertMessage", model.Message{Chat: botChatModel.ID, Author: botModel.ID, Bot: true, Text: "Sunny"})
+
+	// The other members get the message as an event and are alerted about it.
+	event := <-published
+	assert.Equal(model.EventMessage, event.Type)
+	assert.Equal(messageResponse.ID, event.Message.ID.Hex())
+	assert.True(event.Message.Bot)
+	event = <-published
+	assert.Equal(model.EventNotification, event.Type)
+	assert.Equal(messageResponse.ID, event.Message.ID.Hex())
+
+	_, err = testObj.BotSendMessage(key, view.BotMessageRequest{ChatID: otherChatModel.ID.Hex(), Text: "Sunny"})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+
+	_, err = testObj.BotSendMessage("bot_wrong", view.BotMessageRequest{ChatID: botChatModel.ID.Hex(), Text: "Sunny"})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(401, responseError.Status)
+	}
+}
@@ -1,39 +1,190 @@
 package service
 
 import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
 	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/markdown"
 	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/ratelimit"
 	"github.com/flaambe/avito/internal/view"
 )
 
+// maxMessageTTL caps the lifetime of self-destructing messages, in seconds.
+const maxMessageTTL = 7 * 24 * 60 * 60
+
 type UserRepository interface {
 	FindUserByID(id string) (model.User, error)
 	InsertUser(name string) (string, error)
+	InsertBot(bot model.User) (string, error)
+	InsertAPIKey(key model.APIKey) (string, error)
+	FindAPIKeyByHash(hash string) (model.APIKey, error)
+	FindAPIKeys(bot primitive.ObjectID) ([]model.APIKey, error)
+	DeleteAPIKey(bot primitive.ObjectID, id string) error
+	DeleteAPIKeys(bot primitive.ObjectID) error
+	FindOwnedBots(owner primitive.ObjectID) ([]model.User, error)
+	FindUsersByIDs(ids []primitive.ObjectID) ([]model.User, error)
+	SearchUsers(prefix string, limit int64) ([]model.User, error)
+	BlockUser(user model.User, blocked model.User) error
+	UnblockUser(user model.User, blocked model.User) error
+	FindBlocks(user model.User) ([]model.Block, error)
+	FindBlockedBy(user model.User) ([]model.Block, error)
+	IsBlocked(user model.User, other model.User) (bool, error)
+	DeactivateUser(user model.User) error
+	InsertErasureJob(job model.ErasureJob) error
+	FindErasureJob(id string) (model.ErasureJob, error)
+	FindPendingErasureJobs() ([]model.ErasureJob, error)
+	UpdateErasureJob(job model.ErasureJob) error
+	InsertAuditRecord(record model.AuditRecord) error
+	UpdateUser(user model.User) error
+	SetBotCommands(bot primitive.ObjectID, commands []model.Command) error
 }
 
 type ChatRepository interface {
 	FindChatByID(id string) (model.Chat, error)
 	FindChats(user model.User) ([]model.Chat, error)
-	InsertChat(name string, users []model.User) (string, error)
+	FindChatsWithRetention() ([]model.Chat, error)
+	EachChat(user model.User, fn func(model.Chat) error) error
+	InsertChat(name string, users []model.User, public bool, direct bool) (string, error)
+	UpdateChat(chat model.Chat) error
+	FindPublicChats(query string, limit int64) ([]model.ChatSummary, error)
+	RemoveChatMember(chat model.Chat, user model.User) error
+	AddChatMember(chat model.Chat, user model.User) error
+	RemoveUserFromChats(user primitive.ObjectID) error
+	SetArchived(chat model.Chat, user model.User, archived bool) error
+	InsertWebhook(hook model.Webhook) (string, error)
+	FindWebhookByID(id string) (model.Webhook, error)
+	FindWebhooks(chat primitive.ObjectID) ([]model.Webhook, error)
+	FindBotWebhooks(bots []primitive.ObjectID) ([]model.Webhook, error)
+	DeleteBotWebhooks(bot primitive.ObjectID) error
+	DeleteWebhook(hook model.Webhook) error
+	DeleteChatWebhooks(chat primitive.ObjectID) error
+	FindWebhookFailures(chat primitive.ObjectID, limit int64) ([]model.WebhookFailure, error)
+	InsertIncomingWebhook(hook model.IncomingWebhook) (string, error)
+	FindIncomingWebhookByID(id string) (model.IncomingWebhook, error)
+	FindIncomingWebhookByToken(token string) (model.IncomingWebhook, error)
+	FindIncomingWebhooks(chat primitive.ObjectID) ([]model.IncomingWebhook, error)
+	DeleteIncomingWebhook(hook model.IncomingWebhook) error
+	DeleteChat(chat model.Chat) error
+	InsertChatDeletion(deletion model.ChatDeletion) error
+	FindChatDeletion(id string) (model.ChatDeletion, error)
+	FindPendingChatDeletions() ([]model.ChatDeletion, error)
+	UpdateChatDeletion(deletion model.ChatDeletion) error
+	FindNotificationSettings(chat model.Chat, user model.User) (model.NotificationSettings, error)
+	FindUserNotificationSettings(user model.User) ([]model.NotificationSettings, error)
+	FindChatNotificationSettings(chat model.Chat) ([]model.NotificationSettings, error)
+	UpsertNotificationSettings(settings model.NotificationSettings) error
+	DeleteChatNotificationSettings(chat primitive.ObjectID) error
+	InsertInvite(invite model.Invite) (string, error)
+	FindInviteByToken(token string) (model.Invite, error)
+	FindInvites(chat model.Chat) ([]model.Invite, error)
+	RevokeInvite(invite model.Invite) error
+	UseInvite(invite model.Invite) (model.Invite, error)
+	DeleteChatInvites(chat primitive.ObjectID) error
+	InsertCommandCall(call model.CommandCall) (string, error)
+	FindCommandCall(id string) (model.CommandCall, error)
 }
 
 type MessageRepository interface {
 	FindMessages(chat model.Chat) ([]model.Message, error)
-	InsertMessage(chat model.Chat, user model.User, text string) (string, error)
+	EachUserMessage(user primitive.ObjectID, fn func(model.Message) error) error
+	EachVotedPoll(user primitive.ObjectID, fn func(model.Message) error) error
+	FindMessageByID(id string) (model.Message, error)
+	VotePoll(id primitive.ObjectID, user primitive.ObjectID, choices []int, single bool) (model.Message, error)
+	UnvotePoll(id primitive.ObjectID, user primitive.ObjectID, choices []int) (model.Message, error)
+	RemoveUserVotes(user primitive.ObjectID) error
+	FindUserSystemMessages(user primitive.ObjectID, limit int64) ([]model.Message, error)
+	UpdateSystemMessage(message model.Message) error
+	SetPreviews(id primitive.ObjectID, previews []model.Preview) error
+	UpsertDraft(draft model.Draft) error
+	FindDraft(chat model.Chat, user model.User) (model.Draft, error)
+	FindUserDrafts(user primitive.ObjectID) ([]model.Draft, error)
+	DeleteDraft(chat model.Chat, user model.User) error
+	DeleteUserDrafts(user primitive.ObjectID) error
+	DeleteChatDrafts(chat primitive.ObjectID) error
+	InsertScheduledMessage(message model.ScheduledMessage) (string, error)
+	FindScheduledMessage(id string) (model.ScheduledMessage, error)
+	FindScheduledMessages(author primitive.ObjectID) ([]model.ScheduledMessage, error)
+	UpdateScheduledMessage(message model.ScheduledMessage) error
+	DeleteUserScheduledMessages(author primitive.ObjectID) error
+	DeleteChatScheduledMessages(chat primitive.ObjectID) error
+	FindDueScheduledMessages(now time.Time, limit int64) ([]model.ScheduledMessage, error)
+	ClaimScheduledMessage(id primitive.ObjectID) (model.ScheduledMessage, error)
+	FinishScheduledMessage(message model.ScheduledMessage) error
+	InsertMessage(message model.Message) (string, error)
+	InsertMessages(messages []model.Message) ([]string, error)
+	DeleteMessages(chatID primitive.ObjectID, limit int64) (int64, error)
+	DeleteChatMessagesBefore(chatID primitive.ObjectID, before time.Time, limit int64) (int64, error)
+	DeleteMessagesBefore(before time.Time, exclude []primitive.ObjectID, limit int64) (int64, error)
+	DeleteUserMessages(user primitive.ObjectID, limit int64) (int64, error)
+	AnonymizeUserMessages(user primitive.ObjectID, limit int64) (int64, error)
 }
 
 type ChatService struct {
 	userRepo    UserRepository
 	chatRepo    ChatRepository
 	messageRepo MessageRepository
+
+	presence     PresenceStore
+	awayAfter    time.Duration
+	offlineAfter time.Duration
+
+	events        EventHub
+	typingLimiter *ratelimit.Limiter
+	hookLimiter   *ratelimit.Limiter
+
+	links       LinkFetcher
+	unfurls     chan struct{}
+	webhooks    WebhookSender
+	globalHooks []model.Webhook
+
+	erasurePolicy string
+	retentionDays int
+
+	mu       sync.Mutex
+	cleanups map[primitive.ObjectID]bool
+	erasures map[primitive.ObjectID]bool
 }
 
-func NewChatService(u UserRepository, c ChatRepository, m MessageRepository) *ChatService {
-	return &ChatService{u, c, m}
+// Option configures optional parts of the ChatService.
+type Option func(*ChatService)
+
+func NewChatService(u UserRepository, c ChatRepository, m MessageRepository, opts ...Option) *ChatService {
+	service := &ChatService{
+		userRepo:    u,
+		chatRepo:    c,
+		messageRepo: m,
+
+		typingLimiter: ratelimit.New(typingRate, typingBurst),
+		hookLimiter:   ratelimit.New(incomingWebhookRate, incomingWebhookBurst),
+		erasurePolicy: model.ErasureAnonymize,
+
+		cleanups: make(map[primitive.ObjectID]bool),
+		erasures: make(map[primitive.ObjectID]bool),
+	}
+
+	for _, opt := range opts {
+		opt(service)
+	}
+
+	return service
 }
 
 func (c *ChatService) AddUser(user view.NewUserRequest) (view.NewUserResponse, error) {
+	if !validUserName.MatchString(user.UserName) {
+		return view.NewUserResponse{}, errs.New(400, "username must be 3 to 32 letters, digits, '_', '.' or '-' and start with a letter or digit", nil)
+	}
+
 	userId, err := c.userRepo.InsertUser(user.UserName)
+	if isDuplicateKey(err) {
+		return view.NewUserResponse{}, errs.New(409, "username is already taken", err)
+	}
 	if err != nil {
 		return view.NewUserResponse{}, errs.New(500, "internal server error", err)
 	}
@@ -44,31 +195,91 @@ func (c *ChatService) AddUser(user view.NewUserRequest) (view.NewUserResponse, e
 func (c *ChatService) AddChat(chat view.NewChatRequest) (view.NewChatResponse, error) {
 	var usersModel []model.User
 
+	if chat.Direct && (len(chat.UsersID) != 2 || chat.Public) {
+		return view.NewChatResponse{}, errs.New(400, "direct chats are private and have exactly two users", nil)
+	}
+
 	for _, userID := range chat.UsersID {
-		user, err := c.userRepo.FindUserByID(userID)
+		user, err := c.findUser(userID)
 		if err != nil {
-			return view.NewChatResponse{}, errs.New(404, "user not found", err)
+			return view.NewChatResponse{}, err
 		}
 
 		userModel := model.User{
 			ID:       user.ID,
 			UserName: user.UserName,
+			Bot:      user.Bot,
 		}
 		usersModel = append(usersModel, userModel)
 	}
 
-	chatId, err := c.chatRepo.InsertChat(chat.Name, usersModel)
+	if chat.Direct {
+		if err := c.checkDirect(usersModel[0], usersModel[1]); err != nil {
+			return view.NewChatResponse{}, err
+		}
+	}
+
+	chatId, err := c.chatRepo.InsertChat(chat.Name, usersModel, chat.Public, chat.Direct)
 	if err != nil {
 		return view.NewChatResponse{}, errs.New(500, "internal server error", err)
 	}
 
+	if len(usersModel) > 0 {
+		chatOID, _ := primitive.ObjectIDFromHex(chatId)
+		created := systemMessage{
+			model.SystemEvent{Event: model.SystemChatCreated, Name: chat.Name},
+			fmt.Sprintf("%s created the chat %q", usersModel[0].UserName, chat.Name),
+		}
+
+		// Without its first message the chat is removed again, so a failed
+		// request can be retried without leaving a duplicate behind.
+		if err := c.postSystemMessage(model.Chat{ID: chatOID}, usersModel[0], created); err != nil {
+			if err := c.chatRepo.DeleteChat(model.Chat{ID: chatOID}); err != nil {
+				log.Printf("failed to remove chat %s after its creation failed: %s", chatId, err)
+			}
+
+			return view.NewChatResponse{}, errs.New(500, "internal server error", err)
+		}
+	}
+
+	// A new chat has no webhooks of its own yet.
+	c.notify(model.Chat{}, primitive.NilObjectID, model.WebhookChatCreated, newChatToWebhook(chatId, chat, usersModel))
+
 	return view.NewChatResponse{ID: chatId}, nil
 }
 
+// AddMessage runs the slash command the text starts with instead of posting
+// it. Two slashes post the text with one of them.
 func (c *ChatService) AddMessage(message view.NewMessageRequest) (view.NewMessageResponse, error) {
-	chat, err := c.chatRepo.FindChatByID(message.ChatID)
+	if message.Poll == nil {
+		if call, ok := parseCommand(message.Text); ok {
+			return c.runCommand(message, call)
+		}
+
+		if strings.HasPrefix(message.Text, "//") {
+			message.Text = message.Text[1:]
+		}
+	}
+
+	if _, err := c.findUser(message.UserID); err != nil {
+		return view.NewMessageResponse{}, err
+	}
+
+	return c.addMessage(message, primitive.NilObjectID)
+}
+
+// addMessage stores the message under the given ID when one is set. Scheduled
+// messages are delivered this way, so delivering one twice stores it once
+// and doesn't count as activity of the author.
+func (c *ChatService) addMessage(message view.NewMessageRequest, id primitive.ObjectID) (view.NewMessageResponse, error) {
+	return c.postMessage(message, id, "")
+}
+
+// postMessage stores a message of the given type, text by default.
+func (c *ChatService) postMessage(message view.NewMessageRequest, id primitive.ObjectID, messageType string) (view.NewMessageResponse, error) {
+	chat, err := c.findChat(message.ChatID)
 	if err != nil {
-		return view.NewMessageResponse{}, errs.New(404, "chat not found", err)
+		return view.NewMessageResponse{}, err
 	}
 
 	user, err := c.userRepo.FindUserByID(message.UserID)
@@ -76,43 +287,277 @@ func (c *ChatService) AddMessage(message view.NewMessageRequest) (view.NewMessag
 		return view.NewMessageResponse{}, errs.New(404, "user not found", err)
 	}
 
-	messageId, err := c.messageRepo.InsertMessage(chat, user, message.Text)
+	if id.IsZero() {
+		c.touch(user)
+	}
+
+	if peer, ok := directPeer(chat, user); ok {
+		if err := c.checkDirect(user, peer); err != nil {
+			return view.NewMessageResponse{}, err
+		}
+	}
+
+	if err := checkTTL(message.TTL); err != nil {
+		return view.NewMessageResponse{}, err
+	}
+
+	messageModel := model.Message{
+		ID:     id,
+		Chat:   chat.ID,
+		Author: user.ID,
+		Bot:    user.Bot,
+		Type:   messageType,
+	}
+	messageModel.Text, messageModel.Entities = markdown.Parse(message.Text)
+
+	if message.Poll != nil {
+		poll, err := newPoll(*message.Poll)
+		if err != nil {
+			return view.NewMessageResponse{}, err
+		}
+
+		// Clients that don't know polls still show the question, as plain
+		// text. The entities of the text it replaces would point into it.
+		messageModel.Type = model.MessageTypePoll
+		messageModel.Text = poll.Question
+		messageModel.Entities = nil
+		messageModel.Poll = &poll
+	}
+
+	if message.TTL != 0 {
+		messageModel.ExpiresAt = primitive.NewDateTimeFromTime(time.Now().Add(time.Duration(message.TTL) * time.Second))
+	}
+
+	messageId, err := c.messageRepo.InsertMessage(messageModel)
 	if err != nil {
+		if !id.IsZero() && isDuplicateKey(err) {
+			return view.NewMessageResponse{ID: id.Hex()}, nil
+		}
+
 		return view.NewMessageResponse{}, errs.New(500, "internal server error", err)
 	}
 
+	c.unfurl(messageId, messageModel)
+	c.messageCreated(chat, messageId, messageModel)
+
 	return view.NewMessageResponse{ID: messageId}, nil
 }
 
-func (c *ChatService) GetChats(chats view.ChatsRequest) (view.ChatsResponse, error) {
-	var chatsView []view.Chat
+func (c *ChatService) UpdateChat(update view.UpdateChatRequest) (view.Chat, error) {
+	chat, err := c.findChat(update.ChatID)
+	if err != nil {
+		return view.Chat{}, err
+	}
+
+	user, err := c.findUser(update.UserID)
+	if err != nil {
+		return view.Chat{}, err
+	}
+
+	if !isMember(chat, user) {
+		return view.Chat{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	var events []systemMessage
+
+	if update.Name != nil && *update.Name != chat.Name {
+		if *update.Name == "" {
+			return view.Chat{}, errs.New(400, "name must not be empty", nil)
+		}
+
+		chat.Name = *update.Name
+		events = append(events, systemMessage{
+			model.SystemEvent{Event: model.SystemChatRenamed, Name: chat.Name},
+			fmt.Sprintf("%s renamed the chat to %q", user.UserName, chat.Name),
+		})
+	}
+
+	if update.Description != nil && *update.Description != chat.Description {
+		chat.Description = *update.Description
+		events = append(events, chatUpdated("description", fmt.Sprintf("%s changed the chat description", user.UserName)))
+	}
+
+	if update.Avatar != nil && *update.Avatar != chat.Avatar {
+		chat.Avatar = *update.Avatar
+		events = append(events, chatUpdated("avatar", fmt.Sprintf("%s changed the chat avatar", user.UserName)))
+	}
+
+	if update.Public != nil && *update.Public != chat.Public {
+		// Public chats can be joined by anyone, together with their history.
+		if chatOwner(chat) != user.ID {
+			return view.Chat{}, errs.New(403, "only the owner can change who can join the chat", nil)
+		}
+
+		if chat.Direct {
+			return view.Chat{}, errs.New(403, "direct chats can't be made public", nil)
+		}
+
+		chat.Public = *update.Public
+		if chat.Public {
+			events = append(events, chatUpdated("public", fmt.Sprintf("%s made the chat public", user.UserName)))
+		} else {
+			events = append(events, chatUpdated("public", fmt.Sprintf("%s made the chat private", user.UserName)))
+		}
+	}
+
+	if update.RetentionDays != nil && *update.RetentionDays != chat.RetentionDays {
+		if chatOwner(chat) != user.ID {
+			return view.Chat{}, errs.New(403, "only the owner can change message retention", nil)
+		}
+
+		if limit := c.maxChatRetention(); *update.RetentionDays < 0 || *update.RetentionDays > limit {
+			return view.Chat{}, errs.New(400, fmt.Sprintf("retention_days must be between 0 and %d", limit), nil)
+		}
 
-	user, err := c.userRepo.FindUserByID(chats.UserID)
+		chat.RetentionDays = *update.RetentionDays
+		if chat.RetentionDays > 0 {
+			events = append(events, chatUpdated("retention_days", fmt.Sprintf("%s set messages to be deleted after %d days", user.UserName, chat.RetentionDays)))
+		} else {
+			events = append(events, chatUpdated("retention_days", fmt.Sprintf("%s reset message retention to the default", user.UserName)))
+		}
+	}
+
+	if len(events) == 0 {
+		return chatToView(chat, user), nil
+	}
+
+	if err := c.chatRepo.UpdateChat(chat); err != nil {
+		return view.Chat{}, errs.New(500, "internal server error", err)
+	}
+
+	for _, event := range events {
+		if err := c.postSystemMessage(chat, user, event); err != nil {
+			return view.Chat{}, errs.New(500, "internal server error", err)
+		}
+	}
+
+	return chatToView(chat, user), nil
+}
+
+// LeaveChat takes the caller out of the chat. The owner can't leave, they
+// delete the chat instead.
+func (c *ChatService) LeaveChat(request view.LeaveChatRequest) (view.LeaveChatResponse, error) {
+	chat, err := c.findChat(request.ChatID)
+	if err != nil {
+		return view.LeaveChatResponse{}, err
+	}
+
+	user, err := c.findUser(request.UserID)
 	if err != nil {
-		return view.ChatsResponse{}, errs.New(404, "user not found", err)
+		return view.LeaveChatResponse{}, err
 	}
 
+	if !isMember(chat, user) {
+		return view.LeaveChatResponse{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	if chatOwner(chat) == user.ID {
+		return view.LeaveChatResponse{}, errs.New(409, "the owner can't leave the chat", nil)
+	}
+
+	if err := c.chatRepo.RemoveChatMember(chat, user); err != nil {
+		return view.LeaveChatResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	left := systemMessage{
+		model.SystemEvent{Event: model.SystemMemberLeft},
+		fmt.Sprintf("%s left the chat", user.UserName),
+	}
+	if err := c.postSystemMessage(chat, user, left); err != nil {
+		return view.LeaveChatResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	return view.LeaveChatResponse{ID: chat.ID.Hex(), Left: true}, nil
+}
+
+func (c *ChatService) ArchiveChat(archive view.ArchiveChatRequest) (view.ArchiveChatResponse, error) {
+	chat, err := c.findChat(archive.ChatID)
+	if err != nil {
+		return view.ArchiveChatResponse{}, err
+	}
+
+	user, err := c.findUser(archive.UserID)
+	if err != nil {
+		return view.ArchiveChatResponse{}, err
+	}
+
+	if !isMember(chat, user) {
+		return view.ArchiveChatResponse{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	if err := c.chatRepo.SetArchived(chat, user, archive.Archived); err != nil {
+		return view.ArchiveChatResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	return view.ArchiveChatResponse{ID: chat.ID.Hex(), Archived: archive.Archived}, nil
+}
+
+func (c *ChatService) GetChats(chats view.ChatsRequest) (view.ChatsResponse, error) {
+	user, err := c.findUser(chats.UserID)
+	if err != nil {
+		return view.ChatsResponse{}, err
+	}
+
+	return c.getChats(user, chats.IncludeArchived)
+}
+
+func (c *ChatService) getChats(user model.User, includeArchived bool) (view.ChatsResponse, error) {
+	var chatsView []view.Chat
+
+	c.touch(user)
+
 	chatsModel, err := c.chatRepo.FindChats(user)
 	if err != nil {
 		return view.ChatsResponse{}, errs.New(404, "chats not found", err)
 	}
 
+	settingsModel, err := c.chatRepo.FindUserNotificationSettings(user)
+	if err != nil {
+		return view.ChatsResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	settingsByChat := make(map[primitive.ObjectID]model.NotificationSettings, len(settingsModel))
+	for _, settings := range settingsModel {
+		settingsByChat[settings.Chat] = settings
+	}
+
+	draftsModel, err := c.messageRepo.FindUserDrafts(user.ID)
+	if err != nil {
+		return view.ChatsResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	draftsByChat := make(map[primitive.ObjectID]model.Draft, len(draftsModel))
+	for _, draft := range draftsModel {
+		draftsByChat[draft.Chat] = draft
+	}
+
+	var members []primitive.ObjectID
 	for _, chatModel := range chatsModel {
-		var users []view.User
-		for _, user := range chatModel.Users {
-			userView := view.User{
-				ID:       user.ID.Hex(),
-				UserName: user.UserName,
-			}
+		for _, member := range chatModel.Users {
+			members = append(members, member.ID)
+		}
+	}
+	presence := c.findPresence(members)
 
-			users = append(users, userView)
+	for _, chatModel := range chatsModel {
+		if !includeArchived && isArchived(chatModel, user) {
+			continue
+		}
+
+		settings, ok := settingsByChat[chatModel.ID]
+		if !ok {
+			settings = model.NotificationSettings{Mode: model.NotifyAll}
 		}
+		settingsView := settingsToView(settings)
 
-		chatView := view.Chat{
-			ID:        chatModel.ID.Hex(),
-			Name:      chatModel.Name,
-			Users:     users,
-			CreatedAt: chatModel.CreatedAt.Time().String(),
+		chatView := chatToView(chatModel, user)
+		chatView.Notifications = &settingsView
+		if draft, ok := draftsByChat[chatModel.ID]; ok {
+			draftView := draftToView(draft)
+			chatView.Draft = &draftView
+		}
+		for i := range chatView.Users {
+			chatView.Users[i].Presence, chatView.Users[i].LastSeen = c.presenceOf(presence, chatModel.Users[i].ID)
 		}
 
 		chatsView = append(chatsView, chatView)
@@ -122,11 +567,34 @@ func (c *ChatService) GetChats(chats view.ChatsRequest) (view.ChatsResponse, err
 }
 
 func (c *ChatService) GetMessages(chat view.MessagesRequest) (view.MessagesResponse, error) {
+	chatModel, err := c.findChat(chat.СhatID)
+	if err != nil {
+		return view.MessagesResponse{}, err
+	}
+
+	var reader model.User
+	if chat.UserID != "" {
+		reader, err = c.findUser(chat.UserID)
+		if err != nil {
+			return view.MessagesResponse{}, err
+		}
+	}
+
+	return c.getMessages(chatModel, reader, chat.HTML)
+}
+
+// getMessages lists the messages of the chat. Messages of blocked authors
+// are hidden when the reader is known.
+func (c *ChatService) getMessages(chatModel model.Chat, reader model.User, html bool) (view.MessagesResponse, error) {
 	var messagesView []view.Message
 
-	chatModel, err := c.chatRepo.FindChatByID(chat.СhatID)
-	if err != nil {
-		return view.MessagesResponse{}, errs.New(404, "chat not found", err)
+	var blocked map[primitive.ObjectID]bool
+	if !reader.ID.IsZero() {
+		var err error
+		blocked, err = c.blockedAuthors(reader)
+		if err != nil {
+			return view.MessagesResponse{}, errs.New(500, "internal server error", err)
+		}
 	}
 
 	messagesModel, err := c.messageRepo.FindMessages(chatModel)
@@ -134,13 +602,15 @@ func (c *ChatService) GetMessages(chat view.MessagesRequest) (view.MessagesRespo
 		return view.MessagesResponse{}, errs.New(404, "messages not found", err)
 	}
 
+	now := time.Now()
 	for _, messageModel := range messagesModel {
-		messageView := view.Message{
-			ID:        messageModel.ID.Hex(),
-			ChatID:    messageModel.Chat.Hex(),
-			AuthorID:  messageModel.Author.Hex(),
-			Text:      messageModel.Text,
-			CreatedAt: messageModel.CreatedAt.Time().String(),
+		if blocked[messageModel.Author] || isExpired(messageModel, now) {
+			continue
+		}
+
+		messageView := messageToView(messageModel)
+		if html {
+			messageView.HTML = markdown.HTML(messageModel.Text, messageModel.Entities)
 		}
 
 		messagesView = append(messagesView, messageView)
@@ -148,3 +618,200 @@ func (c *ChatService) GetMessages(chat view.MessagesRequest) (view.MessagesRespo
 
 	return messagesView, nil
 }
+
+// systemMessage is a system event together with the text shown by clients
+// that don't know the event.
+type systemMessage struct {
+	event model.SystemEvent
+	text  string
+}
+
+func chatUpdated(field string, text string) systemMessage {
+	return systemMessage{model.SystemEvent{Event: model.SystemChatUpdated, Field: field}, text}
+}
+
+func (c *ChatService) postSystemMessage(chat model.Chat, user model.User, message systemMessage) error {
+	event := message.event
+	_, err := c.messageRepo.InsertMessage(model.Message{
+		Chat:   chat.ID,
+		Author: user.ID,
+		Type:   model.MessageTypeSystem,
+		Text:   message.text,
+		System: &event,
+	})
+
+	return err
+}
+
+func messageToView(message model.Message) view.Message {
+	messageView := view.Message{
+		ID:        message.ID.Hex(),
+		ChatID:    message.Chat.Hex(),
+		AuthorID:  message.Author.Hex(),
+		IsBot:     message.Bot,
+		Type:      messageType(message),
+		Text:      message.Text,
+		CreatedAt: message.CreatedAt.Time().String(),
+	}
+
+	for _, entity := range message.Entities {
+		messageView.Entities = append(messageView.Entities, view.Entity{
+			Type:   entity.Type,
+			Offset: entity.Offset,
+			Length: entity.Length,
+			URL:    entity.URL,
+		})
+	}
+
+	if message.ExpiresAt != 0 {
+		messageView.ExpiresAt = message.ExpiresAt.Time().UTC().Format(time.RFC3339)
+	}
+
+	if message.System != nil {
+		messageView.System = &view.SystemEvent{
+			Event: message.System.Event,
+			Name:  message.System.Name,
+			Field: message.System.Field,
+			Via:   message.System.Via,
+		}
+		if !message.System.By.IsZero() {
+			messageView.System.By = message.System.By.Hex()
+		}
+	}
+
+	if message.Poll != nil {
+		pollView := pollToView(*message.Poll)
+		messageView.Poll = &pollView
+	}
+
+	if message.ForwardedFrom != nil {
+		messageView.ForwardedFrom = &view.ForwardedFrom{
+			MessageID: message.ForwardedFrom.Message.Hex(),
+			ChatID:    message.ForwardedFrom.Chat.Hex(),
+			AuthorID:  message.ForwardedFrom.Author.Hex(),
+		}
+	}
+
+	for _, preview := range message.Previews {
+		messageView.Previews = append(messageView.Previews, view.Preview{
+			URL:         preview.URL,
+			Title:       preview.Title,
+			Description: preview.Description,
+			Image:       preview.Image,
+		})
+	}
+
+	return messageView
+}
+
+// checkTTL accepts 0 for messages that never expire.
+func checkTTL(ttl int64) error {
+	if ttl < 0 || ttl > maxMessageTTL {
+		return errs.New(400, fmt.Sprintf("ttl must be between 0 and %d seconds, 0 for no ttl", maxMessageTTL), nil)
+	}
+
+	return nil
+}
+
+// isExpired tells whether a self-destructing message is past its expiry but
+// not purged yet.
+func isExpired(message model.Message, now time.Time) bool {
+	return message.ExpiresAt != 0 && !message.ExpiresAt.Time().After(now)
+}
+
+// findChat answers 410 Gone for chats whose deletion is still in progress.
+func (c *ChatService) findChat(id string) (model.Chat, error) {
+	chat, err := c.chatRepo.FindChatByID(id)
+	if err == nil {
+		return chat, nil
+	}
+
+	deletion, deletionErr := c.chatRepo.FindChatDeletion(id)
+	if deletionErr == nil && !deletion.Done {
+		return model.Chat{}, errs.New(410, "chat is being deleted", err)
+	}
+
+	return model.Chat{}, errs.New(404, "chat not found", err)
+}
+
+// findUser finds the user a request acts for. Bots act only through the bot
+// API, with their keys, so their IDs are refused.
+func (c *ChatService) findUser(id string) (model.User, error) {
+	user, err := c.userRepo.FindUserByID(id)
+	if err != nil {
+		return model.User{}, errs.New(404, "user not found", err)
+	}
+
+	if user.Bot {
+		return model.User{}, errs.New(403, "bots must use the bot API", nil)
+	}
+
+	return user, nil
+}
+
+func chatToView(chat model.Chat, user model.User) view.Chat {
+	var users []view.User
+	for _, member := range chat.Users {
+		userView := view.User{
+			ID:       member.ID.Hex(),
+			UserName: member.UserName,
+			IsBot:    member.Bot,
+		}
+
+		users = append(users, userView)
+	}
+
+	return view.Chat{
+		ID:          chat.ID.Hex(),
+		Name:        chat.Name,
+		Description: chat.Description,
+		Avatar:      chat.Avatar,
+		Owner:       chatOwner(chat).Hex(),
+		Public:      chat.Public,
+		Direct:      chat.Direct,
+		Users:       users,
+		Archived:    isArchived(chat, user),
+		CreatedAt:   chat.CreatedAt.Time().String(),
+
+		RetentionDays: chat.RetentionDays,
+	}
+}
+
+// chatOwner falls back to the first member for chats created before owners
+// were recorded.
+func chatOwner(chat model.Chat) primitive.ObjectID {
+	if chat.Owner.IsZero() && len(chat.Users) > 0 {
+		return chat.Users[0].ID
+	}
+
+	return chat.Owner
+}
+
+func isMember(chat model.Chat, user model.User) bool {
+	for _, member := range chat.Users {
+		if member.ID == user.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isArchived(chat model.Chat, user model.User) bool {
+	for _, id := range chat.Archived {
+		if id == user.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// messageType treats messages stored before the type field existed as text.
+func messageType(message model.Message) string {
+	if message.Type == "" {
+		return model.MessageTypeText
+	}
+
+	return message.Type
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/flaambe/avito/internal/errs"
 	"github.com/flaambe/avito/internal/model"
@@ -15,6 +16,7 @@ import (
 	"github.com/flaambe/avito/internal/view"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 var (
@@ -48,15 +50,24 @@ func TestMain(m *testing.M) {
 	userRepoMock = new(mocks.UserRepository)
 	userRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
 	userRepoMock.On("InsertUser", userModel.UserName).Return(userModel.ID.Hex(), nil)
+	userRepoMock.On("FindBlocks", userModel).Return([]model.Block{}, nil)
+	userRepoMock.On("FindBlockedBy", mock.Anything).Return([]model.Block{}, nil)
 
 	chatRepoMock = new(mocks.ChatRepository)
 	chatRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
 	chatRepoMock.On("FindChats", userModel).Return([]model.Chat{chatModel}, nil)
-	chatRepoMock.On("InsertChat", chatModel.Name, chatModel.Users).Return(chatModel.ID.Hex(), nil)
+	chatRepoMock.On("InsertChat", chatModel.Name, chatModel.Users, false, false).Return(chatModel.ID.Hex(), nil)
+	chatRepoMock.On("UpdateChat", mock.Anything).Return(nil)
+	chatRepoMock.On("SetArchived", chatModel, userModel, mock.Anything).Return(nil)
+	chatRepoMock.On("FindUserNotificationSettings", userModel).Return([]model.NotificationSettings{}, nil)
 
 	messageRepoMock = new(mocks.MessageRepository)
 	messageRepoMock.On("FindMessages", chatModel).Return([]model.Message{messageModel}, nil)
-	messageRepoMock.On("InsertMessage", chatModel, userModel, messageModel.Text).Return(messageModel.ID.Hex(), nil)
+	messageRepoMock.On("FindUserDrafts", userModel.ID).Return([]model.Draft{}, nil)
+	messageRepoMock.On("InsertMessage", model.Message{Chat: chatModel.ID, Author: userModel.ID, Text: messageModel.Text}).Return(messageModel.ID.Hex(), nil)
+	messageRepoMock.On("InsertMessage", mock.MatchedBy(func(message model.Message) bool {
+		return message.Type == model.MessageTypeSystem && message.Author == userModel.ID
+	})).Return(primitive.NewObjectID().Hex(), nil)
 
 	exitVal := m.Run()
 
@@ -86,6 +97,27 @@ func TestAddUser(t *testing.T) {
 		assert.Equal(500, responseError.Status)
 	}
 	assert.Empty(userResponse.ID)
+
+	userDupRepoMock := new(mocks.UserRepository)
+	userDupRepoMock.On("InsertUser", userModel.UserName).Return("-1", mongo.WriteException{
+		WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key error"}},
+	})
+	testObj = service.NewChatService(userDupRepoMock, chatRepoMock, messageRepoMock)
+	userResponse, err = testObj.AddUser(userRequest)
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(409, responseError.Status)
+	}
+	assert.Empty(userResponse.ID)
+
+	for _, name := range []string{"ab", "with space", "_underscore", "toolong_toolong_toolong_toolong_x"} {
+		userResponse, err = testObj.AddUser(view.NewUserRequest{UserName: name})
+		assert.Error(err)
+		if errors.As(err, &responseError) {
+			assert.Equal(400, responseError.Status)
+		}
+		assert.Empty(userResponse.ID)
+	}
 }
 
 func TestAddChat(t *testing.T) {
@@ -100,6 +132,10 @@ func TestAddChat(t *testing.T) {
 	chatResponse, err := testObj.AddChat(chatRequest)
 	assert.NoError(err)
 	assert.Equal(chatModel.ID.Hex(), chatResponse.ID)
+	messageRepoMock.AssertCalled(t, "InsertMessage", mock.MatchedBy(func(message model.Message) bool {
+		return message.Chat == chatModel.ID && message.Text == `Test created the chat "test_chat"` &&
+			*message.System == model.SystemEvent{Event: model.SystemChatCreated, Name: chatModel.Name}
+	}))
 
 	chatErrRequest := view.NewChatRequest{
 		Name:    chatModel.Name,
@@ -117,7 +153,7 @@ func TestAddChat(t *testing.T) {
 	assert.Equal("", chatResponse.ID)
 
 	chatErrRepoMock := new(mocks.ChatRepository)
-	chatErrRepoMock.On("InsertChat", chatModel.Name, chatModel.Users).Return("", errors.New("internal db error"))
+	chatErrRepoMock.On("InsertChat", chatModel.Name, chatModel.Users, false, false).Return("", errors.New("internal db error"))
 	testObj = service.NewChatService(userRepoMock, chatErrRepoMock, messageRepoMock)
 	chatResponse, err = testObj.AddChat(chatRequest)
 	assert.Error(err)
@@ -125,6 +161,59 @@ func TestAddChat(t *testing.T) {
 		assert.Equal(500, responseError.Status)
 	}
 	assert.Empty(chatResponse.ID)
+
+	// The chat is removed again when its first message can't be stored.
+	chatID := primitive.NewObjectID()
+	chatRollbackRepoMock := new(mocks.ChatRepository)
+	chatRollbackRepoMock.On("InsertChat", chatModel.Name, chatModel.Users, false, false).Return(chatID.Hex(), nil)
+	chatRollbackRepoMock.On("DeleteChat", model.Chat{ID: chatID}).Return(nil)
+	messageErrRepoMock := new(mocks.MessageRepository)
+	messageErrRepoMock.On("InsertMessage", mock.Anything).Return("", errors.New("internal db error"))
+	testObj = service.NewChatService(userRepoMock, chatRollbackRepoMock, messageErrRepoMock)
+	chatResponse, err = testObj.AddChat(chatRequest)
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(500, responseError.Status)
+	}
+	assert.Empty(chatResponse.ID)
+	chatRollbackRepoMock.AssertCalled(t, "DeleteChat", model.Chat{ID: chatID})
+}
+
+func TestAddDirectChat(t *testing.T) {
+	assert := assert.New(t)
+
+	otherModel := model.User{ID: primitive.NewObjectID(), UserName: "Other"}
+	users := []model.User{userModel, otherModel}
+	userDirectRepoMock := new(mocks.UserRepository)
+	userDirectRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userDirectRepoMock.On("FindUserByID", otherModel.ID.Hex()).Return(otherModel, nil)
+	userDirectRepoMock.On("IsBlocked", userModel, otherModel).Return(false, nil)
+	chatDirectRepoMock := new(mocks.ChatRepository)
+	chatDirectRepoMock.On("InsertChat", "pair", users, false, true).Return(primitive.NewObjectID().Hex(), nil)
+	chatDirectRepoMock.On("InsertChat", "pair", users, false, false).Return(primitive.NewObjectID().Hex(), nil)
+	testObj := service.NewChatService(userDirectRepoMock, chatDirectRepoMock, messageRepoMock)
+
+	usersID := []string{userModel.ID.Hex(), otherModel.ID.Hex()}
+	_, err := testObj.AddChat(view.NewChatRequest{Name: "pair", UsersID: usersID, Direct: true})
+	assert.NoError(err)
+	chatDirectRepoMock.AssertCalled(t, "InsertChat", "pair", users, false, true)
+
+	// Two users alone don't make a chat direct.
+	_, err = testObj.AddChat(view.NewChatRequest{Name: "pair", UsersID: usersID})
+	assert.NoError(err)
+	chatDirectRepoMock.AssertCalled(t, "InsertChat", "pair", users, false, false)
+
+	var responseError *errs.ResponseError
+	for _, request := range []view.NewChatRequest{
+		{Name: "pair", UsersID: usersID, Public: true, Direct: true},
+		{Name: "pair", UsersID: usersID[:1], Direct: true},
+	} {
+		_, err = testObj.AddChat(request)
+		assert.Error(err)
+		if errors.As(err, &responseError) {
+			assert.Equal(400, responseError.Status)
+		}
+	}
 }
 
 func TestAddMessage(t *testing.T) {
@@ -143,9 +232,11 @@ func TestAddMessage(t *testing.T) {
 
 	newMessageErrRequest := view.NewMessageRequest{
 		ChatID: "incorrect id",
+		UserID: userModel.ID.Hex(),
 	}
 	chatErrRepoMock := new(mocks.ChatRepository)
 	chatErrRepoMock.On("FindChatByID", "incorrect id").Return(model.Chat{}, errors.New("incorrect id"))
+	chatErrRepoMock.On("FindChatDeletion", "incorrect id").Return(model.ChatDeletion{}, errors.New("incorrect id"))
 	testObj = service.NewChatService(userRepoMock, chatErrRepoMock, messageRepoMock)
 	messageResponse, err = testObj.AddMessage(newMessageErrRequest)
 	assert.Error(err)
@@ -175,7 +266,7 @@ func TestAddMessage(t *testing.T) {
 		Text:   messageModel.Text,
 	}
 	messageErrRepoMock := new(mocks.MessageRepository)
-	messageErrRepoMock.On("InsertMessage", chatModel, userModel, messageModel.Text).Return("", errors.New("internal db error"))
+	messageErrRepoMock.On("InsertMessage", model.Message{Chat: chatModel.ID, Author: userModel.ID, Text: messageModel.Text}).Return("", errors.New("internal db error"))
 	testObj = service.NewChatService(userRepoMock, chatRepoMock, messageErrRepoMock)
 	messageResponse, err = testObj.AddMessage(newMessageErrRequest)
 	assert.Error(err)
@@ -185,6 +276,287 @@ func TestAddMessage(t *testing.T) {
 	assert.Empty(messageResponse)
 }
 
+func TestAddEphemeralMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	var inserted model.Message
+	messageTTLRepoMock := new(mocks.MessageRepository)
+	messageTTLRepoMock.On("InsertMessage", mock.Anything).Return(messageModel.ID.Hex(), nil).Run(func(args mock.Arguments) {
+		inserted = args.Get(0).(model.Message)
+	})
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageTTLRepoMock)
+
+	messageRequest := view.NewMessageRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		Text:   messageModel.Text,
+		TTL:    60,
+	}
+
+	_, err := testObj.AddMessage(messageRequest)
+	assert.NoError(err)
+	assert.WithinDuration(time.Now().Add(time.Minute), inserted.ExpiresAt.Time(), 5*time.Second)
+
+	messageRequest.TTL = -1
+	_, err = testObj.AddMessage(messageRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+}
+
+func TestAddFormattedMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	messageFormatRepoMock := new(mocks.MessageRepository)
+	messageFormatRepoMock.On("InsertMessage", mock.Anything).Return(messageModel.ID.Hex(), nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageFormatRepoMock)
+
+	_, err := testObj.AddMessage(view.NewMessageRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		Text:   "**Release** is [out](https://example.com)",
+	})
+	assert.NoError(err)
+	messageFormatRepoMock.AssertCalled(t, "InsertMessage", model.Message{
+		Chat:   chatModel.ID,
+		Author: userModel.ID,
+		Text:   "Release is out",
+		Entities: []model.Entity{
+			{Type: model.EntityBold, Offset: 0, Length: 7},
+			{Type: model.EntityLink, Offset: 11, Length: 3, URL: "https://example.com"},
+		},
+	})
+}
+
+func TestUpdateChat(t *testing.T) {
+	assert := assert.New(t)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageRepoMock)
+
+	name := "renamed_chat"
+	description := "Test description"
+	updateRequest := view.UpdateChatRequest{
+		ChatID:      chatModel.ID.Hex(),
+		UserID:      userModel.ID.Hex(),
+		Name:        &name,
+		Description: &description,
+	}
+
+	chatResponse, err := testObj.UpdateChat(updateRequest)
+	assert.NoError(err)
+	assert.Equal(name, chatResponse.Name)
+	assert.Equal(description, chatResponse.Description)
+	messageRepoMock.AssertCalled(t, "InsertMessage", mock.MatchedBy(func(message model.Message) bool {
+		return message.Text == `Test renamed the chat to "renamed_chat"` &&
+			*message.System == model.SystemEvent{Event: model.SystemChatRenamed, Name: "renamed_chat"}
+	}))
+	messageRepoMock.AssertCalled(t, "InsertMessage", mock.MatchedBy(func(message model.Message) bool {
+		return message.Text == "Test changed the chat description" &&
+			*message.System == model.SystemEvent{Event: model.SystemChatUpdated, Field: "description"}
+	}))
+
+	empty := ""
+	updateErrRequest := view.UpdateChatRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		Name:   &empty,
+	}
+	chatResponse, err = testObj.UpdateChat(updateErrRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+	assert.Empty(chatResponse)
+
+	strangerModel := model.User{ID: primitive.NewObjectID(), UserName: "Stranger"}
+	userStrangerRepoMock := new(mocks.UserRepository)
+	userStrangerRepoMock.On("FindUserByID", strangerModel.ID.Hex()).Return(strangerModel, nil)
+	testObj = service.NewChatService(userStrangerRepoMock, chatRepoMock, messageRepoMock)
+	updateErrRequest = view.UpdateChatRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: strangerModel.ID.Hex(),
+		Name:   &name,
+	}
+	chatResponse, err = testObj.UpdateChat(updateErrRequest)
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	assert.Empty(chatResponse)
+
+	// Only the owner makes a chat public.
+	memberModel := model.User{ID: primitive.NewObjectID(), UserName: "Member"}
+	groupChatModel := model.Chat{ID: primitive.NewObjectID(), Users: []model.User{userModel, memberModel, strangerModel}}
+	userStrangerRepoMock.On("FindUserByID", memberModel.ID.Hex()).Return(memberModel, nil)
+	chatGroupRepoMock := new(mocks.ChatRepository)
+	chatGroupRepoMock.On("FindChatByID", groupChatModel.ID.Hex()).Return(groupChatModel, nil)
+	testObj = service.NewChatService(userStrangerRepoMock, chatGroupRepoMock, messageRepoMock)
+	public := true
+	chatResponse, err = testObj.UpdateChat(view.UpdateChatRequest{ChatID: groupChatModel.ID.Hex(), UserID: memberModel.ID.Hex(), Public: &public})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	assert.Empty(chatResponse)
+	chatGroupRepoMock.AssertNotCalled(t, "UpdateChat", mock.Anything)
+
+	chatErrRepoMock := new(mocks.ChatRepository)
+	chatErrRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatErrRepoMock.On("UpdateChat", mock.Anything).Return(errors.New("internal db error"))
+	testObj = service.NewChatService(userRepoMock, chatErrRepoMock, messageRepoMock)
+	chatResponse, err = testObj.UpdateChat(updateRequest)
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(500, responseError.Status)
+	}
+	assert.Empty(chatResponse)
+}
+
+func TestLeaveChat(t *testing.T) {
+	assert := assert.New(t)
+
+	memberModel := model.User{ID: primitive.NewObjectID(), UserName: "Member"}
+	groupChatModel := model.Chat{
+		ID:    primitive.NewObjectID(),
+		Name:  "group_chat",
+		Users: []model.User{userModel, memberModel},
+	}
+	userLeaveRepoMock := new(mocks.UserRepository)
+	userLeaveRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userLeaveRepoMock.On("FindUserByID", memberModel.ID.Hex()).Return(memberModel, nil)
+	chatLeaveRepoMock := new(mocks.ChatRepository)
+	chatLeaveRepoMock.On("FindChatByID", groupChatModel.ID.Hex()).Return(groupChatModel, nil)
+	chatLeaveRepoMock.On("RemoveChatMember", groupChatModel, memberModel).Return(nil)
+	messageLeaveRepoMock := new(mocks.MessageRepository)
+	messageLeaveRepoMock.On("InsertMessage", mock.Anything).Return(primitive.NewObjectID().Hex(), nil)
+	testObj := service.NewChatService(userLeaveRepoMock, chatLeaveRepoMock, messageLeaveRepoMock)
+
+	leaveResponse, err := testObj.LeaveChat(view.LeaveChatRequest{ChatID: groupChatModel.ID.Hex(), UserID: memberModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(view.LeaveChatResponse{ID: groupChatModel.ID.Hex(), Left: true}, leaveResponse)
+	messageLeaveRepoMock.AssertCalled(t, "InsertMessage", model.Message{
+		Chat:   groupChatModel.ID,
+		Author: memberModel.ID,
+		Type:   model.MessageTypeSystem,
+		Text:   "Member left the chat",
+		System: &model.SystemEvent{Event: model.SystemMemberLeft},
+	})
+
+	leaveResponse, err = testObj.LeaveChat(view.LeaveChatRequest{ChatID: groupChatModel.ID.Hex(), UserID: userModel.ID.Hex()})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(409, responseError.Status)
+	}
+	assert.Empty(leaveResponse)
+}
+
+func TestArchiveChat(t *testing.T) {
+	assert := assert.New(t)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageRepoMock)
+
+	archiveRequest := view.ArchiveChatRequest{
+		ChatID:   chatModel.ID.Hex(),
+		UserID:   userModel.ID.Hex(),
+		Archived: true,
+	}
+
+	archiveResponse, err := testObj.ArchiveChat(archiveRequest)
+	assert.NoError(err)
+	assert.Equal(chatModel.ID.Hex(), archiveResponse.ID)
+	assert.True(archiveResponse.Archived)
+	chatRepoMock.AssertCalled(t, "SetArchived", chatModel, userModel, true)
+
+	archivedChatModel := chatModel
+	archivedChatModel.Archived = []primitive.ObjectID{userModel.ID}
+	chatArchivedRepoMock := new(mocks.ChatRepository)
+	chatArchivedRepoMock.On("FindChats", userModel).Return([]model.Chat{archivedChatModel}, nil)
+	chatArchivedRepoMock.On("FindUserNotificationSettings", userModel).Return([]model.NotificationSettings{}, nil)
+	testObj = service.NewChatService(userRepoMock, chatArchivedRepoMock, messageRepoMock)
+
+	chatsResponse, err := testObj.GetChats(view.ChatsRequest{UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Empty(chatsResponse)
+
+	chatsResponse, err = testObj.GetChats(view.ChatsRequest{UserID: userModel.ID.Hex(), IncludeArchived: true})
+	assert.NoError(err)
+	assert.Len(chatsResponse, 1)
+	assert.True(chatsResponse[0].Archived)
+
+	chatErrRepoMock := new(mocks.ChatRepository)
+	chatErrRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatErrRepoMock.On("SetArchived", chatModel, userModel, true).Return(errors.New("internal db error"))
+	testObj = service.NewChatService(userRepoMock, chatErrRepoMock, messageRepoMock)
+	archiveResponse, err = testObj.ArchiveChat(archiveRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(500, responseError.Status)
+	}
+	assert.Empty(archiveResponse)
+}
+
+func TestGetExpiringMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	expiringModel := messageModel
+	expiringModel.ID = primitive.NewObjectID()
+	expiringModel.ExpiresAt = primitive.NewDateTimeFromTime(time.Now().Add(time.Hour))
+	expiredModel := messageModel
+	expiredModel.ID = primitive.NewObjectID()
+	expiredModel.ExpiresAt = primitive.NewDateTimeFromTime(time.Now().Add(-time.Second))
+	messageTTLRepoMock := new(mocks.MessageRepository)
+	messageTTLRepoMock.On("FindMessages", chatModel).Return([]model.Message{expiringModel, expiredModel}, nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageTTLRepoMock)
+
+	messagesResponse, err := testObj.GetMessages(view.MessagesRequest{СhatID: chatModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Len(messagesResponse, 1)
+	assert.Equal(expiringModel.ID.Hex(), messagesResponse[0].ID)
+	assert.Equal(expiringModel.ExpiresAt.Time().UTC().Format(time.RFC3339), messagesResponse[0].ExpiresAt)
+}
+
+func TestGetSystemMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	systemModel := messageModel
+	systemModel.Type = model.MessageTypeSystem
+	systemModel.Text = `Test renamed the chat to "renamed_chat"`
+	systemModel.System = &model.SystemEvent{Event: model.SystemChatRenamed, Name: "renamed_chat"}
+	messageSystemRepoMock := new(mocks.MessageRepository)
+	messageSystemRepoMock.On("FindMessages", chatModel).Return([]model.Message{systemModel}, nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageSystemRepoMock)
+
+	messagesResponse, err := testObj.GetMessages(view.MessagesRequest{СhatID: chatModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(model.MessageTypeSystem, messagesResponse[0].Type)
+	assert.Equal(systemModel.Text, messagesResponse[0].Text)
+	assert.Equal(&view.SystemEvent{Event: model.SystemChatRenamed, Name: "renamed_chat"}, messagesResponse[0].System)
+}
+
+func TestGetFormattedMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	formattedModel := messageModel
+	formattedModel.Text = "Release <3"
+	formattedModel.Entities = []model.Entity{{Type: model.EntityBold, Offset: 0, Length: 7}}
+	messageFormatRepoMock := new(mocks.MessageRepository)
+	messageFormatRepoMock.On("FindMessages", chatModel).Return([]model.Message{formattedModel}, nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageFormatRepoMock)
+
+	messagesResponse, err := testObj.GetMessages(view.MessagesRequest{СhatID: chatModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal("Release <3", messagesResponse[0].Text)
+	assert.Equal([]view.Entity{{Type: model.EntityBold, Offset: 0, Length: 7}}, messagesResponse[0].Entities)
+	assert.Empty(messagesResponse[0].HTML)
+
+	messagesResponse, err = testObj.GetMessages(view.MessagesRequest{СhatID: chatModel.ID.Hex(), HTML: true})
+	assert.NoError(err)
+	assert.Equal("<strong>Release</strong> &lt;3", messagesResponse[0].HTML)
+}
+
 func TestGetChats(t *testing.T) {
 	assert := assert.New(t)
 	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageRepoMock)
@@ -206,6 +578,7 @@ func TestGetChats(t *testing.T) {
 	assert.Equal(chatModel.Name, chatsResponse[0].Name)
 	assert.Equal(usersView, chatsResponse[0].Users)
 	assert.Equal(chatModel.CreatedAt.Time().String(), chatsResponse[0].CreatedAt)
+	assert.Equal(&view.NotificationSettings{Mode: model.NotifyAll}, chatsResponse[0].Notifications)
 
 	chatsErrRequest := view.ChatsRequest{
 		UserID: "incorrect id",
@@ -246,6 +619,7 @@ func TestGetMessages(t *testing.T) {
 	assert.Equal(messageModel.ID.Hex(), messagesResponse[0].ID)
 	assert.Equal(messageModel.Chat.Hex(), messagesResponse[0].ChatID)
 	assert.Equal(messageModel.Author.Hex(), messagesResponse[0].AuthorID)
+	assert.Equal(model.MessageTypeText, messagesResponse[0].Type)
 	assert.Equal(messageModel.Text, messagesResponse[0].Text)
 	assert.Equal(messageModel.CreatedAt.Time().String(), messagesResponse[0].CreatedAt)
 
@@ -254,6 +628,7 @@ func TestGetMessages(t *testing.T) {
 	}
 	chatErrRepoMock := new(mocks.ChatRepository)
 	chatErrRepoMock.On("FindChatByID", "incorrect id").Return(model.Chat{}, errors.New("incorrect id"))
+	chatErrRepoMock.On("FindChatDeletion", "incorrect id").Return(model.ChatDeletion{}, errors.New("incorrect id"))
 	testObj = service.NewChatService(userRepoMock, chatErrRepoMock, messageRepoMock)
 	messagesResponse, err = testObj.GetMessages(messagesErrRequest)
 	assert.Error(err)
@@ -0,0 +1,601 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/markdown"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	maxBotCommands        = 50
+	maxCommandUsage       = 100
+	maxCommandDescription = 200
+
+	// commandCallTTL is how long a bot can answer a command call.
+	commandCallTTL = 15 * time.Minute
+)
+
+var (
+	// commandPattern matches "/name" or "/name@bot" followed by the arguments.
+	commandPattern = regexp.MustCompile(`^/([a-z][a-z0-9_]{0,31})(?:@([A-Za-z0-9][A-Za-z0-9_.-]{2,31}))?(?:\s+|$)`)
+	commandName    = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+)
+
+// builtinCommands are run by the chat itself. Bots can't serve commands with
+// these names.
+var builtinCommands = []model.Command{
+	{Name: "help", Usage: "[command]", Description: "List the commands of the chat"},
+	{Name: "me", Usage: "<action>", Description: "Post an action, such as /me waves"},
+	{Name: "topic", Usage: "[topic]", Description: "Show or change the topic of the chat"},
+	{Name: "invite", Usage: "@user...", Description: "Add users to the chat, for its owner"},
+}
+
+// commandCall is a slash command parsed from the text of a message. Bot is
+// set when the command names the bot that serves it, as in /weather@forecast.
+type commandCall struct {
+	name string
+	bot  string
+	args []string
+	text string
+}
+
+// botCommand is a command served by a bot member of the chat.
+type botCommand struct {
+	bot     model.User
+	command model.Command
+}
+
+// GetCommands lists the commands the user can run in the chat, for clients
+// to complete them.
+func (c *ChatService) GetCommands(request view.CommandsRequest) (view.CommandsResponse, error) {
+	chat, _, err := c.findCommandChat(request.ChatID, request.UserID)
+	if err != nil {
+		return view.CommandsResponse{}, err
+	}
+
+	commands, err := c.chatCommands(chat)
+	if err != nil {
+		return view.CommandsResponse{}, err
+	}
+
+	commandsView := view.CommandsResponse{}
+	for _, command := range builtinCommands {
+		commandsView = append(commandsView, commandToView(command))
+	}
+
+	for _, command := range commands {
+		commandView := commandToView(command.command)
+		commandView.BotID = command.bot.ID.Hex()
+		commandsView = append(commandsView, commandView)
+	}
+
+	return commandsView, nil
+}
+
+// SetBotCommands replaces the slash commands served by the bot that owns the
+// API key.
+func (c *ChatService) SetBotCommands(key string, request view.BotCommandsRequest) (view.CommandsResponse, error) {
+	bot, err := c.findBot(key)
+	if err != nil {
+		return view.CommandsResponse{}, err
+	}
+
+	if len(request.Commands) > maxBotCommands {
+		return view.CommandsResponse{}, errs.New(400, fmt.Sprintf("a bot can serve at most %d commands", maxBotCommands), nil)
+	}
+
+	commands := make([]model.Command, 0, len(request.Commands))
+	names := map[string]bool{}
+	for _, command := range request.Commands {
+		if !commandName.MatchString(command.Name) {
+			return view.CommandsResponse{}, errs.New(400, "command names must be 1 to 32 lowercase letters, digits or '_' and start with a letter", nil)
+		}
+
+		if isBuiltinCommand(command.Name) {
+			return view.CommandsResponse{}, errs.New(400, fmt.Sprintf("/%s is a built-in command", command.Name), nil)
+		}
+
+		if names[command.Name] {
+			return view.CommandsResponse{}, errs.New(400, fmt.Sprintf("/%s is listed twice", command.Name), nil)
+		}
+		names[command.Name] = true
+
+		if len(command.Usage) > maxCommandUsage {
+			return view.CommandsResponse{}, errs.New(400, fmt.Sprintf("usage must be at most %d characters", maxCommandUsage), nil)
+		}
+
+		if command.Description == "" || len(command.Description) > maxCommandDescription {
+			return view.CommandsResponse{}, errs.New(400, fmt.Sprintf("description must be 1 to %d characters", maxCommandDescription), nil)
+		}
+
+		commands = append(commands, model.Command{
+			Name:        command.Name,
+			Usage:       command.Usage,
+			Description: command.Description,
+		})
+	}
+
+	if err := c.userRepo.SetBotCommands(bot.ID, commands); err != nil {
+		return view.CommandsResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	commandsView := view.CommandsResponse{}
+	for _, command := range commands {
+		commandsView = append(commandsView, commandToView(command))
+	}
+
+	return commandsView, nil
+}
+
+// BotRespondCommand answers a command call handed to the bot, until the call
+// expires. An ephemeral answer is delivered to the user who ran the command
+// only, through their events, and is never stored.
+func (c *ChatService) BotRespondCommand(key string, request view.BotCommandResponse) (view.NewMessageResponse, error) {
+	bot, err := c.findBot(key)
+	if err != nil {
+		return view.NewMessageResponse{}, err
+	}
+
+	call, err := c.chatRepo.FindCommandCall(request.CallID)
+	if err != nil || call.Bot != bot.ID {
+		return view.NewMessageResponse{}, errs.New(404, "command call not found", err)
+	}
+
+	chat, err := c.findChat(call.Chat.Hex())
+	if err != nil {
+		return view.NewMessageResponse{}, err
+	}
+
+	if !isMember(chat, bot) {
+		return view.NewMessageResponse{}, errs.New(403, "bot is not a member of the chat", nil)
+	}
+
+	if !request.Ephemeral {
+		return c.addMessage(view.NewMessageRequest{
+			ChatID: chat.ID.Hex(),
+			UserID: bot.ID.Hex(),
+			Text:   request.Text,
+		}, primitive.NilObjectID)
+	}
+
+	if c.events == nil {
+		return view.NewMessageResponse{}, errs.New(503, "ephemeral messages are not available", nil)
+	}
+
+	if request.Text == "" {
+		return view.NewMessageResponse{}, errs.New(400, "text must not be empty", nil)
+	}
+
+	user, err := c.userRepo.FindUserByID(call.User.Hex())
+	if err != nil {
+		return view.NewMessageResponse{}, errs.New(404, "user not found", err)
+	}
+
+	if !isMember(chat, user) {
+		return view.NewMessageResponse{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	message := ephemeralMessage(chat, bot, request.Text)
+	c.events.Publish([]primitive.ObjectID{user.ID}, model.Event{
+		Type:      model.EventEphemeral,
+		Chat:      chat.ID,
+		User:      bot.ID,
+		Message:   &message,
+		ExpiresAt: time.Now().Add(messageEventTTL),
+	})
+
+	messageView := messageToView(message)
+	return view.NewMessageResponse{Ephemeral: &messageView}, nil
+}
+
+// parseCommand reads the slash command the text starts with. Text such as
+// "/usr/bin" or "/ hi" is not a command.
+func parseCommand(text string) (commandCall, bool) {
+	match := commandPattern.FindStringSubmatch(text)
+	if match == nil {
+		return commandCall{}, false
+	}
+
+	rest := strings.TrimSpace(text[len(match[0]):])
+
+	return commandCall{
+		name: match[1],
+		bot:  match[2],
+		args: splitArgs(rest),
+		text: rest,
+	}, true
+}
+
+// splitArgs splits the arguments on spaces. Double quotes group words into
+// one argument.
+func splitArgs(text string) []string {
+	var args []string
+	var arg strings.Builder
+	quoted, started := false, false
+
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case unicode.IsSpace(r) && !quoted:
+			if started {
+				args = append(args, arg.String())
+				arg.Reset()
+				started = false
+			}
+		default:
+			arg.WriteRune(r)
+			started = true
+		}
+	}
+
+	if started {
+		args = append(args, arg.String())
+	}
+
+	return args
+}
+
+// runCommand runs a built-in command or hands the command to the bot that
+// serves it. Mistakes are answered with an ephemeral message instead of an
+// error, so that the caller sees them next to what they typed.
+func (c *ChatService) runCommand(message view.NewMessageRequest, call commandCall) (view.NewMessageResponse, error) {
+	chat, user, err := c.findCommandChat(message.ChatID, message.UserID)
+	if err != nil {
+		return view.NewMessageResponse{}, err
+	}
+
+	c.touch(user)
+
+	if call.bot == "" {
+		switch call.name {
+		case "help":
+			return c.helpCommand(chat, call)
+		case "me":
+			return c.meCommand(chat, user, call, message.TTL)
+		case "topic":
+			return c.topicCommand(chat, user, call)
+		case "invite":
+			return c.inviteCommand(chat, user, call)
+		}
+	}
+
+	commands, err := c.chatCommands(chat)
+	if err != nil {
+		return view.NewMessageResponse{}, err
+	}
+
+	var matches []botCommand
+	for _, command := range commands {
+		if command.command.Name != call.name {
+			continue
+		}
+
+		if call.bot != "" && !strings.EqualFold(command.bot.UserName, call.bot) {
+			continue
+		}
+
+		matches = append(matches, command)
+	}
+
+	switch len(matches) {
+	case 0:
+		return ephemeralResponse(chat, fmt.Sprintf("Unknown command `/%s`. Type `/help` to see the commands of the chat.", call.name)), nil
+	case 1:
+		return view.NewMessageResponse{}, c.invokeCommand(chat, user, matches[0].bot, call)
+	default:
+		return ephemeralResponse(chat, fmt.Sprintf("Several bots serve `/%s`, name one as in `/%s@%s`.", call.name, call.name, matches[0].bot.UserName)), nil
+	}
+}
+
+func (c *ChatService) helpCommand(chat model.Chat, call commandCall) (view.NewMessageResponse, error) {
+	commands, err := c.chatCommands(chat)
+	if err != nil {
+		return view.NewMessageResponse{}, err
+	}
+
+	// Commands served by several bots are listed with the bot to name.
+	served := map[string]int{}
+	for _, command := range commands {
+		served[command.command.Name]++
+	}
+
+	var lines []string
+	for _, command := range builtinCommands {
+		lines = append(lines, commandHelp(command, ""))
+	}
+
+	for _, command := range commands {
+		bot := ""
+		if served[command.command.Name] > 1 {
+			bot = command.bot.UserName
+		}
+		lines = append(lines, commandHelp(command.command, bot))
+	}
+
+	if len(call.args) > 0 {
+		name := strings.TrimPrefix(call.args[0], "/")
+		var matching []string
+		for i, command := range builtinCommands {
+			if command.Name == name {
+				matching = append(matching, lines[i])
+			}
+		}
+		for i, command := range commands {
+			if command.command.Name == name {
+				matching = append(matching, lines[len(builtinCommands)+i])
+			}
+		}
+
+		if len(matching) == 0 {
+			return ephemeralResponse(chat, fmt.Sprintf("Unknown command `/%s`. Type `/help` to see the commands of the chat.", name)), nil
+		}
+		lines = matching
+	} else {
+		lines = append([]string{"Commands of the chat:"}, lines...)
+	}
+
+	return ephemeralResponse(chat, strings.Join(lines, "\n")), nil
+}
+
+// meCommand posts an action. Clients that don't know actions still show the
+// text, which starts with the name of the user.
+func (c *ChatService) meCommand(chat model.Chat, user model.User, call commandCall, ttl int64) (view.NewMessageResponse, error) {
+	if call.text == "" {
+		return ephemeralResponse(chat, "Usage: `/me <action>`"), nil
+	}
+
+	return c.postMessage(view.NewMessageRequest{
+		ChatID: chat.ID.Hex(),
+		UserID: user.ID.Hex(),
+		Text:   user.UserName + " " + call.text,
+		TTL:    ttl,
+	}, primitive.NilObjectID, model.MessageTypeAction)
+}
+
+// topicCommand shows the description of the chat, or changes it when given
+// a new one.
+func (c *ChatService) topicCommand(chat model.Chat, user model.User, call commandCall) (view.NewMessageResponse, error) {
+	if call.text == "" {
+		if chat.Description == "" {
+			return ephemeralResponse(chat, "The chat has no topic."), nil
+		}
+
+		return ephemeralResponse(chat, "Topic: "+chat.Description), nil
+	}
+
+	_, err := c.UpdateChat(view.UpdateChatRequest{
+		ChatID:      chat.ID.Hex(),
+		UserID:      user.ID.Hex(),
+		Description: &call.text,
+	})
+	if err != nil {
+		return view.NewMessageResponse{}, err
+	}
+
+	return view.NewMessageResponse{}, nil
+}
+
+// inviteCommand lets the owner add users to the chat by username. Users that
+// can't be added are listed in an ephemeral answer. Other members share
+// invite links instead.
+func (c *ChatService) inviteCommand(chat model.Chat, user model.User, call commandCall) (view.NewMessageResponse, error) {
+	if chat.Direct {
+		return ephemeralResponse(chat, "Users can't be added to a direct chat."), nil
+	}
+
+	if chatOwner(chat) != user.ID {
+		return ephemeralResponse(chat, "Only the owner can add users to the chat. Share an invite link instead."), nil
+	}
+
+	if len(call.args) == 0 {
+		return ephemeralResponse(chat, "Usage: `/invite @user...`"), nil
+	}
+
+	var problems []string
+	for _, arg := range call.args {
+		name := strings.TrimPrefix(arg, "@")
+
+		// Usernames sort before the longer ones they are a prefix of.
+		found, err := c.userRepo.SearchUsers(name, 1)
+		if err != nil {
+			return view.NewMessageResponse{}, errs.New(500, "internal server error", err)
+		}
+
+		if name == "" || len(found) == 0 || !strings.EqualFold(found[0].UserName, name) {
+			problems = append(problems, fmt.Sprintf("`%s` not found.", arg))
+			continue
+		}
+		invitee := found[0]
+
+		if isMember(chat, invitee) {
+			problems = append(problems, fmt.Sprintf("`%s` is already a member.", invitee.UserName))
+			continue
+		}
+
+		blocked, err := c.userRepo.IsBlocked(invitee, user)
+		if err != nil {
+			return view.NewMessageResponse{}, errs.New(500, "internal server error", err)
+		}
+
+		if blocked {
+			problems = append(problems, fmt.Sprintf("`%s` can't be added by you.", invitee.UserName))
+			continue
+		}
+
+		chat, err = c.addMember(chat, invitee, systemMessage{
+			model.SystemEvent{Event: model.SystemMemberJoined, Via: "added", By: user.ID},
+			fmt.Sprintf("%s added %s to the chat", user.UserName, invitee.UserName),
+		})
+		if err != nil {
+			return view.NewMessageResponse{}, err
+		}
+	}
+
+	if len(problems) > 0 {
+		return ephemeralResponse(chat, strings.Join(problems, "\n")), nil
+	}
+
+	return view.NewMessageResponse{}, nil
+}
+
+// invokeCommand records the call and hands it to the bot through its events
+// and its webhooks. The bot answers with BotRespondCommand.
+func (c *ChatService) invokeCommand(chat model.Chat, user model.User, bot model.User, call commandCall) error {
+	callModel := model.CommandCall{
+		Chat:      chat.ID,
+		User:      user.ID,
+		Bot:       bot.ID,
+		Name:      call.name,
+		Args:      call.args,
+		Text:      call.text,
+		ExpiresAt: primitive.NewDateTimeFromTime(time.Now().Add(commandCallTTL)),
+	}
+
+	callID, err := c.chatRepo.InsertCommandCall(callModel)
+	if err != nil {
+		return errs.New(500, "internal server error", err)
+	}
+	callModel.ID, _ = primitive.ObjectIDFromHex(callID)
+
+	if c.events != nil {
+		c.events.Publish([]primitive.ObjectID{bot.ID}, model.Event{
+			Type:      model.EventCommand,
+			Chat:      chat.ID,
+			User:      user.ID,
+			Command:   &callModel,
+			ExpiresAt: time.Now().Add(messageEventTTL),
+		})
+	}
+
+	c.notifyBot(bot, model.WebhookCommandInvoked, commandCallToView(callModel))
+
+	return nil
+}
+
+// chatCommands lists the commands served by the bot members of the chat.
+func (c *ChatService) chatCommands(chat model.Chat) ([]botCommand, error) {
+	var ids []primitive.ObjectID
+	for _, member := range chat.Users {
+		if member.Bot {
+			ids = append(ids, member.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	bots, err := c.userRepo.FindUsersByIDs(ids)
+	if err != nil {
+		return nil, errs.New(500, "internal server error", err)
+	}
+
+	var commands []botCommand
+	for _, bot := range bots {
+		for _, command := range bot.Commands {
+			commands = append(commands, botCommand{bot, command})
+		}
+	}
+
+	return commands, nil
+}
+
+func (c *ChatService) findCommandChat(chatID string, userID string) (model.Chat, model.User, error) {
+	chat, err := c.findChat(chatID)
+	if err != nil {
+		return model.Chat{}, model.User{}, err
+	}
+
+	user, err := c.findUser(userID)
+	if err != nil {
+		return model.Chat{}, model.User{}, err
+	}
+
+	if !isMember(chat, user) {
+		return model.Chat{}, model.User{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	return chat, user, nil
+}
+
+func isBuiltinCommand(name string) bool {
+	for _, command := range builtinCommands {
+		if command.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ephemeralMessage builds an answer shown to one user only. It gets an ID
+// so that clients can tell answers apart, but it is never stored.
+func ephemeralMessage(chat model.Chat, author model.User, text string) model.Message {
+	message := model.Message{
+		ID:        primitive.NewObjectID(),
+		Chat:      chat.ID,
+		Author:    author.ID,
+		Bot:       author.Bot,
+		Type:      model.MessageTypeEphemeral,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+	message.Text, message.Entities = markdown.Parse(text)
+
+	return message
+}
+
+// ephemeralResponse answers a built-in command. The answer has no author.
+func ephemeralResponse(chat model.Chat, text string) view.NewMessageResponse {
+	messageView := messageToView(ephemeralMessage(chat, model.User{}, text))
+	messageView.AuthorID = ""
+
+	return view.NewMessageResponse{Ephemeral: &messageView}
+}
+
+func commandHelp(command model.Command, bot string) string {
+	name := "/" + command.Name
+	if bot != "" {
+		name += "@" + bot
+	}
+
+	if command.Usage != "" {
+		name += " " + command.Usage
+	}
+
+	return fmt.Sprintf("`%s` %s", name, command.Description)
+}
+
+func commandToView(command model.Command) view.Command {
+	return view.Command{
+		Name:        command.Name,
+		Usage:       command.Usage,
+		Description: command.Description,
+	}
+}
+
+func commandCallToView(call model.CommandCall) view.CommandCall {
+	args := call.Args
+	if args == nil {
+		args = []string{}
+	}
+
+	return view.CommandCall{
+		ID:      call.ID.Hex(),
+		Command: call.Name,
+		Args:    args,
+		Text:    call.Text,
+		ChatID:  call.Chat.Hex(),
+		UserID:  call.User.Hex(),
+	}
+}
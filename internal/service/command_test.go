@@ -0,0 +1,245 @@
+package service_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAddMessageCommands(t *testing.T) {
+	assert := assert.New(t)
+
+	otherModel := model.User{ID: primitive.NewObjectID(), UserName: "Other"}
+	inviteeModel := model.User{ID: primitive.NewObjectID(), UserName: "Invitee"}
+	botModel := model.User{
+		ID:       primitive.NewObjectID(),
+		UserName: "forecast",
+		Bot:      true,
+		Commands: []model.Command{{Name: "weather", Usage: "<city>", Description: "Weather in the city"}},
+	}
+	commandChatModel := model.Chat{
+		ID:    primitive.NewObjectID(),
+		Name:  "command_chat",
+		Users: []model.User{userModel, otherModel, {ID: botModel.ID, UserName: botModel.UserName, Bot: true}},
+	}
+
+	userCommandRepoMock := new(mocks.UserRepository)
+	userCommandRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userCommandRepoMock.On("FindUserByID", otherModel.ID.Hex()).Return(otherModel, nil)
+	userCommandRepoMock.On("FindUsersByIDs", []primitive.ObjectID{botModel.ID}).Return([]model.User{botModel}, nil)
+	userCommandRepoMock.On("SearchUsers", "Invitee", int64(1)).Return([]model.User{inviteeModel}, nil)
+	userCommandRepoMock.On("SearchUsers", "nobody", int64(1)).Return([]model.User{}, nil)
+	userCommandRepoMock.On("IsBlocked", inviteeModel, userModel).Return(false, nil)
+	userCommandRepoMock.On("FindBlockedBy", mock.Anything).Return([]model.Block{}, nil)
+	directChatModel := model.Chat{ID: primitive.NewObjectID(), Direct: true, Users: []model.User{userModel, otherModel}}
+
+	chatCommandRepoMock := new(mocks.ChatRepository)
+	chatCommandRepoMock.On("FindChatByID", commandChatModel.ID.Hex()).Return(commandChatModel, nil)
+	chatCommandRepoMock.On("FindChatByID", directChatModel.ID.Hex()).Return(directChatModel, nil)
+	chatCommandRepoMock.On("FindChatNotificationSettings", mock.Anything).Return([]model.NotificationSettings{}, nil)
+	var callModel model.CommandCall
+	callID := primitive.NewObjectID()
+	chatCommandRepoMock.On("InsertCommandCall", mock.Anything).Return(callID.Hex(), nil).Run(func(args mock.Arguments) {
+		callModel = args.Get(0).(model.CommandCall)
+	})
+	chatCommandRepoMock.On("AddChatMember", commandChatModel, model.User{ID: inviteeModel.ID, UserName: inviteeModel.UserName}).Return(nil)
+	var updatedChat model.Chat
+	chatCommandRepoMock.On("UpdateChat", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		updatedChat = args.Get(0).(model.Chat)
+	})
+	messageCommandRepoMock := new(mocks.MessageRepository)
+	messageCommandRepoMock.On("InsertMessage", mock.Anything).Return(primitive.NewObjectID().Hex(), nil)
+
+	commands := make(chan model.Event, 1)
+	eventHubMock := new(mocks.EventHub)
+	eventHubMock.On("Publish", []primitive.ObjectID{botModel.ID}, mock.Anything).Return().Run(func(args mock.Arguments) {
+		commands <- args.Get(1).(model.Event)
+	})
+	eventHubMock.On("Publish", mock.Anything, mock.Anything).Return()
+	testObj := service.NewChatService(userCommandRepoMock, chatCommandRepoMock, messageCommandRepoMock, service.WithEvents(eventHubMock))
+
+	send := func(text string) (view.NewMessageResponse, error) {
+		return testObj.AddMessage(view.NewMessageRequest{ChatID: commandChatModel.ID.Hex(), UserID: userModel.ID.Hex(), Text: text})
+	}
+
+	messageResponse, err := send("/me waves")
+	assert.NoError(err)
+	assert.NotEmpty(messageResponse.ID)
+	messageCommandRepoMock.AssertCalled(t, "InsertMessage", model.Message{
+		Chat:   commandChatModel.ID,
+		Author: userModel.ID,
+		Type:   model.MessageTypeAction,
+		Text:   "Test waves",
+	})
+
+	// Two slashes post the text with one of them.
+	_, err = send("//me waves")
+	assert.NoError(err)
+	messageCommandRepoMock.AssertCalled(t, "InsertMessage", model.Message{Chat: commandChatModel.ID, Author: userModel.ID, Text: "/me waves"})
+
+	_, err = send("/topic Release planning")
+	assert.NoError(err)
+	assert.Equal("Release planning", updatedChat.Description)
+
+	messageResponse, err = send("/invite @Invitee @nobody")
+	assert.NoError(err)
+	chatCommandRepoMock.AssertCalled(t, "AddChatMember", commandChatModel, model.User{ID: inviteeModel.ID, UserName: inviteeModel.UserName})
+	if assert.NotNil(messageResponse.Ephemeral) {
+		assert.Equal(model.MessageTypeEphemeral, messageResponse.Ephemeral.Type)
+		assert.Equal("@nobody not found.", messageResponse.Ephemeral.Text)
+	}
+
+	// Other members share invite links instead.
+	messageResponse, err = testObj.AddMessage(view.NewMessageRequest{ChatID: commandChatModel.ID.Hex(), UserID: otherModel.ID.Hex(), Text: "/invite @Invitee"})
+	assert.NoError(err)
+	if assert.NotNil(messageResponse.Ephemeral) {
+		assert.Contains(messageResponse.Ephemeral.Text, "Only the owner")
+	}
+
+	messageResponse, err = testObj.AddMessage(view.NewMessageRequest{ChatID: directChatModel.ID.Hex(), UserID: userModel.ID.Hex(), Text: "/invite @Invitee"})
+	assert.NoError(err)
+	if assert.NotNil(messageResponse.Ephemeral) {
+		assert.Contains(messageResponse.Ephemeral.Text, "direct chat")
+	}
+	chatCommandRepoMock.AssertNumberOfCalls(t, "AddChatMember", 1)
+
+	messageResponse, err = send("/help")
+	assert.NoError(err)
+	if assert.NotNil(messageResponse.Ephemeral) {
+		assert.Contains(messageResponse.Ephemeral.Text, "/me <action> Post an action")
+		assert.Contains(messageResponse.Ephemeral.Text, "/weather <city> Weather in the city")
+	}
+
+	// Unknown commands are answered to the caller only.
+	messageResponse, err = send("/wether Rio")
+	assert.NoError(err)
+	assert.Empty(messageResponse.ID)
+	if assert.NotNil(messageResponse.Ephemeral) {
+		assert.Contains(messageResponse.Ephemeral.Text, "Unknown command /wether")
+	}
+
+	// Bot commands are recorded and handed to the bot.
+	messageResponse, err = send(`/weather@Forecast "Rio de Janeiro" today`)
+	assert.NoError(err)
+	assert.Empty(messageResponse)
+	assert.Equal(commandChatModel.ID, callModel.Chat)
+	assert.Equal(userModel.ID, callModel.User)
+	assert.Equal(botModel.ID, callModel.Bot)
+	assert.Equal([]string{"Rio de Janeiro", "today"}, callModel.Args)
+	assert.True(callModel.ExpiresAt.Time().After(time.Now()))
+	event := <-commands
+	assert.Equal(model.EventCommand, event.Type)
+	assert.Equal(userModel.ID, event.User)
+	if assert.NotNil(event.Command) {
+		assert.Equal(callID, event.Command.ID)
+		assert.Equal("weather", event.Command.Name)
+		assert.Equal(`"Rio de Janeiro" today`, event.Command.Text)
+	}
+
+	// Paths are not commands.
+	_, err = send("/usr/bin is gone")
+	assert.NoError(err)
+	messageCommandRepoMock.AssertCalled(t, "InsertMessage", model.Message{Chat: commandChatModel.ID, Author: userModel.ID, Text: "/usr/bin is gone"})
+}
+
+func TestBotCommands(t *testing.T) {
+	assert := assert.New(t)
+
+	botModel := model.User{ID: primitive.NewObjectID(), UserName: "forecast", Bot: true}
+	otherModel := model.User{ID: primitive.NewObjectID(), UserName: "Other"}
+	botChatModel := model.Chat{
+		ID:    primitive.NewObjectID(),
+		Users: []model.User{userModel, {ID: botModel.ID, UserName: botModel.UserName, Bot: true}},
+	}
+
+	key := "bot_key"
+	sum := sha256.Sum256([]byte(key))
+
+	userBotRepoMock := new(mocks.UserRepository)
+	userBotRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userBotRepoMock.On("FindUserByID", otherModel.ID.Hex()).Return(otherModel, nil)
+	userBotRepoMock.On("FindUserByID", botModel.ID.Hex()).Return(botModel, nil)
+	userBotRepoMock.On("FindAPIKeyByHash", hex.EncodeToString(sum[:])).Return(model.APIKey{Bot: botModel.ID}, nil)
+	userBotRepoMock.On("SetBotCommands", botModel.ID, mock.Anything).Return(nil)
+	callModel := model.CommandCall{ID: primitive.NewObjectID(), Chat: botChatModel.ID, User: userModel.ID, Bot: botModel.ID, Name: "weather"}
+	otherCallModel := model.CommandCall{ID: primitive.NewObjectID(), Chat: botChatModel.ID, User: otherModel.ID, Bot: botModel.ID, Name: "weather"}
+	foreignCallModel := model.CommandCall{ID: primitive.NewObjectID(), Chat: botChatModel.ID, User: userModel.ID, Bot: primitive.NewObjectID(), Name: "weather"}
+
+	chatBotRepoMock := new(mocks.ChatRepository)
+	chatBotRepoMock.On("FindChatByID", botChatModel.ID.Hex()).Return(botChatModel, nil)
+	for _, call := range []model.CommandCall{callModel, otherCallModel, foreignCallModel} {
+		chatBotRepoMock.On("FindCommandCall", call.ID.Hex()).Return(call, nil)
+	}
+	chatBotRepoMock.On("FindCommandCall", mock.Anything).Return(model.CommandCall{}, mongo.ErrNoDocuments)
+
+	published := make(chan model.Event, 1)
+	eventHubMock := new(mocks.EventHub)
+	eventHubMock.On("Publish", []primitive.ObjectID{userModel.ID}, mock.Anything).Return().Run(func(args mock.Arguments) {
+		published <- args.Get(1).(model.Event)
+	})
+	testObj := service.NewChatService(userBotRepoMock, chatBotRepoMock, messageRepoMock, service.WithEvents(eventHubMock))
+
+	commandsResponse, err := testObj.SetBotCommands(key, view.BotCommandsRequest{Commands: []view.Command{
+		{Name: "weather", Usage: "<city>", Description: "Weather in the city"},
+	}})
+	assert.NoError(err)
+	assert.Len(commandsResponse, 1)
+	userBotRepoMock.AssertCalled(t, "SetBotCommands", botModel.ID, []model.Command{{Name: "weather", Usage: "<city>", Description: "Weather in the city"}})
+
+	_, err = testObj.SetBotCommands(key, view.BotCommandsRequest{Commands: []view.Command{{Name: "topic", Description: "Topic"}}})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+
+	// Ephemeral answers go to the user only and are never stored.
+	messageResponse, err := testObj.BotRespondCommand(key, view.BotCommandResponse{
+		CallID:    callModel.ID.Hex(),
+		Text:      "Sunny",
+		Ephemeral: true,
+	})
+	assert.NoError(err)
+	event := <-published
+	assert.Equal(model.EventEphemeral, event.Type)
+	assert.Equal(botModel.ID, event.User)
+	assert.Equal("Sunny", event.Message.Text)
+	if assert.NotNil(messageResponse.Ephemeral) {
+		assert.Equal(event.Message.ID.Hex(), messageResponse.Ephemeral.ID)
+	}
+	messageRepoMock.AssertNotCalled(t, "InsertMessage", mock.MatchedBy(func(message model.Message) bool { return message.Chat == botChatModel.ID }))
+
+	// The user who ran the command left the chat.
+	_, err = testObj.BotRespondCommand(key, view.BotCommandResponse{
+		CallID:    otherCallModel.ID.Hex(),
+		Text:      "Sunny",
+		Ephemeral: true,
+	})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+
+	// Bots answer only the calls handed to them, until they expire.
+	for _, id := range []string{foreignCallModel.ID.Hex(), primitive.NewObjectID().Hex()} {
+		_, err = testObj.BotRespondCommand(key, view.BotCommandResponse{CallID: id, Text: "Sunny", Ephemeral: true})
+		assert.Error(err)
+		if errors.As(err, &responseError) {
+			assert.Equal(404, responseError.Status)
+		}
+	}
+}
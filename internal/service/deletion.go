@@ -0,0 +1,190 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const chatCleanupBatchSize = 500
+
+const (
+	deletionPending = "pending"
+	deletionDone    = "done"
+)
+
+// DeleteChat removes the chat and starts deleting its messages and
+// everything else attached to it in the background. Repeated calls are safe
+// and report the cleanup progress.
+func (c *ChatService) DeleteChat(request view.DeleteChatRequest) (view.DeleteChatResponse, error) {
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.DeleteChatResponse{}, err
+	}
+
+	deletion, err := c.chatRepo.FindChatDeletion(request.ChatID)
+	if err == nil {
+		if deletion.Owner != user.ID {
+			return view.DeleteChatResponse{}, errs.New(403, "only the owner can delete the chat", nil)
+		}
+
+		if !deletion.Done {
+			c.startChatCleanup(deletion)
+		}
+
+		return deletionToView(deletion), nil
+	}
+
+	chat, err := c.chatRepo.FindChatByID(request.ChatID)
+	if err != nil {
+		return view.DeleteChatResponse{}, errs.New(404, "chat not found", err)
+	}
+
+	if chatOwner(chat) != user.ID {
+		return view.DeleteChatResponse{}, errs.New(403, "only the owner can delete the chat", nil)
+	}
+
+	deletion = model.ChatDeletion{
+		ID:        chat.ID,
+		Owner:     user.ID,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	if err := c.chatRepo.InsertChatDeletion(deletion); err != nil {
+		return view.DeleteChatResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	if err := c.chatRepo.DeleteChat(chat); err != nil {
+		return view.DeleteChatResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	c.startChatCleanup(deletion)
+
+	return deletionToView(deletion), nil
+}
+
+// ResumeChatDeletions restarts the cleanup of chats whose deletion was
+// interrupted, e.g. by a server restart.
+func (c *ChatService) ResumeChatDeletions() error {
+	deletions, err := c.chatRepo.FindPendingChatDeletions()
+	if err != nil {
+		return err
+	}
+
+	for _, deletion := range deletions {
+		c.startChatCleanup(deletion)
+	}
+
+	return nil
+}
+
+func (c *ChatService) startChatCleanup(deletion model.ChatDeletion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cleanups[deletion.ID] {
+		return
+	}
+
+	c.cleanups[deletion.ID] = true
+
+	go c.cleanupChat(deletion)
+}
+
+func (c *ChatService) cleanupChat(deletion model.ChatDeletion) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.cleanups, deletion.ID)
+		c.mu.Unlock()
+	}()
+
+	if err := c.cleanupChatData(deletion.ID); err != nil {
+		log.Printf("chat %s cleanup failed: %s", deletion.ID.Hex(), err)
+		return
+	}
+
+	for {
+		deleted, err := c.messageRepo.DeleteMessages(deletion.ID, chatCleanupBatchSize)
+		if err != nil {
+			log.Printf("chat %s cleanup failed: %s", deletion.ID.Hex(), err)
+			return
+		}
+
+		if deleted == 0 {
+			break
+		}
+
+		deletion.Deleted += deleted
+		if err := c.chatRepo.UpdateChatDeletion(deletion); err != nil {
+			log.Printf("chat %s cleanup failed: %s", deletion.ID.Hex(), err)
+			return
+		}
+	}
+
+	deletion.Done = true
+	deletion.FinishedAt = primitive.NewDateTimeFromTime(time.Now())
+	if err := c.chatRepo.UpdateChatDeletion(deletion); err != nil {
+		log.Printf("chat %s cleanup failed: %s", deletion.ID.Hex(), err)
+	}
+}
+
+// cleanupChatData removes what the chat leaves behind besides its messages.
+// Every step can be repeated, so an interrupted cleanup starts over. The bots
+// of incoming webhooks are deactivated before their webhooks go, so that a
+// resumed cleanup still finds them.
+func (c *ChatService) cleanupChatData(chat primitive.ObjectID) error {
+	if err := c.chatRepo.DeleteChatInvites(chat); err != nil {
+		return err
+	}
+
+	if err := c.messageRepo.DeleteChatDrafts(chat); err != nil {
+		return err
+	}
+
+	if err := c.messageRepo.DeleteChatScheduledMessages(chat); err != nil {
+		return err
+	}
+
+	if err := c.chatRepo.DeleteChatNotificationSettings(chat); err != nil {
+		return err
+	}
+
+	if err := c.chatRepo.DeleteChatWebhooks(chat); err != nil {
+		return err
+	}
+
+	hooks, err := c.chatRepo.FindIncomingWebhooks(chat)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		if err := c.userRepo.DeactivateUser(model.User{ID: hook.Bot}); err != nil {
+			return err
+		}
+
+		if err := c.chatRepo.DeleteIncomingWebhook(hook); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func deletionToView(deletion model.ChatDeletion) view.DeleteChatResponse {
+	status := deletionPending
+	if deletion.Done {
+		status = deletionDone
+	}
+
+	return view.DeleteChatResponse{
+		ID:      deletion.ID.Hex(),
+		Status:  status,
+		Deleted: deletion.Deleted,
+	}
+}
@@ -0,0 +1,117 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDeleteChat(t *testing.T) {
+	assert := assert.New(t)
+
+	deleteRequest := view.DeleteChatRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+	}
+
+	incomingHook := model.IncomingWebhook{ID: primitive.NewObjectID(), Chat: chatModel.ID, Bot: primitive.NewObjectID()}
+
+	userDelRepoMock := new(mocks.UserRepository)
+	userDelRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userDelRepoMock.On("DeactivateUser", model.User{ID: incomingHook.Bot}).Return(nil)
+	chatDelRepoMock := new(mocks.ChatRepository)
+	chatDelRepoMock.On("FindChatDeletion", chatModel.ID.Hex()).Return(model.ChatDeletion{}, errors.New("not found"))
+	chatDelRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatDelRepoMock.On("InsertChatDeletion", mock.Anything).Return(nil)
+	chatDelRepoMock.On("DeleteChat", chatModel).Return(nil)
+	chatDelRepoMock.On("DeleteChatInvites", chatModel.ID).Return(nil)
+	chatDelRepoMock.On("DeleteChatNotificationSettings", chatModel.ID).Return(nil)
+	chatDelRepoMock.On("DeleteChatWebhooks", chatModel.ID).Return(nil)
+	chatDelRepoMock.On("FindIncomingWebhooks", chatModel.ID).Return([]model.IncomingWebhook{incomingHook}, nil)
+	chatDelRepoMock.On("DeleteIncomingWebhook", incomingHook).Return(nil)
+	progress := make(chan model.ChatDeletion, 2)
+	chatDelRepoMock.On("UpdateChatDeletion", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		progress <- args.Get(0).(model.ChatDeletion)
+	})
+	messageDelRepoMock := new(mocks.MessageRepository)
+	messageDelRepoMock.On("DeleteChatDrafts", chatModel.ID).Return(nil)
+	messageDelRepoMock.On("DeleteChatScheduledMessages", chatModel.ID).Return(nil)
+	messageDelRepoMock.On("DeleteMessages", chatModel.ID, int64(500)).Return(int64(3), nil).Once()
+	messageDelRepoMock.On("DeleteMessages", chatModel.ID, int64(500)).Return(int64(0), nil)
+	testObj := service.NewChatService(userDelRepoMock, chatDelRepoMock, messageDelRepoMock)
+
+	deleteResponse, err := testObj.DeleteChat(deleteRequest)
+	assert.NoError(err)
+	assert.Equal(chatModel.ID.Hex(), deleteResponse.ID)
+	assert.Equal("pending", deleteResponse.Status)
+	chatDelRepoMock.AssertCalled(t, "DeleteChat", chatModel)
+
+	var deletion model.ChatDeletion
+	for !deletion.Done {
+		select {
+		case deletion = <-progress:
+		case <-time.After(time.Second):
+			t.Fatal("chat cleanup did not finish")
+		}
+	}
+	assert.Equal(int64(3), deletion.Deleted)
+
+	// Nothing attached to the chat is left behind.
+	chatDelRepoMock.AssertCalled(t, "DeleteChatInvites", chatModel.ID)
+	chatDelRepoMock.AssertCalled(t, "DeleteChatNotificationSettings", chatModel.ID)
+	chatDelRepoMock.AssertCalled(t, "DeleteChatWebhooks", chatModel.ID)
+	chatDelRepoMock.AssertCalled(t, "DeleteIncomingWebhook", incomingHook)
+	userDelRepoMock.AssertCalled(t, "DeactivateUser", model.User{ID: incomingHook.Bot})
+	messageDelRepoMock.AssertCalled(t, "DeleteChatDrafts", chatModel.ID)
+	messageDelRepoMock.AssertCalled(t, "DeleteChatScheduledMessages", chatModel.ID)
+
+	doneDeletion := model.ChatDeletion{ID: chatModel.ID, Owner: userModel.ID, Deleted: 3, Done: true}
+	chatDoneRepoMock := new(mocks.ChatRepository)
+	chatDoneRepoMock.On("FindChatDeletion", chatModel.ID.Hex()).Return(doneDeletion, nil)
+	testObj = service.NewChatService(userRepoMock, chatDoneRepoMock, messageRepoMock)
+	deleteResponse, err = testObj.DeleteChat(deleteRequest)
+	assert.NoError(err)
+	assert.Equal("done", deleteResponse.Status)
+	assert.Equal(int64(3), deleteResponse.Deleted)
+
+	strangerModel := model.User{ID: primitive.NewObjectID(), UserName: "Stranger"}
+	userStrangerRepoMock := new(mocks.UserRepository)
+	userStrangerRepoMock.On("FindUserByID", strangerModel.ID.Hex()).Return(strangerModel, nil)
+	testObj = service.NewChatService(userStrangerRepoMock, chatDelRepoMock, messageRepoMock)
+	deleteResponse, err = testObj.DeleteChat(view.DeleteChatRequest{ChatID: chatModel.ID.Hex(), UserID: strangerModel.ID.Hex()})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	assert.Empty(deleteResponse)
+}
+
+func TestDeletedChatIsGone(t *testing.T) {
+	assert := assert.New(t)
+
+	pendingDeletion := model.ChatDeletion{ID: chatModel.ID, Owner: userModel.ID}
+	chatGoneRepoMock := new(mocks.ChatRepository)
+	chatGoneRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(model.Chat{}, errors.New("not found"))
+	chatGoneRepoMock.On("FindChatDeletion", chatModel.ID.Hex()).Return(pendingDeletion, nil)
+	testObj := service.NewChatService(userRepoMock, chatGoneRepoMock, messageRepoMock)
+
+	messagesResponse, err := testObj.GetMessages(view.MessagesRequest{СhatID: chatModel.ID.Hex()})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(410, responseError.Status)
+	}
+	assert.Empty(messagesResponse)
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+// SaveDraft replaces the caller's draft in the chat. Saving an empty draft
+// clears it.
+func (c *ChatService) SaveDraft(request view.SaveDraftRequest) (view.Draft, error) {
+	chat, user, err := c.findDraftChat(request.ChatID, request.UserID)
+	if err != nil {
+		return view.Draft{}, err
+	}
+
+	if request.Text == "" && request.ReplyTo == "" {
+		if err := c.messageRepo.DeleteDraft(chat, user); err != nil {
+			return view.Draft{}, errs.New(500, "internal server error", err)
+		}
+
+		return view.Draft{ChatID: chat.ID.Hex()}, nil
+	}
+
+	draft := model.Draft{
+		Chat:      chat.ID,
+		User:      user.ID,
+		Text:      request.Text,
+		UpdatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	if request.ReplyTo != "" {
+		replyTo, err := c.messageRepo.FindMessageByID(request.ReplyTo)
+		if err != nil || replyTo.Chat != chat.ID || isExpired(replyTo, time.Now()) {
+			return view.Draft{}, errs.New(404, "reply_to message not found", err)
+		}
+
+		draft.ReplyTo = replyTo.ID
+	}
+
+	if err := c.messageRepo.UpsertDraft(draft); err != nil {
+		return view.Draft{}, errs.New(500, "internal server error", err)
+	}
+
+	return draftToView(draft), nil
+}
+
+func (c *ChatService) GetDraft(request view.DraftRequest) (view.Draft, error) {
+	chat, user, err := c.findDraftChat(request.ChatID, request.UserID)
+	if err != nil {
+		return view.Draft{}, err
+	}
+
+	draft, err := c.messageRepo.FindDraft(chat, user)
+	if err != nil {
+		return view.Draft{}, errs.New(404, "draft not found", err)
+	}
+
+	return draftToView(draft), nil
+}
+
+func (c *ChatService) ClearDraft(request view.DraftRequest) (view.Draft, error) {
+	return c.SaveDraft(view.SaveDraftRequest{ChatID: request.ChatID, UserID: request.UserID})
+}
+
+func (c *ChatService) findDraftChat(chatID string, userID string) (model.Chat, model.User, error) {
+	chat, err := c.findChat(chatID)
+	if err != nil {
+		return model.Chat{}, model.User{}, err
+	}
+
+	user, err := c.findUser(userID)
+	if err != nil {
+		return model.Chat{}, model.User{}, err
+	}
+
+	if !isMember(chat, user) {
+		return model.Chat{}, model.User{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	return chat, user, nil
+}
+
+func draftToView(draft model.Draft) view.Draft {
+	draftView := view.Draft{
+		ChatID:    draft.Chat.Hex(),
+		Text:      draft.Text,
+		UpdatedAt: draft.UpdatedAt.Time().UTC().Format(time.RFC3339),
+	}
+
+	if !draft.ReplyTo.IsZero() {
+		draftView.ReplyTo = draft.ReplyTo.Hex()
+	}
+
+	return draftView
+}
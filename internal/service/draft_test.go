@@ -0,0 +1,92 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSaveDraft(t *testing.T) {
+	assert := assert.New(t)
+
+	otherChatMessage := messageModel
+	otherChatMessage.ID = primitive.NewObjectID()
+	otherChatMessage.Chat = primitive.NewObjectID()
+	messageDraftRepoMock := new(mocks.MessageRepository)
+	messageDraftRepoMock.On("FindMessageByID", messageModel.ID.Hex()).Return(messageModel, nil)
+	messageDraftRepoMock.On("FindMessageByID", otherChatMessage.ID.Hex()).Return(otherChatMessage, nil)
+	messageDraftRepoMock.On("UpsertDraft", mock.Anything).Return(nil)
+	messageDraftRepoMock.On("DeleteDraft", chatModel, userModel).Return(nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageDraftRepoMock)
+
+	draftResponse, err := testObj.SaveDraft(view.SaveDraftRequest{
+		ChatID:  chatModel.ID.Hex(),
+		UserID:  userModel.ID.Hex(),
+		Text:    "Unsent",
+		ReplyTo: messageModel.ID.Hex(),
+	})
+	assert.NoError(err)
+	assert.Equal("Unsent", draftResponse.Text)
+	assert.Equal(messageModel.ID.Hex(), draftResponse.ReplyTo)
+	messageDraftRepoMock.AssertCalled(t, "UpsertDraft", mock.MatchedBy(func(draft model.Draft) bool {
+		return draft.Chat == chatModel.ID && draft.User == userModel.ID && draft.ReplyTo == messageModel.ID
+	}))
+
+	_, err = testObj.SaveDraft(view.SaveDraftRequest{
+		ChatID:  chatModel.ID.Hex(),
+		UserID:  userModel.ID.Hex(),
+		Text:    "Unsent",
+		ReplyTo: otherChatMessage.ID.Hex(),
+	})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(404, responseError.Status)
+	}
+
+	draftResponse, err = testObj.ClearDraft(view.DraftRequest{ChatID: chatModel.ID.Hex(), UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(view.Draft{ChatID: chatModel.ID.Hex()}, draftResponse)
+	messageDraftRepoMock.AssertCalled(t, "DeleteDraft", chatModel, userModel)
+}
+
+func TestGetDraft(t *testing.T) {
+	assert := assert.New(t)
+
+	draftModel := model.Draft{Chat: chatModel.ID, User: userModel.ID, Text: "Unsent"}
+	messageDraftRepoMock := new(mocks.MessageRepository)
+	messageDraftRepoMock.On("FindDraft", chatModel, userModel).Return(draftModel, nil).Once()
+	messageDraftRepoMock.On("FindDraft", chatModel, userModel).Return(model.Draft{}, mongo.ErrNoDocuments)
+	messageDraftRepoMock.On("FindUserDrafts", userModel.ID).Return([]model.Draft{draftModel}, nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageDraftRepoMock)
+
+	draftRequest := view.DraftRequest{ChatID: chatModel.ID.Hex(), UserID: userModel.ID.Hex()}
+
+	draftResponse, err := testObj.GetDraft(draftRequest)
+	assert.NoError(err)
+	assert.Equal("Unsent", draftResponse.Text)
+	assert.Empty(draftResponse.ReplyTo)
+
+	draftResponse, err = testObj.GetDraft(draftRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(404, responseError.Status)
+	}
+	assert.Empty(draftResponse)
+
+	chatsResponse, err := testObj.GetChats(view.ChatsRequest{UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal("Unsent", chatsResponse[0].Draft.Text)
+}
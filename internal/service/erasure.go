@@ -0,0 +1,282 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	erasureBatchSize = 500
+	erasedUserName   = "Deleted user"
+)
+
+// WithErasurePolicy sets whether the messages of deleted accounts are
+// anonymized or deleted. Messages are anonymized by default.
+func WithErasurePolicy(policy string) Option {
+	return func(c *ChatService) {
+		c.erasurePolicy = policy
+	}
+}
+
+// DeleteUser deactivates the account right away and erases the user's data
+// in the background. Repeated calls are safe and report the progress.
+func (c *ChatService) DeleteUser(request view.UserRequest) (view.DeleteUserResponse, error) {
+	job, err := c.userRepo.FindErasureJob(request.UserID)
+	if err == nil {
+		if job.Stage != model.ErasureStageDone {
+			c.startErasure(job)
+		}
+
+		return erasureToView(job), nil
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.DeleteUserResponse{}, err
+	}
+
+	job = model.ErasureJob{
+		ID:        user.ID,
+		Policy:    c.erasurePolicy,
+		Stage:     model.ErasureStageMembership,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	if err := c.userRepo.InsertErasureJob(job); err != nil {
+		return view.DeleteUserResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	if err := c.userRepo.DeactivateUser(user); err != nil {
+		return view.DeleteUserResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	c.startErasure(job)
+
+	return erasureToView(job), nil
+}
+
+// ResumeErasures restarts erasures that were interrupted, e.g. by a server
+// restart.
+func (c *ChatService) ResumeErasures() error {
+	jobs, err := c.userRepo.FindPendingErasureJobs()
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		c.startErasure(job)
+	}
+
+	return nil
+}
+
+func (c *ChatService) startErasure(job model.ErasureJob) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.erasures[job.ID] {
+		return
+	}
+
+	c.erasures[job.ID] = true
+
+	go c.eraseUser(job)
+}
+
+// eraseUser runs the remaining stages of the job. Every stage is idempotent,
+// so a stage interrupted before its progress was saved can simply run again.
+func (c *ChatService) eraseUser(job model.ErasureJob) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.erasures, job.ID)
+		c.mu.Unlock()
+	}()
+
+	if job.Stage == model.ErasureStageMembership {
+		if err := c.userRepo.DeactivateUser(model.User{ID: job.ID}); err != nil {
+			log.Printf("user %s erasure failed: %s", job.ID.Hex(), err)
+			return
+		}
+
+		if err := c.eraseMembership(job.ID); err != nil {
+			log.Printf("user %s erasure failed: %s", job.ID.Hex(), err)
+			return
+		}
+
+		job.Stage = model.ErasureStageMessages
+		if err := c.userRepo.UpdateErasureJob(job); err != nil {
+			log.Printf("user %s erasure failed: %s", job.ID.Hex(), err)
+			return
+		}
+	}
+
+	if job.Stage != model.ErasureStageMessages {
+		return
+	}
+
+	if err := c.eraseSystemMessages(job.ID); err != nil {
+		log.Printf("user %s erasure failed: %s", job.ID.Hex(), err)
+		return
+	}
+
+	for {
+		var processed int64
+		var err error
+		if job.Policy == model.ErasureDelete {
+			processed, err = c.messageRepo.DeleteUserMessages(job.ID, erasureBatchSize)
+		} else {
+			processed, err = c.messageRepo.AnonymizeUserMessages(job.ID, erasureBatchSize)
+		}
+		if err != nil {
+			log.Printf("user %s erasure failed: %s", job.ID.Hex(), err)
+			return
+		}
+
+		if processed == 0 {
+			break
+		}
+
+		job.Messages += processed
+		if err := c.userRepo.UpdateErasureJob(job); err != nil {
+			log.Printf("user %s erasure failed: %s", job.ID.Hex(), err)
+			return
+		}
+	}
+
+	// The audit record is written before the job is marked as done, so an
+	// interruption may repeat it but never lose it.
+	record := model.AuditRecord{
+		Action:    "user_erased",
+		Subject:   job.ID,
+		Details:   fmt.Sprintf("policy=%s messages=%d", job.Policy, job.Messages),
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+	if err := c.userRepo.InsertAuditRecord(record); err != nil {
+		log.Printf("user %s erasure failed: %s", job.ID.Hex(), err)
+		return
+	}
+
+	job.Stage = model.ErasureStageDone
+	job.FinishedAt = primitive.NewDateTimeFromTime(time.Now())
+	if err := c.userRepo.UpdateErasureJob(job); err != nil {
+		log.Printf("user %s erasure failed: %s", job.ID.Hex(), err)
+	}
+}
+
+// eraseMembership takes the user out of their chats, giving up the ones they
+// own, and drops what they kept around them: their bots, drafts, scheduled
+// messages, which would otherwise still be delivered, poll votes and
+// presence.
+func (c *ChatService) eraseMembership(user primitive.ObjectID) error {
+	if err := c.chatRepo.RemoveUserFromChats(user); err != nil {
+		return err
+	}
+
+	if err := c.eraseBots(user); err != nil {
+		return err
+	}
+
+	if err := c.messageRepo.DeleteUserDrafts(user); err != nil {
+		return err
+	}
+
+	if err := c.messageRepo.DeleteUserScheduledMessages(user); err != nil {
+		return err
+	}
+
+	if err := c.messageRepo.RemoveUserVotes(user); err != nil {
+		return err
+	}
+
+	if c.presence != nil {
+		return c.presence.Forget(user)
+	}
+
+	return nil
+}
+
+func erasureToView(job model.ErasureJob) view.DeleteUserResponse {
+	status := deletionPending
+	if job.Stage == model.ErasureStageDone {
+		status = deletionDone
+	}
+
+	return view.DeleteUserResponse{
+		ID:       job.ID.Hex(),
+		Status:   status,
+		Stage:    job.Stage,
+		Policy:   job.Policy,
+		Messages: job.Messages,
+	}
+}
+
+// eraseSystemMessages replaces the name of the user in the system messages
+// that mention them. These are kept whatever the policy, as they tell the
+// history of the chat rather than what the user wrote.
+func (c *ChatService) eraseSystemMessages(user primitive.ObjectID) error {
+	for {
+		messages, err := c.messageRepo.FindUserSystemMessages(user, erasureBatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(messages) == 0 {
+			return nil
+		}
+
+		for _, message := range messages {
+			if err := c.messageRepo.UpdateSystemMessage(anonymizeSystemMessage(message, user)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// anonymizeSystemMessage detaches a system message from the user and puts
+// erasedUserName in place of their name. Usernames have no spaces, so the
+// text starts with the name of the member the event is about, or, when they
+// were added, with the name of the member who added them followed by
+// " added " and theirs.
+func anonymizeSystemMessage(message model.Message, user primitive.ObjectID) model.Message {
+	const added = " added "
+	text := message.Text
+	by := strings.Index(text, added)
+
+	if message.System != nil && message.System.By == user {
+		event := *message.System
+		event.By = primitive.NilObjectID
+		message.System = &event
+
+		if by >= 0 {
+			text = erasedUserName + text[by:]
+			by = len(erasedUserName)
+		}
+	}
+
+	if message.Author == user {
+		message.Author = primitive.NilObjectID
+
+		if message.System != nil && message.System.Via == "added" {
+			if by >= 0 {
+				name := text[by+len(added):]
+				if end := strings.Index(name, " "); end >= 0 {
+					text = text[:by+len(added)] + erasedUserName + name[end:]
+				}
+			}
+		} else if end := strings.Index(text, " "); end >= 0 {
+			text = erasedUserName + text[end:]
+		}
+	}
+
+	message.Text = text
+
+	return message
+}
@@ -0,0 +1,153 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDeleteUser(t *testing.T) {
+	for _, policy := range []string{model.ErasureAnonymize, model.ErasureDelete} {
+		assert := assert.New(t)
+
+		progress := make(chan model.ErasureJob, 3)
+		botModel := model.User{ID: primitive.NewObjectID(), UserName: "bot", Bot: true, Owner: userModel.ID}
+		userEraseRepoMock := new(mocks.UserRepository)
+		userEraseRepoMock.On("FindErasureJob", userModel.ID.Hex()).Return(model.ErasureJob{}, errors.New("not found"))
+		userEraseRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+		userEraseRepoMock.On("InsertErasureJob", mock.Anything).Return(nil)
+		userEraseRepoMock.On("DeactivateUser", mock.Anything).Return(nil)
+		userEraseRepoMock.On("InsertAuditRecord", mock.Anything).Return(nil)
+		userEraseRepoMock.On("FindOwnedBots", userModel.ID).Return([]model.User{botModel}, nil)
+		userEraseRepoMock.On("DeleteAPIKeys", botModel.ID).Return(nil)
+		userEraseRepoMock.On("UpdateErasureJob", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			progress <- args.Get(0).(model.ErasureJob)
+		})
+		chatEraseRepoMock := new(mocks.ChatRepository)
+		chatEraseRepoMock.On("RemoveUserFromChats", userModel.ID).Return(nil)
+		chatEraseRepoMock.On("RemoveUserFromChats", botModel.ID).Return(nil)
+		chatEraseRepoMock.On("DeleteBotWebhooks", botModel.ID).Return(nil)
+		messageEraseRepoMock := new(mocks.MessageRepository)
+		messageEraseRepoMock.On("DeleteUserDrafts", userModel.ID).Return(nil)
+		messageEraseRepoMock.On("DeleteUserScheduledMessages", userModel.ID).Return(nil)
+		messageEraseRepoMock.On("RemoveUserVotes", userModel.ID).Return(nil)
+		messageEraseRepoMock.On("FindUserSystemMessages", userModel.ID, int64(500)).Return([]model.Message{}, nil)
+		presenceEraseMock := new(mocks.PresenceStore)
+		presenceEraseMock.On("Forget", userModel.ID).Return(nil)
+		method := "AnonymizeUserMessages"
+		if policy == model.ErasureDelete {
+			method = "DeleteUserMessages"
+		}
+		messageEraseRepoMock.On(method, userModel.ID, int64(500)).Return(int64(7), nil).Once()
+		messageEraseRepoMock.On(method, userModel.ID, int64(500)).Return(int64(0), nil)
+		testObj := service.NewChatService(userEraseRepoMock, chatEraseRepoMock, messageEraseRepoMock,
+			service.WithErasurePolicy(policy), service.WithPresence(presenceEraseMock, time.Minute, time.Hour))
+
+		deleteResponse, err := testObj.DeleteUser(view.UserRequest{UserID: userModel.ID.Hex()})
+		assert.NoError(err)
+		assert.Equal(userModel.ID.Hex(), deleteResponse.ID)
+		assert.Equal("pending", deleteResponse.Status)
+		assert.Equal(policy, deleteResponse.Policy)
+		userEraseRepoMock.AssertCalled(t, "DeactivateUser", userModel)
+
+		var job model.ErasureJob
+		for job.Stage != model.ErasureStageDone {
+			select {
+			case job = <-progress:
+			case <-time.After(time.Second):
+				t.Fatal("user erasure did not finish")
+			}
+		}
+		assert.Equal(int64(7), job.Messages)
+		chatEraseRepoMock.AssertCalled(t, "RemoveUserFromChats", userModel.ID)
+		messageEraseRepoMock.AssertCalled(t, "DeleteUserDrafts", userModel.ID)
+		messageEraseRepoMock.AssertCalled(t, "DeleteUserScheduledMessages", userModel.ID)
+		messageEraseRepoMock.AssertCalled(t, "RemoveUserVotes", userModel.ID)
+		presenceEraseMock.AssertCalled(t, "Forget", userModel.ID)
+
+		// The bots of the user stop working.
+		userEraseRepoMock.AssertCalled(t, "DeactivateUser", botModel)
+		userEraseRepoMock.AssertCalled(t, "DeleteAPIKeys", botModel.ID)
+		chatEraseRepoMock.AssertCalled(t, "DeleteBotWebhooks", botModel.ID)
+		chatEraseRepoMock.AssertCalled(t, "RemoveUserFromChats", botModel.ID)
+		userEraseRepoMock.AssertCalled(t, "InsertAuditRecord", mock.MatchedBy(func(record model.AuditRecord) bool {
+			return record.Action == "user_erased" && record.Subject == userModel.ID
+		}))
+	}
+}
+
+func TestEraseSystemMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	otherModel := model.User{ID: primitive.NewObjectID(), UserName: "Other"}
+	system := func(author primitive.ObjectID, event model.SystemEvent, text string) model.Message {
+		return model.Message{ID: primitive.NewObjectID(), Author: author, Type: model.MessageTypeSystem, System: &event, Text: text}
+	}
+	joined := system(userModel.ID, model.SystemEvent{Event: model.SystemMemberJoined, Via: "public"}, "Test joined the chat")
+	added := system(userModel.ID, model.SystemEvent{Event: model.SystemMemberJoined, Via: "added", By: otherModel.ID}, "Other added Test to the chat")
+	adder := system(otherModel.ID, model.SystemEvent{Event: model.SystemMemberJoined, Via: "added", By: userModel.ID}, "Test added Other to the chat")
+	// Added by a member erased before.
+	erasedAdder := system(userModel.ID, model.SystemEvent{Event: model.SystemMemberJoined, Via: "added"}, "Deleted user added Test to the chat")
+
+	progress := make(chan model.ErasureJob, 1)
+	job := model.ErasureJob{ID: userModel.ID, Policy: model.ErasureAnonymize, Stage: model.ErasureStageMessages}
+	userEraseRepoMock := new(mocks.UserRepository)
+	userEraseRepoMock.On("FindPendingErasureJobs").Return([]model.ErasureJob{job}, nil)
+	userEraseRepoMock.On("InsertAuditRecord", mock.Anything).Return(nil)
+	userEraseRepoMock.On("UpdateErasureJob", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		progress <- args.Get(0).(model.ErasureJob)
+	})
+	messageEraseRepoMock := new(mocks.MessageRepository)
+	messageEraseRepoMock.On("FindUserSystemMessages", userModel.ID, int64(500)).Return([]model.Message{joined, added, adder, erasedAdder}, nil).Once()
+	messageEraseRepoMock.On("FindUserSystemMessages", userModel.ID, int64(500)).Return([]model.Message{}, nil)
+	updated := map[primitive.ObjectID]model.Message{}
+	messageEraseRepoMock.On("UpdateSystemMessage", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		message := args.Get(0).(model.Message)
+		updated[message.ID] = message
+	})
+	messageEraseRepoMock.On("AnonymizeUserMessages", userModel.ID, int64(500)).Return(int64(0), nil)
+	testObj := service.NewChatService(userEraseRepoMock, chatRepoMock, messageEraseRepoMock)
+
+	assert.NoError(testObj.ResumeErasures())
+	select {
+	case job = <-progress:
+	case <-time.After(time.Second):
+		t.Fatal("user erasure did not finish")
+	}
+	assert.Equal(model.ErasureStageDone, job.Stage)
+
+	assert.Equal("Deleted user joined the chat", updated[joined.ID].Text)
+	assert.True(updated[joined.ID].Author.IsZero())
+	assert.Equal("Other added Deleted user to the chat", updated[added.ID].Text)
+	assert.Equal(otherModel.ID, updated[added.ID].System.By)
+	assert.Equal("Deleted user added Other to the chat", updated[adder.ID].Text)
+	assert.Equal(otherModel.ID, updated[adder.ID].Author)
+	assert.True(updated[adder.ID].System.By.IsZero())
+	assert.Equal("Deleted user added Deleted user to the chat", updated[erasedAdder.ID].Text)
+	// The message that was read is left as it is.
+	assert.Equal(userModel.ID, adder.System.By)
+}
+
+func TestDeleteUserReportsProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	doneJob := model.ErasureJob{ID: userModel.ID, Policy: model.ErasureAnonymize, Stage: model.ErasureStageDone, Messages: 7}
+	userEraseRepoMock := new(mocks.UserRepository)
+	userEraseRepoMock.On("FindErasureJob", userModel.ID.Hex()).Return(doneJob, nil)
+	testObj := service.NewChatService(userEraseRepoMock, chatRepoMock, messageRepoMock)
+
+	deleteResponse, err := testObj.DeleteUser(view.UserRequest{UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal("done", deleteResponse.Status)
+	assert.Equal(int64(7), deleteResponse.Messages)
+}
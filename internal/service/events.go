@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	defaultPollTimeout = 10 * time.Second
+	maxPollTimeout     = 10 * time.Second
+	messageEventTTL    = time.Minute
+)
+
+// EventHub fans ephemeral events out to the users polling for them.
+type EventHub interface {
+	Publish(users []primitive.ObjectID, event model.Event)
+	Poll(ctx context.Context, user primitive.ObjectID, device string, timeout time.Duration) []model.Event
+}
+
+func WithEvents(hub EventHub) Option {
+	return func(c *ChatService) {
+		c.events = hub
+	}
+}
+
+// PollEvents is the realtime channel of the clients. The user counts as
+// connected while the poll is open.
+func (c *ChatService) PollEvents(ctx context.Context, request view.PollEventsRequest) (view.EventsResponse, error) {
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.EventsResponse{}, err
+	}
+
+	return c.pollEvents(ctx, user, request.Device, request.Timeout)
+}
+
+func (c *ChatService) pollEvents(ctx context.Context, user model.User, device string, seconds int) (view.EventsResponse, error) {
+	eventsView := view.EventsResponse{}
+
+	if c.events == nil {
+		return view.EventsResponse{}, errs.New(503, "events are not available", nil)
+	}
+
+	// Events of blocked users are hidden, as their messages are.
+	blocked, err := c.blockedAuthors(user)
+	if err != nil {
+		return view.EventsResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	timeout := time.Duration(seconds) * time.Second
+	if timeout <= 0 || timeout > maxPollTimeout {
+		timeout = defaultPollTimeout
+	}
+
+	c.connect(user)
+	defer c.disconnect(user)
+
+	for _, event := range c.events.Poll(ctx, user.ID, device, timeout) {
+		if blocked[event.User] {
+			continue
+		}
+
+		eventsView = append(eventsView, eventToView(event))
+	}
+
+	return eventsView, nil
+}
+
+// publish sends the event to the members of the chat except its author.
+func (c *ChatService) publish(chat model.Chat, event model.Event) {
+	if c.events == nil {
+		return
+	}
+
+	var users []primitive.ObjectID
+	for _, member := range chat.Users {
+		if member.ID != event.User {
+			users = append(users, member.ID)
+		}
+	}
+
+	c.events.Publish(users, event)
+}
+
+func (c *ChatService) connect(user model.User) {
+	if c.presence == nil {
+		return
+	}
+
+	if err := c.presence.Connect(user.ID, time.Now()); err != nil {
+		log.Printf("presence of user %s not updated: %s", user.ID.Hex(), err)
+	}
+}
+
+func (c *ChatService) disconnect(user model.User) {
+	if c.presence == nil {
+		return
+	}
+
+	if err := c.presence.Disconnect(user.ID, time.Now()); err != nil {
+		log.Printf("presence of user %s not updated: %s", user.ID.Hex(), err)
+	}
+}
+
+func eventToView(event model.Event) view.Event {
+	eventView := view.Event{
+		Type:   event.Type,
+		ChatID: event.Chat.Hex(),
+		UserID: event.User.Hex(),
+	}
+
+	if !event.ExpiresAt.IsZero() {
+		eventView.ExpiresAt = event.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	if event.Message != nil {
+		messageView := messageToView(*event.Message)
+		eventView.Message = &messageView
+	}
+
+	if event.Command != nil {
+		callView := commandCallToView(*event.Command)
+		eventView.Command = &callView
+	}
+
+	return eventView
+}
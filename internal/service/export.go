@@ -0,0 +1,172 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	exportProfile       = "profile"
+	exportChat          = "chat"
+	exportMessage       = "message"
+	exportBlock         = "block"
+	exportNotifications = "notification_settings"
+	exportDraft         = "draft"
+	exportScheduled     = "scheduled_message"
+	exportBot           = "bot"
+	exportVote          = "vote"
+)
+
+// ExportUser writes everything stored about the user to w as NDJSON: the
+// profile first, then every chat they belong to, every message they wrote,
+// the users they blocked, their notification settings, drafts, scheduled
+// messages, bots and poll votes. Chats, messages and votes are streamed from
+// the database one document at a time, so the export never holds a whole
+// collection in memory.
+func (c *ChatService) ExportUser(request view.UserRequest, w io.Writer) error {
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+
+	if err := encoder.Encode(view.ExportRecord{Type: exportProfile, Data: userToView(user)}); err != nil {
+		return errs.New(500, "export failed", err)
+	}
+
+	err = c.chatRepo.EachChat(user, func(chat model.Chat) error {
+		return encoder.Encode(view.ExportRecord{Type: exportChat, Data: chatToView(chat, user)})
+	})
+	if err != nil {
+		return errs.New(500, "export failed", err)
+	}
+
+	err = c.messageRepo.EachUserMessage(user.ID, func(message model.Message) error {
+		return encoder.Encode(view.ExportRecord{Type: exportMessage, Data: messageToView(message)})
+	})
+	if err != nil {
+		return errs.New(500, "export failed", err)
+	}
+
+	if err := c.exportSettings(user, encoder); err != nil {
+		return errs.New(500, "export failed", err)
+	}
+
+	if err := c.exportBots(user, encoder); err != nil {
+		return errs.New(500, "export failed", err)
+	}
+
+	err = c.messageRepo.EachVotedPoll(user.ID, func(message model.Message) error {
+		return encoder.Encode(view.ExportRecord{Type: exportVote, Data: voteToView(message, user.ID)})
+	})
+	if err != nil {
+		return errs.New(500, "export failed", err)
+	}
+
+	return nil
+}
+
+// exportSettings writes the blocks, notification settings, drafts and
+// scheduled messages of the user. There are few of each, so they are read
+// at once.
+func (c *ChatService) exportSettings(user model.User, encoder *json.Encoder) error {
+	blocks, err := c.userRepo.FindBlocks(user)
+	if err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		record := view.ExportBlock{UserID: block.Blocked.Hex(), CreatedAt: block.CreatedAt.Time().UTC().Format(time.RFC3339)}
+		if err := encoder.Encode(view.ExportRecord{Type: exportBlock, Data: record}); err != nil {
+			return err
+		}
+	}
+
+	settings, err := c.chatRepo.FindUserNotificationSettings(user)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range settings {
+		record := view.ExportNotificationSettings{ChatID: s.Chat.Hex(), NotificationSettings: settingsToView(s)}
+		if err := encoder.Encode(view.ExportRecord{Type: exportNotifications, Data: record}); err != nil {
+			return err
+		}
+	}
+
+	drafts, err := c.messageRepo.FindUserDrafts(user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, draft := range drafts {
+		if err := encoder.Encode(view.ExportRecord{Type: exportDraft, Data: draftToView(draft)}); err != nil {
+			return err
+		}
+	}
+
+	scheduled, err := c.messageRepo.FindScheduledMessages(user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range scheduled {
+		if err := encoder.Encode(view.ExportRecord{Type: exportScheduled, Data: scheduledToView(message)}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportBots writes the bots of the user with the metadata of their API keys.
+func (c *ChatService) exportBots(user model.User, encoder *json.Encoder) error {
+	bots, err := c.userRepo.FindOwnedBots(user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, bot := range bots {
+		keys, err := c.userRepo.FindAPIKeys(bot.ID)
+		if err != nil {
+			return err
+		}
+
+		record := view.ExportBot{UserProfile: userToView(bot), Keys: []view.BotKey{}}
+		for _, key := range keys {
+			record.Keys = append(record.Keys, botKeyToView(key))
+		}
+
+		if err := encoder.Encode(view.ExportRecord{Type: exportBot, Data: record}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func voteToView(message model.Message, user primitive.ObjectID) view.ExportVote {
+	vote := view.ExportVote{MessageID: message.ID.Hex(), ChatID: message.Chat.Hex(), Options: []int{}}
+	if message.Poll == nil {
+		return vote
+	}
+
+	for i, option := range message.Poll.Options {
+		for _, voter := range option.Voters {
+			if voter == user {
+				vote.Options = append(vote.Options, i)
+				break
+			}
+		}
+	}
+
+	return vote
+}
@@ -0,0 +1,108 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExportUser(t *testing.T) {
+	assert := assert.New(t)
+
+	chatExportRepoMock := new(mocks.ChatRepository)
+	chatExportRepoMock.On("EachChat", userModel, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(1).(func(model.Chat) error)(chatModel)
+	})
+	chatExportRepoMock.On("FindUserNotificationSettings", userModel).Return([]model.NotificationSettings{
+		{Chat: chatModel.ID, User: userModel.ID, Mode: model.NotifyMentions},
+	}, nil)
+	blockedModel := model.User{ID: primitive.NewObjectID(), UserName: "Blocked"}
+	botModel := model.User{ID: primitive.NewObjectID(), UserName: "weather", Bot: true, Owner: userModel.ID}
+	pollModel := model.Message{
+		ID:   primitive.NewObjectID(),
+		Chat: chatModel.ID,
+		Type: model.MessageTypePoll,
+		Poll: &model.Poll{Question: "Lunch?", Multiple: true, Options: []model.PollOption{
+			{Text: "Pizza", Voters: []primitive.ObjectID{userModel.ID}},
+			{Text: "Sushi", Voters: []primitive.ObjectID{blockedModel.ID}},
+			{Text: "Soup", Voters: []primitive.ObjectID{blockedModel.ID, userModel.ID}},
+		}},
+	}
+	messageExportRepoMock := new(mocks.MessageRepository)
+	messageExportRepoMock.On("EachUserMessage", userModel.ID, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(1).(func(model.Message) error)(messageModel)
+	})
+	messageExportRepoMock.On("FindUserDrafts", userModel.ID).Return([]model.Draft{{Chat: chatModel.ID, User: userModel.ID, Text: "draft"}}, nil)
+	messageExportRepoMock.On("FindScheduledMessages", userModel.ID).Return([]model.ScheduledMessage{
+		{ID: primitive.NewObjectID(), Chat: chatModel.ID, Author: userModel.ID, Text: "later", Status: model.ScheduledPending},
+	}, nil)
+	messageExportRepoMock.On("EachVotedPoll", userModel.ID, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(1).(func(model.Message) error)(pollModel)
+	})
+	userExportRepoMock := new(mocks.UserRepository)
+	userExportRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userExportRepoMock.On("FindUserByID", "unknown").Return(model.User{}, errors.New("not found"))
+	userExportRepoMock.On("FindBlocks", userModel).Return([]model.Block{{User: userModel.ID, Blocked: blockedModel.ID}}, nil)
+	userExportRepoMock.On("FindOwnedBots", userModel.ID).Return([]model.User{botModel}, nil)
+	userExportRepoMock.On("FindAPIKeys", botModel.ID).Return([]model.APIKey{{ID: primitive.NewObjectID(), Bot: botModel.ID, Hash: "secret_hash", Prefix: "bot_abc"}}, nil)
+	testObj := service.NewChatService(userExportRepoMock, chatExportRepoMock, messageExportRepoMock)
+
+	var out bytes.Buffer
+	err := testObj.ExportUser(view.UserRequest{UserID: userModel.ID.Hex()}, &out)
+	assert.NoError(err)
+	assert.NotContains(out.String(), "secret_hash")
+
+	var types []string
+	records := map[string]json.RawMessage{}
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		record := struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}{}
+		assert.NoError(decoder.Decode(&record))
+		types = append(types, record.Type)
+		records[record.Type] = record.Data
+	}
+	assert.Equal([]string{"profile", "chat", "message", "block", "notification_settings", "draft", "scheduled_message", "bot", "vote"}, types)
+
+	var block view.ExportBlock
+	assert.NoError(json.Unmarshal(records["block"], &block))
+	assert.Equal(blockedModel.ID.Hex(), block.UserID)
+
+	var settings view.ExportNotificationSettings
+	assert.NoError(json.Unmarshal(records["notification_settings"], &settings))
+	assert.Equal(view.ExportNotificationSettings{ChatID: chatModel.ID.Hex(), NotificationSettings: view.NotificationSettings{Mode: model.NotifyMentions}}, settings)
+
+	var bot view.ExportBot
+	assert.NoError(json.Unmarshal(records["bot"], &bot))
+	assert.Equal(botModel.ID.Hex(), bot.ID)
+	assert.Len(bot.Keys, 1)
+	assert.Equal("bot_abc", bot.Keys[0].Prefix)
+	assert.Empty(bot.Keys[0].Key)
+
+	var vote view.ExportVote
+	assert.NoError(json.Unmarshal(records["vote"], &vote))
+	assert.Equal(view.ExportVote{MessageID: pollModel.ID.Hex(), ChatID: chatModel.ID.Hex(), Options: []int{0, 2}}, vote)
+
+	out.Reset()
+	err = testObj.ExportUser(view.UserRequest{UserID: "unknown"}, &out)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(404, responseError.Status)
+	}
+	assert.Zero(out.Len())
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const maxForwardMessages = 100
+
+// ForwardMessages copies messages into another chat on behalf of the caller,
+// who must be a member of both chats. The copies keep a reference to the
+// original message, its chat and its author.
+func (c *ChatService) ForwardMessages(request view.ForwardMessagesRequest) (view.ForwardMessagesResponse, error) {
+	if len(request.MessagesID) > maxForwardMessages {
+		return view.ForwardMessagesResponse{}, errs.New(400, fmt.Sprintf("at most %d messages can be forwarded at once", maxForwardMessages), nil)
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.ForwardMessagesResponse{}, err
+	}
+
+	from, err := c.findChat(request.FromChatID)
+	if err != nil {
+		return view.ForwardMessagesResponse{}, err
+	}
+
+	to, err := c.findChat(request.ChatID)
+	if err != nil {
+		return view.ForwardMessagesResponse{}, err
+	}
+
+	if !isMember(from, user) || !isMember(to, user) {
+		return view.ForwardMessagesResponse{}, errs.New(403, "user is not a member of both chats", nil)
+	}
+
+	if peer, ok := directPeer(to, user); ok {
+		if err := c.checkDirect(user, peer); err != nil {
+			return view.ForwardMessagesResponse{}, err
+		}
+	}
+
+	c.touch(user)
+
+	// Every message is checked before anything is copied, so a bad ID
+	// doesn't leave a partial forward behind.
+	now := time.Now()
+	copies := make([]model.Message, 0, len(request.MessagesID))
+	for _, id := range request.MessagesID {
+		original, err := c.messageRepo.FindMessageByID(id)
+		if err != nil || original.Chat != from.ID || isExpired(original, now) {
+			return view.ForwardMessagesResponse{}, errs.New(404, "message not found", err)
+		}
+
+		if messageType(original) != model.MessageTypeText {
+			return view.ForwardMessagesResponse{}, errs.New(400, "only text messages can be forwarded", nil)
+		}
+
+		if original.ExpiresAt != 0 {
+			return view.ForwardMessagesResponse{}, errs.New(403, "self-destructing messages can't be forwarded", nil)
+		}
+
+		forwardedFrom := original.ForwardedFrom
+		if forwardedFrom == nil {
+			forwardedFrom = &model.ForwardedFrom{
+				Message: original.ID,
+				Chat:    original.Chat,
+				Author:  original.Author,
+			}
+		}
+
+		copies = append(copies, model.Message{
+			Chat:          to.ID,
+			Author:        user.ID,
+			Bot:           user.Bot,
+			Text:          original.Text,
+			Entities:      original.Entities,
+			Previews:      original.Previews,
+			ForwardedFrom: forwardedFrom,
+		})
+	}
+
+	ids, err := c.messageRepo.InsertMessages(copies)
+	if err != nil {
+		return view.ForwardMessagesResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	for i, message := range copies {
+		c.messageCreated(to, ids[i], message)
+	}
+
+	return view.ForwardMessagesResponse{IDs: ids}, nil
+}
@@ -0,0 +1,139 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestForwardMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	authorModel := model.User{ID: primitive.NewObjectID(), UserName: "Author"}
+	targetChatModel := model.Chat{
+		ID:    primitive.NewObjectID(),
+		Name:  "target_chat",
+		Users: []model.User{userModel, authorModel, {ID: primitive.NewObjectID(), UserName: "Other"}},
+	}
+	originalModel := messageModel
+	originalModel.ID = primitive.NewObjectID()
+	originalModel.Author = authorModel.ID
+	forwardedModel := messageModel
+	forwardedModel.ID = primitive.NewObjectID()
+	forwardedModel.ForwardedFrom = &model.ForwardedFrom{
+		Message: primitive.NewObjectID(),
+		Chat:    primitive.NewObjectID(),
+		Author:  authorModel.ID,
+	}
+
+	chatForwardRepoMock := new(mocks.ChatRepository)
+	chatForwardRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatForwardRepoMock.On("FindChatByID", targetChatModel.ID.Hex()).Return(targetChatModel, nil)
+	messageForwardRepoMock := new(mocks.MessageRepository)
+	messageForwardRepoMock.On("FindMessageByID", originalModel.ID.Hex()).Return(originalModel, nil)
+	messageForwardRepoMock.On("FindMessageByID", forwardedModel.ID.Hex()).Return(forwardedModel, nil)
+	copyIDs := []string{primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()}
+	messageForwardRepoMock.On("InsertMessages", mock.Anything).Return(copyIDs, nil)
+	testObj := service.NewChatService(userRepoMock, chatForwardRepoMock, messageForwardRepoMock)
+
+	forwardResponse, err := testObj.ForwardMessages(view.ForwardMessagesRequest{
+		FromChatID: chatModel.ID.Hex(),
+		ChatID:     targetChatModel.ID.Hex(),
+		UserID:     userModel.ID.Hex(),
+		MessagesID: []string{originalModel.ID.Hex(), forwardedModel.ID.Hex()},
+	})
+	assert.NoError(err)
+	assert.Equal(copyIDs, forwardResponse.IDs)
+	messageForwardRepoMock.AssertCalled(t, "InsertMessages", []model.Message{
+		{
+			Chat:          targetChatModel.ID,
+			Author:        userModel.ID,
+			Text:          originalModel.Text,
+			ForwardedFrom: &model.ForwardedFrom{Message: originalModel.ID, Chat: chatModel.ID, Author: authorModel.ID},
+		},
+		{
+			Chat:          targetChatModel.ID,
+			Author:        userModel.ID,
+			Text:          forwardedModel.Text,
+			ForwardedFrom: forwardedModel.ForwardedFrom,
+		},
+	})
+
+	// The original is not in the source chat.
+	_, err = testObj.ForwardMessages(view.ForwardMessagesRequest{
+		FromChatID: targetChatModel.ID.Hex(),
+		ChatID:     chatModel.ID.Hex(),
+		UserID:     userModel.ID.Hex(),
+		MessagesID: []string{originalModel.ID.Hex()},
+	})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(404, responseError.Status)
+	}
+
+	userForwardRepoMock := new(mocks.UserRepository)
+	userForwardRepoMock.On("FindUserByID", authorModel.ID.Hex()).Return(authorModel, nil)
+	testObj = service.NewChatService(userForwardRepoMock, chatForwardRepoMock, messageForwardRepoMock)
+	_, err = testObj.ForwardMessages(view.ForwardMessagesRequest{
+		FromChatID: chatModel.ID.Hex(),
+		ChatID:     targetChatModel.ID.Hex(),
+		UserID:     authorModel.ID.Hex(),
+		MessagesID: []string{originalModel.ID.Hex()},
+	})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	messageForwardRepoMock.AssertNumberOfCalls(t, "InsertMessages", 1)
+
+	// Nothing is stored when the copies can't all be stored.
+	messageFailRepoMock := new(mocks.MessageRepository)
+	messageFailRepoMock.On("FindMessageByID", originalModel.ID.Hex()).Return(originalModel, nil)
+	messageFailRepoMock.On("InsertMessages", mock.Anything).Return(nil, errors.New("insert failed"))
+	testObj = service.NewChatService(userRepoMock, chatForwardRepoMock, messageFailRepoMock)
+	forwardResponse, err = testObj.ForwardMessages(view.ForwardMessagesRequest{
+		FromChatID: chatModel.ID.Hex(),
+		ChatID:     targetChatModel.ID.Hex(),
+		UserID:     userModel.ID.Hex(),
+		MessagesID: []string{originalModel.ID.Hex()},
+	})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(500, responseError.Status)
+	}
+	assert.Empty(forwardResponse.IDs)
+	messageFailRepoMock.AssertNotCalled(t, "InsertMessage", mock.Anything)
+}
+
+func TestGetForwardedMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	forwardedModel := messageModel
+	forwardedModel.ForwardedFrom = &model.ForwardedFrom{
+		Message: primitive.NewObjectID(),
+		Chat:    primitive.NewObjectID(),
+		Author:  primitive.NewObjectID(),
+	}
+	messageForwardRepoMock := new(mocks.MessageRepository)
+	messageForwardRepoMock.On("FindMessages", chatModel).Return([]model.Message{forwardedModel}, nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageForwardRepoMock)
+
+	messagesResponse, err := testObj.GetMessages(view.MessagesRequest{СhatID: chatModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(&view.ForwardedFrom{
+		MessageID: forwardedModel.ForwardedFrom.Message.Hex(),
+		ChatID:    forwardedModel.ForwardedFrom.Chat.Hex(),
+		AuthorID:  forwardedModel.ForwardedFrom.Author.Hex(),
+	}, messagesResponse[0].ForwardedFrom)
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	maxIncomingWebhooks  = 10
+	incomingWebhookRate  = 1
+	incomingWebhookBurst = 10
+)
+
+// AddIncomingWebhook creates a bot and a secret URL that posts into the chat
+// as that bot. Only the owner manages the webhooks of a chat.
+func (c *ChatService) AddIncomingWebhook(request view.NewIncomingWebhookRequest) (view.IncomingWebhook, error) {
+	if !validUserName.MatchString(request.BotName) {
+		return view.IncomingWebhook{}, errs.New(400, "bot_name must be 3 to 32 letters, digits, '_', '.' or '-' and start with a letter or digit", nil)
+	}
+
+	chat, user, err := c.findWebhookChat(request.ChatID, request.UserID)
+	if err != nil {
+		return view.IncomingWebhook{}, err
+	}
+
+	hooks, err := c.chatRepo.FindIncomingWebhooks(chat.ID)
+	if err != nil {
+		return view.IncomingWebhook{}, errs.New(500, "internal server error", err)
+	}
+
+	if len(hooks) >= maxIncomingWebhooks {
+		return view.IncomingWebhook{}, errs.New(409, fmt.Sprintf("a chat can have at most %d incoming webhooks", maxIncomingWebhooks), nil)
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		return view.IncomingWebhook{}, errs.New(500, "internal server error", err)
+	}
+
+	botID, err := c.userRepo.InsertBot(model.User{UserName: request.BotName, DisplayName: request.BotName, Bot: true})
+	if isDuplicateKey(err) {
+		return view.IncomingWebhook{}, errs.New(409, "username is already taken", err)
+	}
+	if err != nil {
+		return view.IncomingWebhook{}, errs.New(500, "internal server error", err)
+	}
+
+	hook := model.IncomingWebhook{
+		Chat:      chat.ID,
+		Creator:   user.ID,
+		Token:     token,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+	hook.Bot, _ = primitive.ObjectIDFromHex(botID)
+
+	id, err := c.chatRepo.InsertIncomingWebhook(hook)
+	if err != nil {
+		return view.IncomingWebhook{}, errs.New(500, "internal server error", err)
+	}
+	hook.ID, _ = primitive.ObjectIDFromHex(id)
+
+	return incomingWebhookToView(hook), nil
+}
+
+func (c *ChatService) GetIncomingWebhooks(request view.WebhooksRequest) (view.IncomingWebhooksResponse, error) {
+	hooksView := view.IncomingWebhooksResponse{}
+
+	chat, _, err := c.findWebhookChat(request.ChatID, request.UserID)
+	if err != nil {
+		return view.IncomingWebhooksResponse{}, err
+	}
+
+	hooks, err := c.chatRepo.FindIncomingWebhooks(chat.ID)
+	if err != nil {
+		return view.IncomingWebhooksResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	for _, hook := range hooks {
+		hooksView = append(hooksView, incomingWebhookToView(hook))
+	}
+
+	return hooksView, nil
+}
+
+// DeleteIncomingWebhook revokes the URL and deactivates its bot. The
+// messages the bot posted stay in the chat.
+func (c *ChatService) DeleteIncomingWebhook(request view.DeleteWebhookRequest) (view.DeleteWebhookResponse, error) {
+	hook, err := c.chatRepo.FindIncomingWebhookByID(request.WebhookID)
+	if err != nil {
+		return view.DeleteWebhookResponse{}, errs.New(404, "webhook not found", err)
+	}
+
+	if _, _, err := c.findWebhookChat(hook.Chat.Hex(), request.UserID); err != nil {
+		return view.DeleteWebhookResponse{}, err
+	}
+
+	if err := c.chatRepo.DeleteIncomingWebhook(hook); err != nil {
+		return view.DeleteWebhookResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	if err := c.userRepo.DeactivateUser(model.User{ID: hook.Bot}); err != nil {
+		return view.DeleteWebhookResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	return view.DeleteWebhookResponse{ID: hook.ID.Hex(), Deleted: true}, nil
+}
+
+// PostIncomingWebhook posts the message of an external system into the chat
+// of the webhook. It goes through the same checks as messages of users.
+func (c *ChatService) PostIncomingWebhook(token string, message view.IncomingWebhookMessage) (view.NewMessageResponse, error) {
+	hook, err := c.chatRepo.FindIncomingWebhookByToken(token)
+	if err != nil {
+		return view.NewMessageResponse{}, errs.New(404, "webhook not found", err)
+	}
+
+	if !c.hookLimiter.Allow(hook.ID.Hex()) {
+		return view.NewMessageResponse{}, errs.New(429, "too many messages", nil)
+	}
+
+	return c.addMessage(view.NewMessageRequest{
+		ChatID: hook.Chat.Hex(),
+		UserID: hook.Bot.Hex(),
+		Text:   message.Text,
+	}, primitive.NilObjectID)
+}
+
+func incomingWebhookToView(hook model.IncomingWebhook) view.IncomingWebhook {
+	return view.IncomingWebhook{
+		ID:        hook.ID.Hex(),
+		ChatID:    hook.Chat.Hex(),
+		CreatorID: hook.Creator.Hex(),
+		BotID:     hook.Bot.Hex(),
+		Token:     hook.Token,
+		CreatedAt: hook.CreatedAt.Time().String(),
+	}
+}
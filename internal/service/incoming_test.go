@@ -0,0 +1,99 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAddIncomingWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	botModel := model.User{ID: primitive.NewObjectID(), UserName: "ci-bot", Bot: true}
+
+	userIncomingRepoMock := new(mocks.UserRepository)
+	userIncomingRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userIncomingRepoMock.On("InsertBot", model.User{UserName: "ci-bot", DisplayName: "ci-bot", Bot: true}).Return(botModel.ID.Hex(), nil)
+	chatIncomingRepoMock := new(mocks.ChatRepository)
+	chatIncomingRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatIncomingRepoMock.On("FindIncomingWebhooks", chatModel.ID).Return([]model.IncomingWebhook{}, nil)
+	chatIncomingRepoMock.On("InsertIncomingWebhook", mock.Anything).Return(primitive.NewObjectID().Hex(), nil)
+	testObj := service.NewChatService(userIncomingRepoMock, chatIncomingRepoMock, messageRepoMock)
+
+	hookRequest := view.NewIncomingWebhookRequest{
+		ChatID:  chatModel.ID.Hex(),
+		UserID:  userModel.ID.Hex(),
+		BotName: "ci-bot",
+	}
+
+	hookResponse, err := testObj.AddIncomingWebhook(hookRequest)
+	assert.NoError(err)
+	assert.NotEmpty(hookResponse.Token)
+	assert.Equal(botModel.ID.Hex(), hookResponse.BotID)
+	assert.Equal(chatModel.ID.Hex(), hookResponse.ChatID)
+
+	hookErrRequest := hookRequest
+	hookErrRequest.BotName = "c"
+	_, err = testObj.AddIncomingWebhook(hookErrRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+}
+
+func TestPostIncomingWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	botModel := model.User{ID: primitive.NewObjectID(), UserName: "ci-bot", Bot: true}
+	hookModel := model.IncomingWebhook{ID: primitive.NewObjectID(), Chat: chatModel.ID, Bot: botModel.ID, Token: "token"}
+
+	userIncomingRepoMock := new(mocks.UserRepository)
+	userIncomingRepoMock.On("FindUserByID", botModel.ID.Hex()).Return(botModel, nil)
+	chatIncomingRepoMock := new(mocks.ChatRepository)
+	chatIncomingRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatIncomingRepoMock.On("FindIncomingWebhookByToken", "token").Return(hookModel, nil)
+	chatIncomingRepoMock.On("FindIncomingWebhookByToken", "unknown").Return(model.IncomingWebhook{}, errors.New("no documents"))
+	messageIncomingRepoMock := new(mocks.MessageRepository)
+	messageIncomingRepoMock.On("InsertMessage", mock.Anything).Return(primitive.NewObjectID().Hex(), nil)
+	testObj := service.NewChatService(userIncomingRepoMock, chatIncomingRepoMock, messageIncomingRepoMock)
+
+	messageResponse, err := testObj.PostIncomingWebhook("token", view.IncomingWebhookMessage{Text: "Build **passed**"})
+	assert.NoError(err)
+	assert.NotEmpty(messageResponse.ID)
+	messageIncomingRepoMock.AssertCalled(t, "InsertMessage", model.Message{
+		Chat:     chatModel.ID,
+		Author:   botModel.ID,
+		Bot:      true,
+		Text:     "Build passed",
+		Entities: []model.Entity{{Type: model.EntityBold, Offset: 6, Length: 6}},
+	})
+
+	_, err = testObj.PostIncomingWebhook("unknown", view.IncomingWebhookMessage{Text: "Build passed"})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(404, responseError.Status)
+	}
+
+	// The first message took one of the ten messages of the burst.
+	for i := 0; i < 9; i++ {
+		_, err = testObj.PostIncomingWebhook("token", view.IncomingWebhookMessage{Text: "Build passed"})
+		assert.NoError(err)
+	}
+	_, err = testObj.PostIncomingWebhook("token", view.IncomingWebhookMessage{Text: "Build passed"})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(429, responseError.Status)
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const maxInviteUses = 10000
+
+func (c *ChatService) AddInvite(request view.NewInviteRequest) (view.Invite, error) {
+	if request.MaxUses < 1 || request.MaxUses > maxInviteUses {
+		return view.Invite{}, errs.New(400, fmt.Sprintf("max_uses must be between 1 and %d", maxInviteUses), nil)
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, request.ExpiresAt)
+	if err != nil {
+		return view.Invite{}, errs.New(400, "expires_at must be an RFC 3339 timestamp", err)
+	}
+
+	if !expiresAt.After(time.Now()) {
+		return view.Invite{}, errs.New(400, "expires_at must be in the future", nil)
+	}
+
+	chat, err := c.findChat(request.ChatID)
+	if err != nil {
+		return view.Invite{}, err
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.Invite{}, err
+	}
+
+	if !isMember(chat, user) {
+		return view.Invite{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	if chat.Direct {
+		return view.Invite{}, errs.New(403, "direct chats can't have invites", nil)
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		return view.Invite{}, errs.New(500, "internal server error", err)
+	}
+
+	invite := model.Invite{
+		Token:     token,
+		Chat:      chat.ID,
+		Creator:   user.ID,
+		MaxUses:   request.MaxUses,
+		Remaining: request.MaxUses,
+		ExpiresAt: primitive.NewDateTimeFromTime(expiresAt),
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	if _, err := c.chatRepo.InsertInvite(invite); err != nil {
+		return view.Invite{}, errs.New(500, "internal server error", err)
+	}
+
+	return inviteToView(invite), nil
+}
+
+func (c *ChatService) GetInvites(request view.InvitesRequest) (view.InvitesResponse, error) {
+	var invitesView []view.Invite
+
+	chat, err := c.findChat(request.ChatID)
+	if err != nil {
+		return view.InvitesResponse{}, err
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.InvitesResponse{}, err
+	}
+
+	if !isMember(chat, user) {
+		return view.InvitesResponse{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	invitesModel, err := c.chatRepo.FindInvites(chat)
+	if err != nil {
+		return view.InvitesResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	for _, inviteModel := range invitesModel {
+		invitesView = append(invitesView, inviteToView(inviteModel))
+	}
+
+	return invitesView, nil
+}
+
+// RevokeInvite is allowed for the creator of the invite and the chat owner.
+func (c *ChatService) RevokeInvite(request view.RevokeInviteRequest) (view.Invite, error) {
+	invite, err := c.chatRepo.FindInviteByToken(request.Token)
+	if err != nil {
+		return view.Invite{}, errs.New(404, "invite not found", err)
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.Invite{}, err
+	}
+
+	if invite.Creator != user.ID {
+		chat, err := c.findChat(invite.Chat.Hex())
+		if err != nil {
+			return view.Invite{}, err
+		}
+
+		if chatOwner(chat) != user.ID {
+			return view.Invite{}, errs.New(403, "only the creator or the chat owner can revoke the invite", nil)
+		}
+	}
+
+	if err := c.chatRepo.RevokeInvite(invite); err != nil {
+		return view.Invite{}, errs.New(500, "internal server error", err)
+	}
+	invite.Revoked = true
+
+	return inviteToView(invite), nil
+}
+
+// RedeemInvite adds the user to the chat of the invite. Members redeeming an
+// invite of their own chat do not use it up.
+func (c *ChatService) RedeemInvite(request view.RedeemInviteRequest) (view.Chat, error) {
+	invite, err := c.chatRepo.FindInviteByToken(request.Token)
+	if err != nil {
+		return view.Chat{}, errs.New(404, "invite not found", err)
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.Chat{}, err
+	}
+
+	chat, err := c.findChat(invite.Chat.Hex())
+	if err != nil {
+		return view.Chat{}, err
+	}
+
+	if isMember(chat, user) {
+		return chatToView(chat, user), nil
+	}
+
+	// Invites of direct chats may date from before they were refused.
+	if chat.Direct {
+		return view.Chat{}, errs.New(403, "direct chats can't be joined", nil)
+	}
+
+	if _, err := c.chatRepo.UseInvite(invite); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return view.Chat{}, errs.New(410, "invite is revoked, expired or used up", nil)
+		}
+
+		return view.Chat{}, errs.New(500, "internal server error", err)
+	}
+
+	chat, err = c.addMember(chat, user, systemMessage{
+		model.SystemEvent{Event: model.SystemMemberJoined, Via: "invite"},
+		fmt.Sprintf("%s joined the chat via an invite link", user.UserName),
+	})
+	if err != nil {
+		return view.Chat{}, err
+	}
+
+	return chatToView(chat, user), nil
+}
+
+func newInviteToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func inviteToView(invite model.Invite) view.Invite {
+	return view.Invite{
+		Token:     invite.Token,
+		ChatID:    invite.Chat.Hex(),
+		CreatorID: invite.Creator.Hex(),
+		MaxUses:   invite.MaxUses,
+		Remaining: invite.Remaining,
+		Revoked:   invite.Revoked,
+		ExpiresAt: invite.ExpiresAt.Time().UTC().Format(time.RFC3339),
+		CreatedAt: invite.CreatedAt.Time().String(),
+	}
+}
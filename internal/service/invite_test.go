@@ -0,0 +1,169 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAddInvite(t *testing.T) {
+	assert := assert.New(t)
+
+	chatInviteRepoMock := new(mocks.ChatRepository)
+	chatInviteRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatInviteRepoMock.On("InsertInvite", mock.Anything).Return(primitive.NewObjectID().Hex(), nil)
+	testObj := service.NewChatService(userRepoMock, chatInviteRepoMock, messageRepoMock)
+
+	expiresAt := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	inviteRequest := view.NewInviteRequest{
+		ChatID:    chatModel.ID.Hex(),
+		UserID:    userModel.ID.Hex(),
+		MaxUses:   5,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	}
+
+	inviteResponse, err := testObj.AddInvite(inviteRequest)
+	assert.NoError(err)
+	assert.NotEmpty(inviteResponse.Token)
+	assert.Equal(chatModel.ID.Hex(), inviteResponse.ChatID)
+	assert.Equal(5, inviteResponse.MaxUses)
+	assert.Equal(5, inviteResponse.Remaining)
+	assert.Equal(expiresAt.Format(time.RFC3339), inviteResponse.ExpiresAt)
+
+	inviteErrRequest := inviteRequest
+	inviteErrRequest.ExpiresAt = time.Now().Add(-time.Hour).Format(time.RFC3339)
+	inviteResponse, err = testObj.AddInvite(inviteErrRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+	assert.Empty(inviteResponse)
+
+	inviteErrRequest = inviteRequest
+	inviteErrRequest.MaxUses = 0
+	inviteResponse, err = testObj.AddInvite(inviteErrRequest)
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+	assert.Empty(inviteResponse)
+
+	// Direct chats stay between their two users.
+	directChatModel := model.Chat{ID: primitive.NewObjectID(), Direct: true, Users: []model.User{userModel, {ID: primitive.NewObjectID()}}}
+	chatInviteRepoMock.On("FindChatByID", directChatModel.ID.Hex()).Return(directChatModel, nil)
+	inviteErrRequest = inviteRequest
+	inviteErrRequest.ChatID = directChatModel.ID.Hex()
+	inviteResponse, err = testObj.AddInvite(inviteErrRequest)
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	assert.Empty(inviteResponse)
+	chatInviteRepoMock.AssertNumberOfCalls(t, "InsertInvite", 1)
+}
+
+func TestRevokeInvite(t *testing.T) {
+	assert := assert.New(t)
+
+	inviteModel := model.Invite{
+		ID:      primitive.NewObjectID(),
+		Token:   "token",
+		Chat:    chatModel.ID,
+		Creator: primitive.NewObjectID(),
+	}
+	chatInviteRepoMock := new(mocks.ChatRepository)
+	chatInviteRepoMock.On("FindInviteByToken", "token").Return(inviteModel, nil)
+	chatInviteRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatInviteRepoMock.On("RevokeInvite", inviteModel).Return(nil)
+	testObj := service.NewChatService(userRepoMock, chatInviteRepoMock, messageRepoMock)
+
+	inviteResponse, err := testObj.RevokeInvite(view.RevokeInviteRequest{Token: "token", UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.True(inviteResponse.Revoked)
+	chatInviteRepoMock.AssertCalled(t, "RevokeInvite", inviteModel)
+
+	strangerModel := model.User{ID: primitive.NewObjectID(), UserName: "Stranger"}
+	userStrangerRepoMock := new(mocks.UserRepository)
+	userStrangerRepoMock.On("FindUserByID", strangerModel.ID.Hex()).Return(strangerModel, nil)
+	testObj = service.NewChatService(userStrangerRepoMock, chatInviteRepoMock, messageRepoMock)
+	inviteResponse, err = testObj.RevokeInvite(view.RevokeInviteRequest{Token: "token", UserID: strangerModel.ID.Hex()})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	assert.Empty(inviteResponse)
+}
+
+func TestRedeemInvite(t *testing.T) {
+	assert := assert.New(t)
+
+	joinerModel := model.User{ID: primitive.NewObjectID(), UserName: "Joiner"}
+	userJoinerRepoMock := new(mocks.UserRepository)
+	userJoinerRepoMock.On("FindUserByID", joinerModel.ID.Hex()).Return(joinerModel, nil)
+
+	inviteModel := model.Invite{
+		ID:        primitive.NewObjectID(),
+		Token:     "token",
+		Chat:      chatModel.ID,
+		Creator:   userModel.ID,
+		MaxUses:   1,
+		Remaining: 1,
+	}
+	chatInviteRepoMock := new(mocks.ChatRepository)
+	chatInviteRepoMock.On("FindInviteByToken", "token").Return(inviteModel, nil)
+	chatInviteRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatInviteRepoMock.On("UseInvite", inviteModel).Return(model.Invite{}, nil).Once()
+	chatInviteRepoMock.On("UseInvite", inviteModel).Return(model.Invite{}, mongo.ErrNoDocuments)
+	chatInviteRepoMock.On("AddChatMember", chatModel, joinerModel).Return(nil)
+	messageInviteRepoMock := new(mocks.MessageRepository)
+	messageInviteRepoMock.On("InsertMessage", mock.MatchedBy(func(message model.Message) bool {
+		return message.Author == joinerModel.ID && message.Text == "Joiner joined the chat via an invite link" && message.System.Via == "invite"
+	})).Return(primitive.NewObjectID().Hex(), nil)
+	testObj := service.NewChatService(userJoinerRepoMock, chatInviteRepoMock, messageInviteRepoMock)
+
+	redeemRequest := view.RedeemInviteRequest{Token: "token", UserID: joinerModel.ID.Hex()}
+
+	chatResponse, err := testObj.RedeemInvite(redeemRequest)
+	assert.NoError(err)
+	assert.Len(chatResponse.Users, 2)
+	chatInviteRepoMock.AssertCalled(t, "AddChatMember", chatModel, joinerModel)
+
+	chatResponse, err = testObj.RedeemInvite(redeemRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(410, responseError.Status)
+	}
+	assert.Empty(chatResponse)
+
+	testObj = service.NewChatService(userRepoMock, chatInviteRepoMock, messageInviteRepoMock)
+	chatResponse, err = testObj.RedeemInvite(view.RedeemInviteRequest{Token: "token", UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(chatModel.ID.Hex(), chatResponse.ID)
+	chatInviteRepoMock.AssertNumberOfCalls(t, "UseInvite", 2)
+
+	directChatModel := model.Chat{ID: primitive.NewObjectID(), Direct: true, Users: []model.User{userModel, {ID: primitive.NewObjectID()}}}
+	chatInviteRepoMock.On("FindInviteByToken", "direct").Return(model.Invite{ID: primitive.NewObjectID(), Chat: directChatModel.ID, Remaining: 1}, nil)
+	chatInviteRepoMock.On("FindChatByID", directChatModel.ID.Hex()).Return(directChatModel, nil)
+	testObj = service.NewChatService(userJoinerRepoMock, chatInviteRepoMock, messageInviteRepoMock)
+	_, err = testObj.RedeemInvite(view.RedeemInviteRequest{Token: "direct", UserID: joinerModel.ID.Hex()})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	chatInviteRepoMock.AssertNumberOfCalls(t, "UseInvite", 2)
+}
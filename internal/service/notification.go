@@ -0,0 +1,165 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+func (c *ChatService) GetNotificationSettings(request view.NotificationSettingsRequest) (view.NotificationSettings, error) {
+	chat, err := c.findChat(request.ChatID)
+	if err != nil {
+		return view.NotificationSettings{}, err
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.NotificationSettings{}, err
+	}
+
+	if !isMember(chat, user) {
+		return view.NotificationSettings{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	settings, err := c.chatRepo.FindNotificationSettings(chat, user)
+	if err != nil {
+		return view.NotificationSettings{}, errs.New(500, "internal server error", err)
+	}
+
+	return settingsToView(settings), nil
+}
+
+func (c *ChatService) UpdateNotificationSettings(request view.UpdateNotificationSettingsRequest) (view.NotificationSettings, error) {
+	settings := model.NotificationSettings{Mode: request.Mode}
+
+	switch request.Mode {
+	case model.NotifyAll, model.NotifyMentions, model.NotifyMuted:
+	default:
+		return view.NotificationSettings{}, errs.New(400, "mode must be all, mentions or muted", nil)
+	}
+
+	if request.MutedUntil != "" {
+		if request.Mode != model.NotifyMuted {
+			return view.NotificationSettings{}, errs.New(400, "muted_until is only allowed for muted mode", nil)
+		}
+
+		mutedUntil, err := time.Parse(time.RFC3339, request.MutedUntil)
+		if err != nil {
+			return view.NotificationSettings{}, errs.New(400, "muted_until must be an RFC 3339 timestamp", err)
+		}
+
+		settings.MutedUntil = primitive.NewDateTimeFromTime(mutedUntil)
+	}
+
+	chat, err := c.findChat(request.ChatID)
+	if err != nil {
+		return view.NotificationSettings{}, err
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.NotificationSettings{}, err
+	}
+
+	if !isMember(chat, user) {
+		return view.NotificationSettings{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	settings.Chat = chat.ID
+	settings.User = user.ID
+	if err := c.chatRepo.UpsertNotificationSettings(settings); err != nil {
+		return view.NotificationSettings{}, errs.New(500, "internal server error", err)
+	}
+
+	return settingsToView(settings), nil
+}
+
+// NotificationRecipients returns the members that should be notified about a
+// new message, so that mutes and mentions-only settings are respected. New
+// message events and webhooks carry them.
+func (c *ChatService) NotificationRecipients(chat model.Chat, message model.Message) ([]model.User, error) {
+	settings, err := c.chatRepo.FindChatNotificationSettings(chat)
+	if err != nil {
+		return nil, err
+	}
+
+	modes := make(map[primitive.ObjectID]string, len(settings))
+	for _, s := range settings {
+		modes[s.User] = effectiveMode(s, time.Now())
+	}
+
+	// Members who blocked the author are never alerted about the message.
+	blocks, err := c.userRepo.FindBlockedBy(model.User{ID: message.Author})
+	if err != nil {
+		return nil, err
+	}
+
+	blockedBy := make(map[primitive.ObjectID]bool, len(blocks))
+	for _, block := range blocks {
+		blockedBy[block.User] = true
+	}
+
+	var recipients []model.User
+	for _, member := range chat.Users {
+		if member.ID == message.Author || blockedBy[member.ID] {
+			continue
+		}
+
+		mode, ok := modes[member.ID]
+		if !ok {
+			mode = model.NotifyAll
+		}
+
+		switch mode {
+		case model.NotifyAll:
+			recipients = append(recipients, member)
+		case model.NotifyMentions:
+			if isMentioned(member, message.Text) {
+				recipients = append(recipients, member)
+			}
+		}
+	}
+
+	return recipients, nil
+}
+
+// effectiveMode resolves an expired mute back to notifying about everything.
+func effectiveMode(settings model.NotificationSettings, now time.Time) string {
+	if settings.Mode == "" {
+		return model.NotifyAll
+	}
+
+	if settings.Mode == model.NotifyMuted && settings.MutedUntil != 0 && !now.Before(settings.MutedUntil.Time()) {
+		return model.NotifyAll
+	}
+
+	return settings.Mode
+}
+
+func isMentioned(user model.User, text string) bool {
+	for _, word := range strings.Fields(text) {
+		word = strings.TrimRight(word, ".,!?:;")
+		if strings.EqualFold(word, "@"+user.UserName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func settingsToView(settings model.NotificationSettings) view.NotificationSettings {
+	settingsView := view.NotificationSettings{
+		Mode: effectiveMode(settings, time.Now()),
+	}
+
+	if settingsView.Mode == model.NotifyMuted && settings.MutedUntil != 0 {
+		settingsView.MutedUntil = settings.MutedUntil.Time().UTC().Format(time.RFC3339)
+	}
+
+	return settingsView
+}
@@ -0,0 +1,155 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetNotificationSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	mutedUntil := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	settingsModel := model.NotificationSettings{
+		Chat:       chatModel.ID,
+		User:       userModel.ID,
+		Mode:       model.NotifyMuted,
+		MutedUntil: primitive.NewDateTimeFromTime(mutedUntil),
+	}
+	chatSettingsRepoMock := new(mocks.ChatRepository)
+	chatSettingsRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatSettingsRepoMock.On("FindNotificationSettings", chatModel, userModel).Return(settingsModel, nil)
+	testObj := service.NewChatService(userRepoMock, chatSettingsRepoMock, messageRepoMock)
+
+	settingsRequest := view.NotificationSettingsRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+	}
+
+	settingsResponse, err := testObj.GetNotificationSettings(settingsRequest)
+	assert.NoError(err)
+	assert.Equal(model.NotifyMuted, settingsResponse.Mode)
+	assert.Equal(mutedUntil.Format(time.RFC3339), settingsResponse.MutedUntil)
+
+	settingsModel.MutedUntil = primitive.NewDateTimeFromTime(time.Now().Add(-time.Hour))
+	chatExpiredRepoMock := new(mocks.ChatRepository)
+	chatExpiredRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatExpiredRepoMock.On("FindNotificationSettings", chatModel, userModel).Return(settingsModel, nil)
+	testObj = service.NewChatService(userRepoMock, chatExpiredRepoMock, messageRepoMock)
+	settingsResponse, err = testObj.GetNotificationSettings(settingsRequest)
+	assert.NoError(err)
+	assert.Equal(view.NotificationSettings{Mode: model.NotifyAll}, settingsResponse)
+}
+
+func TestUpdateNotificationSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	chatSettingsRepoMock := new(mocks.ChatRepository)
+	chatSettingsRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatSettingsRepoMock.On("UpsertNotificationSettings", mock.Anything).Return(nil)
+	testObj := service.NewChatService(userRepoMock, chatSettingsRepoMock, messageRepoMock)
+
+	settingsRequest := view.UpdateNotificationSettingsRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		Mode:   model.NotifyMentions,
+	}
+
+	settingsResponse, err := testObj.UpdateNotificationSettings(settingsRequest)
+	assert.NoError(err)
+	assert.Equal(model.NotifyMentions, settingsResponse.Mode)
+	chatSettingsRepoMock.AssertCalled(t, "UpsertNotificationSettings", model.NotificationSettings{
+		Chat: chatModel.ID,
+		User: userModel.ID,
+		Mode: model.NotifyMentions,
+	})
+
+	settingsErrRequest := view.UpdateNotificationSettingsRequest{
+		ChatID:     chatModel.ID.Hex(),
+		UserID:     userModel.ID.Hex(),
+		Mode:       model.NotifyMuted,
+		MutedUntil: "tomorrow",
+	}
+	settingsResponse, err = testObj.UpdateNotificationSettings(settingsErrRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+	assert.Empty(settingsResponse)
+
+	settingsErrRequest = view.UpdateNotificationSettingsRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		Mode:   "sometimes",
+	}
+	settingsResponse, err = testObj.UpdateNotificationSettings(settingsErrRequest)
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+	assert.Empty(settingsResponse)
+}
+
+func TestNotificationRecipients(t *testing.T) {
+	assert := assert.New(t)
+
+	mentionsModel := model.User{ID: primitive.NewObjectID(), UserName: "Mentions"}
+	mutedModel := model.User{ID: primitive.NewObjectID(), UserName: "Muted"}
+	allModel := model.User{ID: primitive.NewObjectID(), UserName: "All"}
+	groupChatModel := model.Chat{
+		ID:    primitive.NewObjectID(),
+		Name:  "group_chat",
+		Users: []model.User{userModel, mentionsModel, mutedModel, allModel},
+	}
+
+	chatSettingsRepoMock := new(mocks.ChatRepository)
+	chatSettingsRepoMock.On("FindChatNotificationSettings", groupChatModel).Return([]model.NotificationSettings{
+		{Chat: groupChatModel.ID, User: mentionsModel.ID, Mode: model.NotifyMentions},
+		{Chat: groupChatModel.ID, User: mutedModel.ID, Mode: model.NotifyMuted},
+	}, nil)
+	testObj := service.NewChatService(userRepoMock, chatSettingsRepoMock, messageRepoMock)
+
+	message := model.Message{Chat: groupChatModel.ID, Author: userModel.ID, Text: "hello"}
+	recipients, err := testObj.NotificationRecipients(groupChatModel, message)
+	assert.NoError(err)
+	assert.Equal([]model.User{allModel}, recipients)
+
+	message.Text = "hello @mentions, @muted!"
+	recipients, err = testObj.NotificationRecipients(groupChatModel, message)
+	assert.NoError(err)
+	assert.Equal([]model.User{mentionsModel, allModel}, recipients)
+
+	// Everyone else gets new messages, only the recipients are alerted.
+	chatSettingsRepoMock.On("FindChatByID", groupChatModel.ID.Hex()).Return(groupChatModel, nil)
+	messageSettingsRepoMock := new(mocks.MessageRepository)
+	messageSettingsRepoMock.On("InsertMessage", mock.Anything).Return(primitive.NewObjectID().Hex(), nil)
+	published := make(chan []primitive.ObjectID, 2)
+	notified := make(chan []primitive.ObjectID, 1)
+	eventHubMock := new(mocks.EventHub)
+	eventHubMock.On("Publish", mock.Anything, mock.Anything).Return().Run(func(args mock.Arguments) {
+		users := args.Get(0).([]primitive.ObjectID)
+		if args.Get(1).(model.Event).Type == model.EventNotification {
+			notified <- users
+		} else {
+			published <- users
+		}
+	})
+	testObj = service.NewChatService(userRepoMock, chatSettingsRepoMock, messageSettingsRepoMock, service.WithEvents(eventHubMock))
+
+	_, err = testObj.AddMessage(view.NewMessageRequest{ChatID: groupChatModel.ID.Hex(), UserID: userModel.ID.Hex(), Text: "hello"})
+	assert.NoError(err)
+	assert.Equal([]primitive.ObjectID{mentionsModel.ID, mutedModel.ID, allModel.ID}, <-published)
+	assert.Equal([]primitive.ObjectID{allModel.ID}, <-notified)
+}
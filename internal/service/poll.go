@@ -0,0 +1,189 @@
+package service
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 10
+	maxPollQuestion     = 300
+	maxPollOptionLength = 100
+)
+
+// Vote records the caller's choice in a poll. A single choice poll takes
+// exactly one option and replaces the previous vote.
+func (c *ChatService) Vote(request view.VoteRequest) (view.Message, error) {
+	message, user, err := c.findPoll(request.MessageID, request.UserID)
+	if err != nil {
+		return view.Message{}, err
+	}
+
+	if len(request.Options) == 0 || (!message.Poll.Multiple && len(request.Options) > 1) {
+		return view.Message{}, errs.New(400, "a single choice poll takes exactly one option", nil)
+	}
+
+	if err := checkChoices(*message.Poll, request.Options); err != nil {
+		return view.Message{}, err
+	}
+
+	voted, err := c.messageRepo.VotePoll(message.ID, user.ID, request.Options, !message.Poll.Multiple)
+	if err == mongo.ErrNoDocuments {
+		return view.Message{}, errs.New(409, "another vote of the user got in first", err)
+	}
+	if err != nil {
+		return view.Message{}, errs.New(500, "internal server error", err)
+	}
+
+	return messageToView(voted), nil
+}
+
+// Unvote withdraws the caller's votes for the options, or all of them when
+// no options are given.
+func (c *ChatService) Unvote(request view.VoteRequest) (view.Message, error) {
+	message, user, err := c.findPoll(request.MessageID, request.UserID)
+	if err != nil {
+		return view.Message{}, err
+	}
+
+	if err := checkChoices(*message.Poll, request.Options); err != nil {
+		return view.Message{}, err
+	}
+
+	unvoted, err := c.messageRepo.UnvotePoll(message.ID, user.ID, request.Options)
+	if err != nil {
+		return view.Message{}, errs.New(500, "internal server error", err)
+	}
+
+	return messageToView(unvoted), nil
+}
+
+// findPoll returns an open poll of a chat the user belongs to.
+func (c *ChatService) findPoll(messageID string, userID string) (model.Message, model.User, error) {
+	user, err := c.findUser(userID)
+	if err != nil {
+		return model.Message{}, model.User{}, err
+	}
+
+	message, err := c.messageRepo.FindMessageByID(messageID)
+	if err != nil || message.Poll == nil || isExpired(message, time.Now()) {
+		return model.Message{}, model.User{}, errs.New(404, "poll not found", err)
+	}
+
+	chat, err := c.findChat(message.Chat.Hex())
+	if err != nil {
+		return model.Message{}, model.User{}, err
+	}
+
+	if !isMember(chat, user) {
+		return model.Message{}, model.User{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	if isClosed(*message.Poll, time.Now()) {
+		return model.Message{}, model.User{}, errs.New(409, "poll is closed", nil)
+	}
+
+	c.touch(user)
+
+	return message, user, nil
+}
+
+func newPoll(request view.NewPoll) (model.Poll, error) {
+	if request.Question == "" || utf8.RuneCountInString(request.Question) > maxPollQuestion {
+		return model.Poll{}, errs.New(400, fmt.Sprintf("question must be between 1 and %d characters", maxPollQuestion), nil)
+	}
+
+	if len(request.Options) < minPollOptions || len(request.Options) > maxPollOptions {
+		return model.Poll{}, errs.New(400, fmt.Sprintf("a poll takes between %d and %d options", minPollOptions, maxPollOptions), nil)
+	}
+
+	poll := model.Poll{
+		Question:  request.Question,
+		Multiple:  request.Multiple,
+		Anonymous: request.Anonymous,
+	}
+
+	for _, option := range request.Options {
+		if option == "" || utf8.RuneCountInString(option) > maxPollOptionLength {
+			return model.Poll{}, errs.New(400, fmt.Sprintf("options must be between 1 and %d characters", maxPollOptionLength), nil)
+		}
+
+		poll.Options = append(poll.Options, model.PollOption{Text: option, Voters: []primitive.ObjectID{}})
+	}
+
+	if request.ClosesAt != "" {
+		closesAt, err := time.Parse(time.RFC3339, request.ClosesAt)
+		if err != nil {
+			return model.Poll{}, errs.New(400, "closes_at must be an RFC 3339 timestamp", err)
+		}
+
+		if !closesAt.After(time.Now()) {
+			return model.Poll{}, errs.New(400, "closes_at must be in the future", nil)
+		}
+
+		poll.ClosesAt = primitive.NewDateTimeFromTime(closesAt)
+	}
+
+	return poll, nil
+}
+
+func checkChoices(poll model.Poll, choices []int) error {
+	seen := make(map[int]bool, len(choices))
+	for _, choice := range choices {
+		if choice < 0 || choice >= len(poll.Options) || seen[choice] {
+			return errs.New(400, fmt.Sprintf("options must be distinct indexes between 0 and %d", len(poll.Options)-1), nil)
+		}
+
+		seen[choice] = true
+	}
+
+	return nil
+}
+
+func isClosed(poll model.Poll, now time.Time) bool {
+	return poll.ClosesAt != 0 && !poll.ClosesAt.Time().After(now)
+}
+
+// pollToView counts the votes. Voters are only listed for polls with
+// visible votes.
+func pollToView(poll model.Poll) view.Poll {
+	pollView := view.Poll{
+		Question:  poll.Question,
+		Multiple:  poll.Multiple,
+		Anonymous: poll.Anonymous,
+		Closed:    isClosed(poll, time.Now()),
+	}
+
+	if poll.ClosesAt != 0 {
+		pollView.ClosesAt = poll.ClosesAt.Time().UTC().Format(time.RFC3339)
+	}
+
+	voters := make(map[primitive.ObjectID]bool)
+	for _, option := range poll.Options {
+		optionView := view.PollOption{
+			Text:  option.Text,
+			Votes: len(option.Voters),
+		}
+
+		for _, voter := range option.Voters {
+			voters[voter] = true
+			if !poll.Anonymous {
+				optionView.Voters = append(optionView.Voters, voter.Hex())
+			}
+		}
+
+		pollView.Options = append(pollView.Options, optionView)
+	}
+	pollView.Voters = len(voters)
+
+	return pollView
+}
@@ -0,0 +1,167 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAddPoll(t *testing.T) {
+	assert := assert.New(t)
+
+	var inserted model.Message
+	messagePollRepoMock := new(mocks.MessageRepository)
+	messagePollRepoMock.On("InsertMessage", mock.Anything).Return(messageModel.ID.Hex(), nil).Run(func(args mock.Arguments) {
+		inserted = args.Get(0).(model.Message)
+	})
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messagePollRepoMock)
+
+	messageRequest := view.NewMessageRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		Text:   "Vote **now**",
+		Poll: &view.NewPoll{
+			Question: "Lunch?",
+			Options:  []string{"Pizza", "Sushi"},
+			ClosesAt: time.Now().Add(time.Hour).Format(time.RFC3339),
+		},
+	}
+
+	_, err := testObj.AddMessage(messageRequest)
+	assert.NoError(err)
+	assert.Equal(model.MessageTypePoll, inserted.Type)
+	assert.Equal("Lunch?", inserted.Text)
+	assert.Empty(inserted.Entities)
+	assert.Len(inserted.Poll.Options, 2)
+
+	messageRequest.Poll.Options = []string{"Pizza"}
+	_, err = testObj.AddMessage(messageRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+}
+
+func TestVote(t *testing.T) {
+	assert := assert.New(t)
+
+	otherModel := model.User{ID: primitive.NewObjectID(), UserName: "Other"}
+	pollModel := messageModel
+	pollModel.ID = primitive.NewObjectID()
+	pollModel.Type = model.MessageTypePoll
+	pollModel.Poll = &model.Poll{
+		Question:  "Lunch?",
+		Anonymous: true,
+		Options: []model.PollOption{
+			{Text: "Pizza", Voters: []primitive.ObjectID{}},
+			{Text: "Sushi", Voters: []primitive.ObjectID{otherModel.ID}},
+		},
+	}
+	votedModel := pollModel
+	votedModel.Poll = &model.Poll{
+		Question:  "Lunch?",
+		Anonymous: true,
+		Options: []model.PollOption{
+			{Text: "Pizza", Voters: []primitive.ObjectID{userModel.ID}},
+			{Text: "Sushi", Voters: []primitive.ObjectID{otherModel.ID}},
+		},
+	}
+	closedModel := pollModel
+	closedModel.ID = primitive.NewObjectID()
+	closedModel.Poll = &model.Poll{
+		Question: "Dinner?",
+		Options:  pollModel.Poll.Options,
+		ClosesAt: primitive.NewDateTimeFromTime(time.Now().Add(-time.Minute)),
+	}
+
+	messagePollRepoMock := new(mocks.MessageRepository)
+	messagePollRepoMock.On("FindMessageByID", pollModel.ID.Hex()).Return(pollModel, nil)
+	messagePollRepoMock.On("FindMessageByID", closedModel.ID.Hex()).Return(closedModel, nil)
+	messagePollRepoMock.On("VotePoll", pollModel.ID, userModel.ID, []int{0}, true).Return(votedModel, nil)
+	messagePollRepoMock.On("UnvotePoll", pollModel.ID, userModel.ID, []int(nil)).Return(pollModel, nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messagePollRepoMock)
+
+	messageResponse, err := testObj.Vote(view.VoteRequest{
+		MessageID: pollModel.ID.Hex(),
+		UserID:    userModel.ID.Hex(),
+		Options:   []int{0},
+	})
+	assert.NoError(err)
+	assert.Equal(2, messageResponse.Poll.Voters)
+	assert.Equal(1, messageResponse.Poll.Options[0].Votes)
+	assert.Empty(messageResponse.Poll.Options[0].Voters)
+
+	messageResponse, err = testObj.Unvote(view.VoteRequest{
+		MessageID: pollModel.ID.Hex(),
+		UserID:    userModel.ID.Hex(),
+	})
+	assert.NoError(err)
+	assert.Equal(0, messageResponse.Poll.Options[0].Votes)
+
+	var responseError *errs.ResponseError
+
+	_, err = testObj.Vote(view.VoteRequest{
+		MessageID: pollModel.ID.Hex(),
+		UserID:    userModel.ID.Hex(),
+		Options:   []int{0, 1},
+	})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+
+	_, err = testObj.Vote(view.VoteRequest{
+		MessageID: closedModel.ID.Hex(),
+		UserID:    userModel.ID.Hex(),
+		Options:   []int{1},
+	})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(409, responseError.Status)
+	}
+	messagePollRepoMock.AssertNumberOfCalls(t, "VotePoll", 1)
+}
+
+func TestGetPollResults(t *testing.T) {
+	assert := assert.New(t)
+
+	voterModel := model.User{ID: primitive.NewObjectID(), UserName: "Voter"}
+	pollModel := messageModel
+	pollModel.Type = model.MessageTypePoll
+	pollModel.Poll = &model.Poll{
+		Question: "Lunch?",
+		Multiple: true,
+		Options: []model.PollOption{
+			{Text: "Pizza", Voters: []primitive.ObjectID{voterModel.ID, userModel.ID}},
+			{Text: "Sushi", Voters: []primitive.ObjectID{voterModel.ID}},
+		},
+	}
+	messagePollRepoMock := new(mocks.MessageRepository)
+	messagePollRepoMock.On("FindMessages", chatModel).Return([]model.Message{pollModel}, nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messagePollRepoMock)
+
+	messagesResponse, err := testObj.GetMessages(view.MessagesRequest{СhatID: chatModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(model.MessageTypePoll, messagesResponse[0].Type)
+	assert.Equal(&view.Poll{
+		Question: "Lunch?",
+		Multiple: true,
+		Options: []view.PollOption{
+			{Text: "Pizza", Votes: 2, Voters: []string{voterModel.ID.Hex(), userModel.ID.Hex()}},
+			{Text: "Sushi", Votes: 1, Voters: []string{voterModel.ID.Hex()}},
+		},
+		Voters: 2,
+	}, messagesResponse[0].Poll)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+// PresenceStore keeps the activity of users. A single instance can keep it in
+// memory while a cluster needs a shared store.
+type PresenceStore interface {
+	Touch(user primitive.ObjectID, at time.Time) error
+	Connect(user primitive.ObjectID, at time.Time) error
+	Disconnect(user primitive.ObjectID, at time.Time) error
+	Find(users []primitive.ObjectID) (map[primitive.ObjectID]model.Presence, error)
+	Forget(user primitive.ObjectID) error
+}
+
+// WithPresence enables presence tracking. Users are away after awayAfter
+// without activity and offline after offlineAfter.
+func WithPresence(store PresenceStore, awayAfter, offlineAfter time.Duration) Option {
+	return func(c *ChatService) {
+		c.presence = store
+		c.awayAfter = awayAfter
+		c.offlineAfter = offlineAfter
+	}
+}
+
+// Ping lets clients report activity while they are idle on the API.
+func (c *ChatService) Ping(request view.UserRequest) (view.UserProfile, error) {
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.UserProfile{}, err
+	}
+
+	c.touch(user)
+
+	userView := userToView(user)
+	userView.Presence, userView.LastSeen = c.presenceOf(c.findPresence([]primitive.ObjectID{user.ID}), user.ID)
+
+	return userView, nil
+}
+
+func (c *ChatService) touch(user model.User) {
+	if c.presence == nil {
+		return
+	}
+
+	if err := c.presence.Touch(user.ID, time.Now()); err != nil {
+		log.Printf("presence of user %s not updated: %s", user.ID.Hex(), err)
+	}
+}
+
+// findPresence never fails the request: presence is informational only.
+func (c *ChatService) findPresence(users []primitive.ObjectID) map[primitive.ObjectID]model.Presence {
+	if c.presence == nil || len(users) == 0 {
+		return nil
+	}
+
+	presence, err := c.presence.Find(users)
+	if err != nil {
+		log.Printf("presence not found: %s", err)
+		return nil
+	}
+
+	return presence
+}
+
+// presenceOf returns the status and the last seen time of the user, both
+// empty when presence is not tracked.
+func (c *ChatService) presenceOf(presence map[primitive.ObjectID]model.Presence, user primitive.ObjectID) (string, string) {
+	if c.presence == nil {
+		return "", ""
+	}
+
+	p, ok := presence[user]
+	if !ok {
+		return model.PresenceOffline, ""
+	}
+
+	lastSeen := p.LastSeen.Time()
+	idle := time.Since(lastSeen)
+
+	status := model.PresenceOffline
+	switch {
+	case p.Connections > 0 && idle < c.offlineAfter:
+		status = model.PresenceOnline
+	case idle < c.awayAfter:
+		status = model.PresenceOnline
+	case idle < c.offlineAfter:
+		status = model.PresenceAway
+	}
+
+	return status, lastSeen.UTC().Format(time.RFC3339)
+}
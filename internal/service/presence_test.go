@@ -0,0 +1,78 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPing(t *testing.T) {
+	assert := assert.New(t)
+
+	lastSeen := time.Now().UTC().Truncate(time.Second)
+	presenceMock := new(mocks.PresenceStore)
+	presenceMock.On("Touch", userModel.ID, mock.Anything).Return(nil)
+	presenceMock.On("Find", []primitive.ObjectID{userModel.ID}).Return(map[primitive.ObjectID]model.Presence{
+		userModel.ID: {User: userModel.ID, LastSeen: primitive.NewDateTimeFromTime(lastSeen)},
+	}, nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageRepoMock,
+		service.WithPresence(presenceMock, time.Minute, 5*time.Minute))
+
+	userResponse, err := testObj.Ping(view.UserRequest{UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(model.PresenceOnline, userResponse.Presence)
+	assert.Equal(lastSeen.Format(time.RFC3339), userResponse.LastSeen)
+	presenceMock.AssertCalled(t, "Touch", userModel.ID, mock.Anything)
+}
+
+func TestGetUserPresence(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		presence model.Presence
+		expected string
+	}{
+		{model.Presence{LastSeen: primitive.NewDateTimeFromTime(time.Now().Add(-2 * time.Minute))}, model.PresenceAway},
+		{model.Presence{LastSeen: primitive.NewDateTimeFromTime(time.Now().Add(-2 * time.Minute)), Connections: 1}, model.PresenceOnline},
+		{model.Presence{LastSeen: primitive.NewDateTimeFromTime(time.Now().Add(-10 * time.Minute))}, model.PresenceOffline},
+		{model.Presence{LastSeen: primitive.NewDateTimeFromTime(time.Now().Add(-10 * time.Minute)), Connections: 1}, model.PresenceOffline},
+	}
+
+	for _, test := range tests {
+		test.presence.User = userModel.ID
+		presenceMock := new(mocks.PresenceStore)
+		presenceMock.On("Find", []primitive.ObjectID{userModel.ID}).Return(map[primitive.ObjectID]model.Presence{
+			userModel.ID: test.presence,
+		}, nil)
+		testObj := service.NewChatService(userRepoMock, chatRepoMock, messageRepoMock,
+			service.WithPresence(presenceMock, time.Minute, 5*time.Minute))
+
+		userResponse, err := testObj.GetUser(view.UserRequest{UserID: userModel.ID.Hex()})
+		assert.NoError(err)
+		assert.Equal(test.expected, userResponse.Presence)
+	}
+}
+
+func TestGetChatsPresence(t *testing.T) {
+	assert := assert.New(t)
+
+	presenceMock := new(mocks.PresenceStore)
+	presenceMock.On("Touch", userModel.ID, mock.Anything).Return(nil)
+	presenceMock.On("Find", []primitive.ObjectID{userModel.ID}).Return(map[primitive.ObjectID]model.Presence{}, nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageRepoMock,
+		service.WithPresence(presenceMock, time.Minute, 5*time.Minute))
+
+	chatsResponse, err := testObj.GetChats(view.ChatsRequest{UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(model.PresenceOffline, chatsResponse[0].Users[0].Presence)
+	assert.Empty(chatsResponse[0].Users[0].LastSeen)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	defaultDiscoverLimit = 50
+	maxDiscoverLimit     = 100
+)
+
+func (c *ChatService) DiscoverChats(request view.DiscoverChatsRequest) (view.DiscoverChatsResponse, error) {
+	var chatsView []view.PublicChat
+
+	limit := request.Limit
+	if limit <= 0 {
+		limit = defaultDiscoverLimit
+	}
+	if limit > maxDiscoverLimit {
+		limit = maxDiscoverLimit
+	}
+
+	chatsModel, err := c.chatRepo.FindPublicChats(request.Query, limit)
+	if err != nil {
+		return view.DiscoverChatsResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	for _, chatModel := range chatsModel {
+		chatView := view.PublicChat{
+			ID:          chatModel.ID.Hex(),
+			Name:        chatModel.Name,
+			Description: chatModel.Description,
+			Avatar:      chatModel.Avatar,
+			Members:     chatModel.Members,
+			CreatedAt:   chatModel.CreatedAt.Time().String(),
+		}
+
+		chatsView = append(chatsView, chatView)
+	}
+
+	return chatsView, nil
+}
+
+// JoinChat adds the user to a public chat. Joining a chat the user is
+// already a member of is a no-op.
+func (c *ChatService) JoinChat(request view.JoinChatRequest) (view.Chat, error) {
+	chat, err := c.findChat(request.ChatID)
+	if err != nil {
+		return view.Chat{}, err
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.Chat{}, err
+	}
+
+	if isMember(chat, user) {
+		return chatToView(chat, user), nil
+	}
+
+	if !chat.Public {
+		return view.Chat{}, errs.New(403, "chat is not public", nil)
+	}
+
+	chat, err = c.addMember(chat, user, systemMessage{
+		model.SystemEvent{Event: model.SystemMemberJoined, Via: "public"},
+		fmt.Sprintf("%s joined the chat", user.UserName),
+	})
+	if err != nil {
+		return view.Chat{}, err
+	}
+
+	return chatToView(chat, user), nil
+}
+
+// addMember adds the user to the chat and announces it with a system message.
+func (c *ChatService) addMember(chat model.Chat, user model.User, joined systemMessage) (model.Chat, error) {
+	member := model.User{
+		ID:       user.ID,
+		UserName: user.UserName,
+		Bot:      user.Bot,
+	}
+
+	if err := c.chatRepo.AddChatMember(chat, member); err != nil {
+		return model.Chat{}, errs.New(500, "internal server error", err)
+	}
+	chat.Users = append(chat.Users, member)
+
+	if err := c.postSystemMessage(chat, user, joined); err != nil {
+		return model.Chat{}, errs.New(500, "internal server error", err)
+	}
+
+	c.notify(chat, user.ID, model.WebhookMemberJoined, view.WebhookMember{
+		ChatID: chat.ID.Hex(),
+		UserID: user.ID.Hex(),
+		Via:    joined.event.Via,
+	})
+
+	return chat, nil
+}
@@ -0,0 +1,93 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDiscoverChats(t *testing.T) {
+	assert := assert.New(t)
+
+	summaryModel := model.ChatSummary{
+		ID:      primitive.NewObjectID(),
+		Name:    "public_chat",
+		Members: 42,
+	}
+	chatPublicRepoMock := new(mocks.ChatRepository)
+	chatPublicRepoMock.On("FindPublicChats", "public", int64(50)).Return([]model.ChatSummary{summaryModel}, nil)
+	chatPublicRepoMock.On("FindPublicChats", "public", int64(100)).Return([]model.ChatSummary{summaryModel}, nil)
+	testObj := service.NewChatService(userRepoMock, chatPublicRepoMock, messageRepoMock)
+
+	chatsResponse, err := testObj.DiscoverChats(view.DiscoverChatsRequest{Query: "public"})
+	assert.NoError(err)
+	assert.Equal(summaryModel.ID.Hex(), chatsResponse[0].ID)
+	assert.Equal(summaryModel.Name, chatsResponse[0].Name)
+	assert.Equal(42, chatsResponse[0].Members)
+
+	_, err = testObj.DiscoverChats(view.DiscoverChatsRequest{Query: "public", Limit: 1000})
+	assert.NoError(err)
+	chatPublicRepoMock.AssertCalled(t, "FindPublicChats", "public", int64(100))
+
+	chatErrRepoMock := new(mocks.ChatRepository)
+	chatErrRepoMock.On("FindPublicChats", "", int64(50)).Return([]model.ChatSummary{}, errors.New("internal db error"))
+	testObj = service.NewChatService(userRepoMock, chatErrRepoMock, messageRepoMock)
+	chatsResponse, err = testObj.DiscoverChats(view.DiscoverChatsRequest{})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(500, responseError.Status)
+	}
+	assert.Empty(chatsResponse)
+}
+
+func TestJoinChat(t *testing.T) {
+	assert := assert.New(t)
+
+	joinerModel := model.User{ID: primitive.NewObjectID(), UserName: "Joiner"}
+	userJoinerRepoMock := new(mocks.UserRepository)
+	userJoinerRepoMock.On("FindUserByID", joinerModel.ID.Hex()).Return(joinerModel, nil)
+
+	publicChatModel := chatModel
+	publicChatModel.Public = true
+	chatPublicRepoMock := new(mocks.ChatRepository)
+	chatPublicRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(publicChatModel, nil)
+	chatPublicRepoMock.On("AddChatMember", publicChatModel, joinerModel).Return(nil)
+	messageJoinRepoMock := new(mocks.MessageRepository)
+	messageJoinRepoMock.On("InsertMessage", mock.MatchedBy(func(message model.Message) bool {
+		return message.Author == joinerModel.ID && message.Text == "Joiner joined the chat" && message.System.Event == model.SystemMemberJoined
+	})).Return(primitive.NewObjectID().Hex(), nil)
+	testObj := service.NewChatService(userJoinerRepoMock, chatPublicRepoMock, messageJoinRepoMock)
+
+	joinRequest := view.JoinChatRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: joinerModel.ID.Hex(),
+	}
+
+	chatResponse, err := testObj.JoinChat(joinRequest)
+	assert.NoError(err)
+	assert.Len(chatResponse.Users, 2)
+	chatPublicRepoMock.AssertCalled(t, "AddChatMember", publicChatModel, joinerModel)
+	messageJoinRepoMock.AssertExpectations(t)
+
+	chatErrRepoMock := new(mocks.ChatRepository)
+	chatErrRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	testObj = service.NewChatService(userJoinerRepoMock, chatErrRepoMock, messageRepoMock)
+	chatResponse, err = testObj.JoinChat(joinRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	assert.Empty(chatResponse)
+}
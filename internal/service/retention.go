@@ -0,0 +1,119 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/metrics"
+)
+
+const (
+	retentionBatchSize = 500
+	maxRetentionDays   = 3650
+)
+
+// maxChatRetention is the longest retention a chat may set.
+func (c *ChatService) maxChatRetention() int {
+	if c.retentionDays > 0 && c.retentionDays < maxRetentionDays {
+		return c.retentionDays
+	}
+
+	return maxRetentionDays
+}
+
+// WithRetention deletes messages older than days in every chat. Chats may
+// only keep their messages for less. Zero keeps messages forever.
+func WithRetention(days int) Option {
+	return func(c *ChatService) {
+		c.retentionDays = days
+	}
+}
+
+// StartRetentionSweeper deletes expired messages every interval until stop
+// is closed.
+func (c *ChatService) StartRetentionSweeper(interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := c.SweepExpiredMessages(); err != nil {
+				log.Printf("retention sweep failed: %s", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// SweepExpiredMessages deletes the messages that are past the retention of
+// their chat and returns how many were deleted. The shorter of the chat and
+// the global retention applies; chats set before the global retention was
+// shortened may hold a longer one. TTL indexes can't express a per-chat
+// expiry, so this runs as a sweep.
+func (c *ChatService) SweepExpiredMessages() (int64, error) {
+	now := time.Now()
+
+	chats, err := c.chatRepo.FindChatsWithRetention()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	custom := make([]primitive.ObjectID, 0, len(chats))
+
+	for _, chat := range chats {
+		custom = append(custom, chat.ID)
+
+		days := chat.RetentionDays
+		if c.retentionDays > 0 && c.retentionDays < days {
+			days = c.retentionDays
+		}
+
+		cutoff := now.AddDate(0, 0, -days)
+		deleted, err := deleteExpired(func(limit int64) (int64, error) {
+			return c.messageRepo.DeleteChatMessagesBefore(chat.ID, cutoff, limit)
+		})
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+	}
+
+	if c.retentionDays <= 0 {
+		return total, nil
+	}
+
+	cutoff := now.AddDate(0, 0, -c.retentionDays)
+	deleted, err := deleteExpired(func(limit int64) (int64, error) {
+		return c.messageRepo.DeleteMessagesBefore(cutoff, custom, limit)
+	})
+	total += deleted
+
+	return total, err
+}
+
+// deleteExpired runs del in batches until nothing is left to delete.
+func deleteExpired(del func(limit int64) (int64, error)) (int64, error) {
+	var total int64
+
+	for {
+		deleted, err := del(retentionBatchSize)
+		if err != nil {
+			return total, err
+		}
+
+		if deleted == 0 {
+			return total, nil
+		}
+
+		metrics.MessagesExpired.Add(deleted)
+		total += deleted
+	}
+}
@@ -0,0 +1,158 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/metrics"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSweepExpiredMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	retainedChat := model.Chat{ID: primitive.NewObjectID(), RetentionDays: 7}
+	chatRetentionRepoMock := new(mocks.ChatRepository)
+	chatRetentionRepoMock.On("FindChatsWithRetention").Return([]model.Chat{retainedChat}, nil)
+
+	var chatCutoff, globalCutoff time.Time
+	messageRetentionRepoMock := new(mocks.MessageRepository)
+	messageRetentionRepoMock.On("DeleteChatMessagesBefore", retainedChat.ID, mock.Anything, int64(500)).Return(int64(3), nil).Once().Run(func(args mock.Arguments) {
+		chatCutoff = args.Get(1).(time.Time)
+	})
+	messageRetentionRepoMock.On("DeleteChatMessagesBefore", retainedChat.ID, mock.Anything, int64(500)).Return(int64(0), nil)
+	messageRetentionRepoMock.On("DeleteMessagesBefore", mock.Anything, []primitive.ObjectID{retainedChat.ID}, int64(500)).Return(int64(500), nil).Once().Run(func(args mock.Arguments) {
+		globalCutoff = args.Get(0).(time.Time)
+	})
+	messageRetentionRepoMock.On("DeleteMessagesBefore", mock.Anything, []primitive.ObjectID{retainedChat.ID}, int64(500)).Return(int64(2), nil).Once()
+	messageRetentionRepoMock.On("DeleteMessagesBefore", mock.Anything, []primitive.ObjectID{retainedChat.ID}, int64(500)).Return(int64(0), nil)
+	testObj := service.NewChatService(userRepoMock, chatRetentionRepoMock, messageRetentionRepoMock, service.WithRetention(30))
+
+	expired := metrics.MessagesExpired.Value()
+
+	deleted, err := testObj.SweepExpiredMessages()
+	assert.NoError(err)
+	assert.Equal(int64(505), deleted)
+	assert.Equal(expired+505, metrics.MessagesExpired.Value())
+	assert.WithinDuration(time.Now().AddDate(0, 0, -7), chatCutoff, time.Minute)
+	assert.WithinDuration(time.Now().AddDate(0, 0, -30), globalCutoff, time.Minute)
+}
+
+func TestSweepCapsChatRetention(t *testing.T) {
+	assert := assert.New(t)
+
+	// Set before the global retention was shortened.
+	retainedChat := model.Chat{ID: primitive.NewObjectID(), RetentionDays: 90}
+	chatRetentionRepoMock := new(mocks.ChatRepository)
+	chatRetentionRepoMock.On("FindChatsWithRetention").Return([]model.Chat{retainedChat}, nil)
+
+	var chatCutoff time.Time
+	messageRetentionRepoMock := new(mocks.MessageRepository)
+	messageRetentionRepoMock.On("DeleteChatMessagesBefore", retainedChat.ID, mock.Anything, int64(500)).Return(int64(0), nil).Run(func(args mock.Arguments) {
+		chatCutoff = args.Get(1).(time.Time)
+	})
+	messageRetentionRepoMock.On("DeleteMessagesBefore", mock.Anything, []primitive.ObjectID{retainedChat.ID}, int64(500)).Return(int64(0), nil)
+	testObj := service.NewChatService(userRepoMock, chatRetentionRepoMock, messageRetentionRepoMock, service.WithRetention(30))
+
+	_, err := testObj.SweepExpiredMessages()
+	assert.NoError(err)
+	assert.WithinDuration(time.Now().AddDate(0, 0, -30), chatCutoff, time.Minute)
+}
+
+func TestSweepWithoutGlobalRetention(t *testing.T) {
+	assert := assert.New(t)
+
+	chatRetentionRepoMock := new(mocks.ChatRepository)
+	chatRetentionRepoMock.On("FindChatsWithRetention").Return([]model.Chat{}, nil)
+	messageRetentionRepoMock := new(mocks.MessageRepository)
+	testObj := service.NewChatService(userRepoMock, chatRetentionRepoMock, messageRetentionRepoMock)
+
+	deleted, err := testObj.SweepExpiredMessages()
+	assert.NoError(err)
+	assert.Zero(deleted)
+	messageRetentionRepoMock.AssertNotCalled(t, "DeleteMessagesBefore", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateChatRetention(t *testing.T) {
+	assert := assert.New(t)
+
+	memberModel := model.User{ID: primitive.NewObjectID(), UserName: "Member"}
+	groupChatModel := model.Chat{
+		ID:    primitive.NewObjectID(),
+		Name:  "group_chat",
+		Users: []model.User{userModel, memberModel},
+	}
+	userRetentionRepoMock := new(mocks.UserRepository)
+	userRetentionRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userRetentionRepoMock.On("FindUserByID", memberModel.ID.Hex()).Return(memberModel, nil)
+	chatRetentionRepoMock := new(mocks.ChatRepository)
+	chatRetentionRepoMock.On("FindChatDeletion", groupChatModel.ID.Hex()).Return(model.ChatDeletion{}, errors.New("not found"))
+	chatRetentionRepoMock.On("FindChatByID", groupChatModel.ID.Hex()).Return(groupChatModel, nil)
+	chatRetentionRepoMock.On("UpdateChat", mock.Anything).Return(nil)
+	testObj := service.NewChatService(userRetentionRepoMock, chatRetentionRepoMock, messageRepoMock)
+
+	days := 14
+	chatResponse, err := testObj.UpdateChat(view.UpdateChatRequest{
+		ChatID:        groupChatModel.ID.Hex(),
+		UserID:        userModel.ID.Hex(),
+		RetentionDays: &days,
+	})
+	assert.NoError(err)
+	assert.Equal(14, chatResponse.RetentionDays)
+
+	var responseError *errs.ResponseError
+
+	_, err = testObj.UpdateChat(view.UpdateChatRequest{
+		ChatID:        groupChatModel.ID.Hex(),
+		UserID:        memberModel.ID.Hex(),
+		RetentionDays: &days,
+	})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+
+	days = -1
+	_, err = testObj.UpdateChat(view.UpdateChatRequest{
+		ChatID:        groupChatModel.ID.Hex(),
+		UserID:        userModel.ID.Hex(),
+		RetentionDays: &days,
+	})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+
+	// Chats can't keep messages longer than the global retention.
+	testObj = service.NewChatService(userRetentionRepoMock, chatRetentionRepoMock, messageRepoMock, service.WithRetention(30))
+	days = 31
+	_, err = testObj.UpdateChat(view.UpdateChatRequest{
+		ChatID:        groupChatModel.ID.Hex(),
+		UserID:        userModel.ID.Hex(),
+		RetentionDays: &days,
+	})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+		assert.Equal("retention_days must be between 0 and 30", responseError.Message)
+	}
+
+	days = 30
+	chatResponse, err = testObj.UpdateChat(view.UpdateChatRequest{
+		ChatID:        groupChatModel.ID.Hex(),
+		UserID:        userModel.ID.Hex(),
+		RetentionDays: &days,
+	})
+	assert.NoError(err)
+	assert.Equal(30, chatResponse.RetentionDays)
+}
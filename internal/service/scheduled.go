@@ -0,0 +1,349 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	maxScheduleAhead   = 365 * 24 * time.Hour
+	schedulerBatchSize = 100
+)
+
+func (c *ChatService) ScheduleMessage(request view.ScheduleMessageRequest) (view.ScheduledMessage, error) {
+	sendAt, err := parseSendAt(request.SendAt)
+	if err != nil {
+		return view.ScheduledMessage{}, err
+	}
+
+	if err := checkTTL(request.TTL); err != nil {
+		return view.ScheduledMessage{}, err
+	}
+
+	if err := checkScheduledText(request.Text); err != nil {
+		return view.ScheduledMessage{}, err
+	}
+
+	chat, err := c.findChat(request.ChatID)
+	if err != nil {
+		return view.ScheduledMessage{}, err
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.ScheduledMessage{}, err
+	}
+
+	if !isMember(chat, user) {
+		return view.ScheduledMessage{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	scheduled := model.ScheduledMessage{
+		ID:        primitive.NewObjectID(),
+		Chat:      chat.ID,
+		Author:    user.ID,
+		Text:      request.Text,
+		TTL:       request.TTL,
+		SendAt:    primitive.NewDateTimeFromTime(sendAt),
+		Status:    model.ScheduledPending,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	if _, err := c.messageRepo.InsertScheduledMessage(scheduled); err != nil {
+		return view.ScheduledMessage{}, errs.New(500, "internal server error", err)
+	}
+
+	return scheduledToView(scheduled), nil
+}
+
+func (c *ChatService) GetScheduledMessages(request view.UserRequest) (view.ScheduledMessagesResponse, error) {
+	var scheduledView []view.ScheduledMessage
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.ScheduledMessagesResponse{}, err
+	}
+
+	scheduled, err := c.messageRepo.FindScheduledMessages(user.ID)
+	if err != nil {
+		return view.ScheduledMessagesResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	for _, message := range scheduled {
+		scheduledView = append(scheduledView, scheduledToView(message))
+	}
+
+	return scheduledView, nil
+}
+
+func (c *ChatService) UpdateScheduledMessage(update view.UpdateScheduledMessageRequest) (view.ScheduledMessage, error) {
+	scheduled, err := c.findScheduled(update.ID, update.UserID)
+	if err != nil {
+		return view.ScheduledMessage{}, err
+	}
+
+	if update.Text != nil {
+		if *update.Text == "" {
+			return view.ScheduledMessage{}, errs.New(400, "text must not be empty", nil)
+		}
+
+		if err := checkScheduledText(*update.Text); err != nil {
+			return view.ScheduledMessage{}, err
+		}
+
+		scheduled.Text = *update.Text
+	}
+
+	if update.TTL != nil {
+		if err := checkTTL(*update.TTL); err != nil {
+			return view.ScheduledMessage{}, err
+		}
+
+		scheduled.TTL = *update.TTL
+	}
+
+	if update.SendAt != nil {
+		sendAt, err := parseSendAt(*update.SendAt)
+		if err != nil {
+			return view.ScheduledMessage{}, err
+		}
+
+		scheduled.SendAt = primitive.NewDateTimeFromTime(sendAt)
+	}
+
+	if err := c.saveScheduled(scheduled); err != nil {
+		return view.ScheduledMessage{}, err
+	}
+
+	return scheduledToView(scheduled), nil
+}
+
+func (c *ChatService) CancelScheduledMessage(request view.ScheduledMessageRequest) (view.ScheduledMessage, error) {
+	scheduled, err := c.findScheduled(request.ID, request.UserID)
+	if err != nil {
+		return view.ScheduledMessage{}, err
+	}
+
+	scheduled.Status = model.ScheduledCancelled
+	if err := c.saveScheduled(scheduled); err != nil {
+		return view.ScheduledMessage{}, err
+	}
+
+	return scheduledToView(scheduled), nil
+}
+
+// StartScheduler delivers due scheduled messages every interval until stop
+// is closed. Messages that fell due while the server was down are delivered
+// on the first run.
+func (c *ChatService) StartScheduler(interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := c.DeliverScheduledMessages(); err != nil {
+				log.Printf("scheduled delivery failed: %s", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// DeliverScheduledMessages publishes every due message through sendScheduled
+// and returns how many were handled. A message is claimed before it is sent, so
+// it can't be edited mid-delivery, and it is stored under its scheduled ID,
+// so a delivery repeated after a crash doesn't duplicate it. Messages that
+// fail with a server error are logged and left for the next run.
+func (c *ChatService) DeliverScheduledMessages() (int, error) {
+	var handled int
+	failed := map[primitive.ObjectID]bool{}
+
+	for {
+		due, err := c.messageRepo.FindDueScheduledMessages(time.Now(), schedulerBatchSize)
+		if err != nil {
+			return handled, err
+		}
+
+		// Failed messages stay due, so a batch of them only is the end.
+		tried := false
+		for _, scheduled := range due {
+			if failed[scheduled.ID] {
+				continue
+			}
+			tried = true
+
+			if err := c.deliverScheduled(scheduled); err != nil {
+				log.Printf("scheduled message %s not delivered: %s", scheduled.ID.Hex(), err)
+				failed[scheduled.ID] = true
+
+				continue
+			}
+
+			handled++
+		}
+
+		if len(due) < schedulerBatchSize || !tried {
+			return handled, nil
+		}
+	}
+}
+
+func (c *ChatService) deliverScheduled(scheduled model.ScheduledMessage) error {
+	claimed, err := c.messageRepo.ClaimScheduledMessage(scheduled.ID)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	message := view.NewMessageRequest{
+		ChatID: claimed.Chat.Hex(),
+		UserID: claimed.Author.Hex(),
+		Text:   claimed.Text,
+		TTL:    claimed.TTL,
+	}
+
+	claimed.Status = model.ScheduledSent
+	if _, err := c.sendScheduled(message, claimed.ID); err != nil {
+		// Server errors are retried on the next run, anything else means the
+		// message can't be sent anymore, e.g. the chat was deleted.
+		var responseError *errs.ResponseError
+		if !errors.As(err, &responseError) || responseError.Status >= 500 {
+			return err
+		}
+
+		claimed.Status = model.ScheduledFailed
+		claimed.Error = responseError.Message
+	}
+
+	return c.messageRepo.FinishScheduledMessage(claimed)
+}
+
+// sendScheduled posts the text the way AddMessage does, under the scheduled
+// ID, if the author is still a member of the chat. /me is the only command
+// that can be scheduled.
+func (c *ChatService) sendScheduled(message view.NewMessageRequest, id primitive.ObjectID) (view.NewMessageResponse, error) {
+	_, user, err := c.findCommandChat(message.ChatID, message.UserID)
+	if err != nil {
+		return view.NewMessageResponse{}, err
+	}
+
+	call, ok := parseCommand(message.Text)
+	if !ok {
+		if strings.HasPrefix(message.Text, "//") {
+			message.Text = message.Text[1:]
+		}
+
+		return c.addMessage(message, id)
+	}
+
+	// Messages scheduled before commands were checked may hold any of them.
+	if err := checkScheduledText(message.Text); err != nil {
+		return view.NewMessageResponse{}, err
+	}
+
+	message.Text = user.UserName + " " + call.text
+
+	return c.postMessage(message, id, model.MessageTypeAction)
+}
+
+// checkScheduledText refuses the commands that can't be scheduled. Their
+// answers are meant for someone who is typing.
+func checkScheduledText(text string) error {
+	call, ok := parseCommand(text)
+	if !ok {
+		return nil
+	}
+
+	if call.name != "me" || call.bot != "" {
+		return errs.New(400, "only /me can be scheduled, start with // to post the text", nil)
+	}
+
+	if call.text == "" {
+		return errs.New(400, "/me needs an action", nil)
+	}
+
+	return nil
+}
+
+func (c *ChatService) findScheduled(id string, userID string) (model.ScheduledMessage, error) {
+	scheduled, err := c.messageRepo.FindScheduledMessage(id)
+	if err != nil {
+		return model.ScheduledMessage{}, errs.New(404, "scheduled message not found", err)
+	}
+
+	user, err := c.findUser(userID)
+	if err != nil {
+		return model.ScheduledMessage{}, err
+	}
+
+	if scheduled.Author != user.ID {
+		return model.ScheduledMessage{}, errs.New(403, "only the author can change a scheduled message", nil)
+	}
+
+	if scheduled.Status != model.ScheduledPending {
+		return model.ScheduledMessage{}, errs.New(409, "scheduled message is "+scheduled.Status, nil)
+	}
+
+	return scheduled, nil
+}
+
+// saveScheduled stores an edit unless the scheduler claimed the message in
+// the meantime.
+func (c *ChatService) saveScheduled(scheduled model.ScheduledMessage) error {
+	err := c.messageRepo.UpdateScheduledMessage(scheduled)
+	if err == mongo.ErrNoDocuments {
+		return errs.New(409, "scheduled message is already being sent", err)
+	}
+	if err != nil {
+		return errs.New(500, "internal server error", err)
+	}
+
+	return nil
+}
+
+func parseSendAt(value string) (time.Time, error) {
+	sendAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errs.New(400, "send_at must be an RFC 3339 timestamp", err)
+	}
+
+	now := time.Now()
+	if !sendAt.After(now) {
+		return time.Time{}, errs.New(400, "send_at must be in the future", nil)
+	}
+
+	if sendAt.After(now.Add(maxScheduleAhead)) {
+		return time.Time{}, errs.New(400, "send_at must be within a year", nil)
+	}
+
+	return sendAt, nil
+}
+
+func scheduledToView(scheduled model.ScheduledMessage) view.ScheduledMessage {
+	return view.ScheduledMessage{
+		ID:       scheduled.ID.Hex(),
+		ChatID:   scheduled.Chat.Hex(),
+		AuthorID: scheduled.Author.Hex(),
+		Text:     scheduled.Text,
+		TTL:      scheduled.TTL,
+		SendAt:   scheduled.SendAt.Time().UTC().Format(time.RFC3339),
+		Status:   scheduled.Status,
+		Error:    scheduled.Error,
+	}
+}
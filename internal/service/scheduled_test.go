@@ -0,0 +1,189 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestScheduleMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	var inserted model.ScheduledMessage
+	messageScheduleRepoMock := new(mocks.MessageRepository)
+	messageScheduleRepoMock.On("InsertScheduledMessage", mock.Anything).Return("", nil).Run(func(args mock.Arguments) {
+		inserted = args.Get(0).(model.ScheduledMessage)
+	})
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageScheduleRepoMock)
+
+	sendAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	scheduleRequest := view.ScheduleMessageRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		Text:   "Later",
+		SendAt: sendAt.Format(time.RFC3339),
+	}
+
+	scheduledResponse, err := testObj.ScheduleMessage(scheduleRequest)
+	assert.NoError(err)
+	assert.Equal(inserted.ID.Hex(), scheduledResponse.ID)
+	assert.Equal(model.ScheduledPending, scheduledResponse.Status)
+	assert.Equal(sendAt, inserted.SendAt.Time().UTC())
+
+	scheduleRequest.SendAt = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	scheduledResponse, err = testObj.ScheduleMessage(scheduleRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+	assert.Empty(scheduledResponse)
+
+	// Commands other than /me answer someone who is typing.
+	scheduleRequest.SendAt = sendAt.Format(time.RFC3339)
+	scheduleRequest.Text = "/invite @Other"
+	_, err = testObj.ScheduleMessage(scheduleRequest)
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+}
+
+func TestUpdateScheduledMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	scheduledModel := model.ScheduledMessage{
+		ID:     primitive.NewObjectID(),
+		Chat:   chatModel.ID,
+		Author: userModel.ID,
+		Text:   "Later",
+		SendAt: primitive.NewDateTimeFromTime(time.Now().Add(time.Hour)),
+		Status: model.ScheduledPending,
+	}
+	claimedModel := scheduledModel
+	claimedModel.ID = primitive.NewObjectID()
+	messageScheduleRepoMock := new(mocks.MessageRepository)
+	messageScheduleRepoMock.On("FindScheduledMessage", scheduledModel.ID.Hex()).Return(scheduledModel, nil)
+	messageScheduleRepoMock.On("FindScheduledMessage", claimedModel.ID.Hex()).Return(claimedModel, nil)
+	messageScheduleRepoMock.On("UpdateScheduledMessage", mock.MatchedBy(func(message model.ScheduledMessage) bool {
+		return message.ID == scheduledModel.ID
+	})).Return(nil)
+	messageScheduleRepoMock.On("UpdateScheduledMessage", mock.Anything).Return(mongo.ErrNoDocuments)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageScheduleRepoMock)
+
+	text := "Edited"
+	scheduledResponse, err := testObj.UpdateScheduledMessage(view.UpdateScheduledMessageRequest{
+		ID:     scheduledModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		Text:   &text,
+	})
+	assert.NoError(err)
+	assert.Equal(text, scheduledResponse.Text)
+
+	scheduledResponse, err = testObj.CancelScheduledMessage(view.ScheduledMessageRequest{
+		ID:     scheduledModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+	})
+	assert.NoError(err)
+	assert.Equal(model.ScheduledCancelled, scheduledResponse.Status)
+
+	// The scheduler claimed the message after it was read.
+	scheduledResponse, err = testObj.CancelScheduledMessage(view.ScheduledMessageRequest{
+		ID:     claimedModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+	})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(409, responseError.Status)
+	}
+	assert.Empty(scheduledResponse)
+}
+
+func TestDeliverScheduledMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	newScheduled := func(chat primitive.ObjectID) model.ScheduledMessage {
+		return model.ScheduledMessage{
+			ID:     primitive.NewObjectID(),
+			Chat:   chat,
+			Author: userModel.ID,
+			Text:   "Later",
+			SendAt: primitive.NewDateTimeFromTime(time.Now().Add(-time.Second)),
+			Status: model.ScheduledPending,
+		}
+	}
+	sentModel := newScheduled(chatModel.ID)
+	resentModel := newScheduled(chatModel.ID)
+	deletedChatModel := newScheduled(primitive.NewObjectID())
+	actionModel := newScheduled(chatModel.ID)
+	actionModel.Text = "/me waves"
+	brokenModel := newScheduled(chatModel.ID)
+	leftChatModel := model.Chat{ID: primitive.NewObjectID(), Users: []model.User{{ID: primitive.NewObjectID(), UserName: "Other"}}}
+	leftModel := newScheduled(leftChatModel.ID)
+
+	chatScheduleRepoMock := new(mocks.ChatRepository)
+	chatScheduleRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatScheduleRepoMock.On("FindChatByID", leftChatModel.ID.Hex()).Return(leftChatModel, nil)
+	chatScheduleRepoMock.On("FindChatByID", deletedChatModel.Chat.Hex()).Return(model.Chat{}, mongo.ErrNoDocuments)
+	chatScheduleRepoMock.On("FindChatDeletion", deletedChatModel.Chat.Hex()).Return(model.ChatDeletion{ID: deletedChatModel.Chat}, nil)
+
+	messageScheduleRepoMock := new(mocks.MessageRepository)
+	messageScheduleRepoMock.On("FindDueScheduledMessages", mock.Anything, int64(100)).
+		Return([]model.ScheduledMessage{brokenModel, sentModel, resentModel, deletedChatModel, actionModel, leftModel}, nil)
+	for _, scheduled := range []model.ScheduledMessage{brokenModel, sentModel, resentModel, deletedChatModel, actionModel, leftModel} {
+		claimed := scheduled
+		claimed.Status = model.ScheduledSending
+		messageScheduleRepoMock.On("ClaimScheduledMessage", scheduled.ID).Return(claimed, nil)
+	}
+	messageScheduleRepoMock.On("InsertMessage", model.Message{ID: sentModel.ID, Chat: chatModel.ID, Author: userModel.ID, Text: "Later"}).
+		Return(sentModel.ID.Hex(), nil)
+	messageScheduleRepoMock.On("InsertMessage", model.Message{ID: resentModel.ID, Chat: chatModel.ID, Author: userModel.ID, Text: "Later"}).
+		Return("-1", mongo.WriteException{
+			WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key error"}},
+		})
+	messageScheduleRepoMock.On("InsertMessage", model.Message{ID: actionModel.ID, Chat: chatModel.ID, Author: userModel.ID, Type: model.MessageTypeAction, Text: "Test waves"}).
+		Return(actionModel.ID.Hex(), nil)
+	messageScheduleRepoMock.On("InsertMessage", model.Message{ID: brokenModel.ID, Chat: chatModel.ID, Author: userModel.ID, Text: "Later"}).
+		Return("-1", errors.New("connection reset"))
+	messageScheduleRepoMock.On("FinishScheduledMessage", mock.Anything).Return(nil)
+	testObj := service.NewChatService(userRepoMock, chatScheduleRepoMock, messageScheduleRepoMock)
+
+	handled, err := testObj.DeliverScheduledMessages()
+	assert.NoError(err)
+	assert.Equal(5, handled)
+	messageScheduleRepoMock.AssertCalled(t, "FinishScheduledMessage", mock.MatchedBy(func(message model.ScheduledMessage) bool {
+		return message.ID == sentModel.ID && message.Status == model.ScheduledSent
+	}))
+	messageScheduleRepoMock.AssertCalled(t, "FinishScheduledMessage", mock.MatchedBy(func(message model.ScheduledMessage) bool {
+		return message.ID == resentModel.ID && message.Status == model.ScheduledSent
+	}))
+	messageScheduleRepoMock.AssertCalled(t, "FinishScheduledMessage", mock.MatchedBy(func(message model.ScheduledMessage) bool {
+		return message.ID == deletedChatModel.ID && message.Status == model.ScheduledFailed && message.Error != ""
+	}))
+	messageScheduleRepoMock.AssertCalled(t, "FinishScheduledMessage", mock.MatchedBy(func(message model.ScheduledMessage) bool {
+		return message.ID == actionModel.ID && message.Status == model.ScheduledSent
+	}))
+
+	// The author left the chat after scheduling the message.
+	messageScheduleRepoMock.AssertCalled(t, "FinishScheduledMessage", mock.MatchedBy(func(message model.ScheduledMessage) bool {
+		return message.ID == leftModel.ID && message.Status == model.ScheduledFailed && message.Error != ""
+	}))
+
+	// Server errors leave the message to the next run without stopping this one.
+	messageScheduleRepoMock.AssertNotCalled(t, "FinishScheduledMessage", mock.MatchedBy(func(message model.ScheduledMessage) bool {
+		return message.ID == brokenModel.ID
+	}))
+}
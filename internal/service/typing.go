@@ -0,0 +1,49 @@
+package service
+
+import (
+	"time"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	typingTTL   = 5 * time.Second
+	typingRate  = 1
+	typingBurst = 2
+)
+
+// Typing tells the other members of the chat that the user is typing. The
+// signal is not stored and expires after a few seconds.
+func (c *ChatService) Typing(request view.TypingRequest) (view.TypingResponse, error) {
+	if !c.typingLimiter.Allow(request.UserID) {
+		return view.TypingResponse{}, errs.New(429, "too many typing signals", nil)
+	}
+
+	chat, err := c.findChat(request.ChatID)
+	if err != nil {
+		return view.TypingResponse{}, err
+	}
+
+	user, err := c.findUser(request.UserID)
+	if err != nil {
+		return view.TypingResponse{}, err
+	}
+
+	if !isMember(chat, user) {
+		return view.TypingResponse{}, errs.New(403, "user is not a member of the chat", nil)
+	}
+
+	c.touch(user)
+
+	event := model.Event{
+		Type:      model.EventTyping,
+		Chat:      chat.ID,
+		User:      user.ID,
+		ExpiresAt: time.Now().Add(typingTTL),
+	}
+	c.publish(chat, event)
+
+	return view.TypingResponse{ExpiresAt: event.ExpiresAt.UTC().Format(time.RFC3339Nano)}, nil
+}
@@ -0,0 +1,100 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTyping(t *testing.T) {
+	assert := assert.New(t)
+
+	otherModel := model.User{ID: primitive.NewObjectID(), UserName: "Other"}
+	groupChatModel := model.Chat{
+		ID:    primitive.NewObjectID(),
+		Name:  "group_chat",
+		Users: []model.User{userModel, otherModel},
+	}
+	chatGroupRepoMock := new(mocks.ChatRepository)
+	chatGroupRepoMock.On("FindChatByID", groupChatModel.ID.Hex()).Return(groupChatModel, nil)
+
+	typingEvent := mock.MatchedBy(func(event model.Event) bool {
+		return event.Type == model.EventTyping && event.Chat == groupChatModel.ID && event.User == userModel.ID
+	})
+	eventsMock := new(mocks.EventHub)
+	eventsMock.On("Publish", []primitive.ObjectID{otherModel.ID}, typingEvent).Return()
+	testObj := service.NewChatService(userRepoMock, chatGroupRepoMock, messageRepoMock, service.WithEvents(eventsMock))
+
+	typingRequest := view.TypingRequest{
+		ChatID: groupChatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+	}
+
+	typingResponse, err := testObj.Typing(typingRequest)
+	assert.NoError(err)
+	assert.NotEmpty(typingResponse.ExpiresAt)
+	eventsMock.AssertNumberOfCalls(t, "Publish", 1)
+	messageRepoMock.AssertNotCalled(t, "InsertMessage", mock.MatchedBy(func(message model.Message) bool { return message.Chat == groupChatModel.ID }))
+
+	_, err = testObj.Typing(typingRequest)
+	assert.NoError(err)
+
+	typingResponse, err = testObj.Typing(typingRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(429, responseError.Status)
+	}
+	assert.Empty(typingResponse)
+	eventsMock.AssertNumberOfCalls(t, "Publish", 2)
+
+	strangerModel := model.User{ID: primitive.NewObjectID(), UserName: "Stranger"}
+	userStrangerRepoMock := new(mocks.UserRepository)
+	userStrangerRepoMock.On("FindUserByID", strangerModel.ID.Hex()).Return(strangerModel, nil)
+	testObj = service.NewChatService(userStrangerRepoMock, chatGroupRepoMock, messageRepoMock, service.WithEvents(eventsMock))
+	typingResponse, err = testObj.Typing(view.TypingRequest{ChatID: groupChatModel.ID.Hex(), UserID: strangerModel.ID.Hex()})
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	assert.Empty(typingResponse)
+}
+
+func TestPollEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	event := model.Event{Type: model.EventTyping, Chat: chatModel.ID, User: primitive.NewObjectID()}
+	eventsMock := new(mocks.EventHub)
+	eventsMock.On("Poll", mock.Anything, userModel.ID, mock.Anything, mock.Anything).Return([]model.Event{event})
+	presenceMock := new(mocks.PresenceStore)
+	presenceMock.On("Connect", userModel.ID, mock.Anything).Return(nil)
+	presenceMock.On("Disconnect", userModel.ID, mock.Anything).Return(nil)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageRepoMock,
+		service.WithEvents(eventsMock), service.WithPresence(presenceMock, 0, 0))
+
+	eventsResponse, err := testObj.PollEvents(context.Background(), view.PollEventsRequest{UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(view.EventsResponse{{Type: model.EventTyping, ChatID: chatModel.ID.Hex(), UserID: event.User.Hex()}}, eventsResponse)
+	presenceMock.AssertCalled(t, "Connect", userModel.ID, mock.Anything)
+	presenceMock.AssertCalled(t, "Disconnect", userModel.ID, mock.Anything)
+
+	testObj = service.NewChatService(userRepoMock, chatRepoMock, messageRepoMock)
+	eventsResponse, err = testObj.PollEvents(context.Background(), view.PollEventsRequest{UserID: userModel.ID.Hex()})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(503, responseError.Status)
+	}
+	assert.Empty(eventsResponse)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/model"
+)
+
+const (
+	maxPreviews    = 3
+	unfurlDeadline = 10 * time.Second
+)
+
+// LinkFetcher loads the preview of a web page.
+type LinkFetcher interface {
+	Fetch(ctx context.Context, link string) (model.Preview, error)
+}
+
+// WithLinkPreviews attaches previews of the links in new messages, unfurling
+// up to workers messages at a time. Without it messages are stored as sent.
+func WithLinkPreviews(fetcher LinkFetcher, workers int) Option {
+	return func(c *ChatService) {
+		c.links = fetcher
+		c.unfurls = make(chan struct{}, workers)
+	}
+}
+
+var bareLink = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// unfurl fetches the previews of the message links in the background, so
+// sending never waits on third-party sites. Links that fail are skipped, and
+// so are the messages sent while every worker is busy.
+func (c *ChatService) unfurl(id string, message model.Message) {
+	if c.links == nil {
+		return
+	}
+
+	links := messageLinks(message)
+	if len(links) == 0 {
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+
+	select {
+	case c.unfurls <- struct{}{}:
+	default:
+		log.Printf("skipped previews of message %s: all unfurl workers are busy", id)
+		return
+	}
+
+	go func() {
+		defer func() { <-c.unfurls }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), unfurlDeadline)
+		defer cancel()
+
+		previews := make([]model.Preview, 0, len(links))
+		for _, link := range links {
+			preview, err := c.links.Fetch(ctx, link)
+			if err != nil {
+				continue
+			}
+
+			previews = append(previews, preview)
+		}
+
+		if len(previews) == 0 {
+			return
+		}
+
+		if err := c.messageRepo.SetPreviews(messageID, previews); err != nil {
+			log.Printf("failed to save previews of message %s: %s", id, err)
+		}
+	}()
+}
+
+// messageLinks returns the first few distinct links of the message, from
+// Markdown links first and then from the plain text.
+func messageLinks(message model.Message) []string {
+	var links []string
+	seen := make(map[string]bool)
+
+	add := func(link string) {
+		if len(links) < maxPreviews && !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+
+	for _, entity := range message.Entities {
+		if entity.Type == model.EntityLink {
+			add(entity.URL)
+		}
+	}
+
+	for _, link := range bareLink.FindAllString(message.Text, -1) {
+		add(strings.TrimRight(link, ".,:;!?)]}'"))
+	}
+
+	return links
+}
@@ -0,0 +1,122 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLinkPreviews(t *testing.T) {
+	assert := assert.New(t)
+
+	messageID := primitive.NewObjectID()
+	preview := model.Preview{URL: "https://example.com/a", Title: "Example"}
+
+	fetcherMock := new(mocks.LinkFetcher)
+	fetcherMock.On("Fetch", mock.Anything, "https://example.com/a").Return(preview, nil)
+	fetcherMock.On("Fetch", mock.Anything, "https://example.org/b").Return(model.Preview{}, errors.New("timeout"))
+
+	saved := make(chan []model.Preview, 1)
+	messagePreviewRepoMock := new(mocks.MessageRepository)
+	messagePreviewRepoMock.On("InsertMessage", mock.Anything).Return(messageID.Hex(), nil)
+	messagePreviewRepoMock.On("SetPreviews", messageID, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		saved <- args.Get(1).([]model.Preview)
+	})
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messagePreviewRepoMock, service.WithLinkPreviews(fetcherMock, 2))
+
+	// Duplicates and trailing punctuation don't produce extra fetches.
+	_, err := testObj.AddMessage(view.NewMessageRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		Text:   "see [this](https://example.com/a), https://example.com/a and https://example.org/b.",
+	})
+	assert.NoError(err)
+
+	select {
+	case previews := <-saved:
+		assert.Equal([]model.Preview{preview}, previews)
+	case <-time.After(time.Second):
+		t.Fatal("previews were not saved")
+	}
+	fetcherMock.AssertNumberOfCalls(t, "Fetch", 2)
+
+	// Messages without links are not unfurled.
+	_, err = testObj.AddMessage(view.NewMessageRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		Text:   "no links here",
+	})
+	assert.NoError(err)
+	fetcherMock.AssertNumberOfCalls(t, "Fetch", 2)
+}
+
+func TestLinkPreviewsBusy(t *testing.T) {
+	assert := assert.New(t)
+
+	messageID := primitive.NewObjectID()
+	preview := model.Preview{URL: "https://example.com/a", Title: "Example"}
+
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	fetcherMock := new(mocks.LinkFetcher)
+	fetcherMock.On("Fetch", mock.Anything, mock.Anything).Return(preview, nil).Run(func(args mock.Arguments) {
+		started <- args.String(1)
+		<-release
+	})
+
+	saved := make(chan struct{}, 2)
+	messagePreviewRepoMock := new(mocks.MessageRepository)
+	messagePreviewRepoMock.On("InsertMessage", mock.Anything).Return(messageID.Hex(), nil)
+	messagePreviewRepoMock.On("SetPreviews", messageID, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		saved <- struct{}{}
+	})
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messagePreviewRepoMock, service.WithLinkPreviews(fetcherMock, 1))
+
+	send := func(text string) {
+		_, err := testObj.AddMessage(view.NewMessageRequest{
+			ChatID: chatModel.ID.Hex(),
+			UserID: userModel.ID.Hex(),
+			Text:   text,
+		})
+		assert.NoError(err)
+	}
+
+	send("https://example.com/a")
+	select {
+	case link := <-started:
+		assert.Equal("https://example.com/a", link)
+	case <-time.After(time.Second):
+		t.Fatal("link was not fetched")
+	}
+
+	// The only worker is busy, so this message is stored without previews.
+	send("https://example.com/b")
+
+	close(release)
+	select {
+	case <-saved:
+	case <-time.After(time.Second):
+		t.Fatal("previews were not saved")
+	}
+
+	// Once the worker is free again new messages are unfurled.
+	assert.Eventually(func() bool {
+		send("https://example.com/c")
+		select {
+		case link := <-started:
+			return assert.Equal("https://example.com/c", link)
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	maxDisplayNameLength = 64
+	maxAvatarLength      = 2048
+	maxBioLength         = 500
+	maxStatusLength      = 140
+	maxLookupUsers       = 100
+	defaultSearchLimit   = 20
+	maxSearchLimit       = 50
+)
+
+var validUserName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{2,31}$`)
+
+func (c *ChatService) GetUser(request view.UserRequest) (view.UserProfile, error) {
+	user, err := c.userRepo.FindUserByID(request.UserID)
+	if err != nil {
+		return view.UserProfile{}, errs.New(404, "user not found", err)
+	}
+
+	userView := userToView(user)
+	userView.Presence, userView.LastSeen = c.presenceOf(c.findPresence([]primitive.ObjectID{user.ID}), user.ID)
+
+	return userView, nil
+}
+
+func (c *ChatService) UpdateUser(update view.UpdateUserRequest) (view.UserProfile, error) {
+	fields := []struct {
+		name  string
+		value *string
+		max   int
+	}{
+		{"display_name", update.DisplayName, maxDisplayNameLength},
+		{"avatar", update.Avatar, maxAvatarLength},
+		{"bio", update.Bio, maxBioLength},
+		{"status", update.Status, maxStatusLength},
+	}
+
+	for _, field := range fields {
+		if field.value != nil && utf8.RuneCountInString(*field.value) > field.max {
+			return view.UserProfile{}, errs.New(400, fmt.Sprintf("%s must be at most %d characters", field.name, field.max), nil)
+		}
+	}
+
+	user, err := c.findUser(update.UserID)
+	if err != nil {
+		return view.UserProfile{}, err
+	}
+
+	if update.DisplayName != nil {
+		user.DisplayName = *update.DisplayName
+	}
+	if update.Avatar != nil {
+		user.Avatar = *update.Avatar
+	}
+	if update.Bio != nil {
+		user.Bio = *update.Bio
+	}
+	if update.Status != nil {
+		user.Status = *update.Status
+	}
+
+	c.touch(user)
+
+	if err := c.userRepo.UpdateUser(user); err != nil {
+		return view.UserProfile{}, errs.New(500, "internal server error", err)
+	}
+
+	return userToView(user), nil
+}
+
+// LookupUsers resolves many user IDs at once. Unknown users are left out of
+// the response.
+func (c *ChatService) LookupUsers(request view.LookupUsersRequest) (view.UsersResponse, error) {
+	var usersView []view.UserProfile
+
+	if len(request.UsersID) > maxLookupUsers {
+		return view.UsersResponse{}, errs.New(400, fmt.Sprintf("at most %d users can be looked up at once", maxLookupUsers), nil)
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(request.UsersID))
+	for _, userID := range request.UsersID {
+		id, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			return view.UsersResponse{}, errs.New(400, "user id is invalid: "+userID, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	usersModel, err := c.userRepo.FindUsersByIDs(ids)
+	if err != nil {
+		return view.UsersResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	presence := c.findPresence(ids)
+	for _, userModel := range usersModel {
+		userView := userToView(userModel)
+		userView.Presence, userView.LastSeen = c.presenceOf(presence, userModel.ID)
+
+		usersView = append(usersView, userView)
+	}
+
+	return usersView, nil
+}
+
+// SearchUsers finds users by a case-insensitive username prefix.
+func (c *ChatService) SearchUsers(request view.SearchUsersRequest) (view.UsersResponse, error) {
+	var usersView []view.UserProfile
+
+	if request.Query == "" {
+		return view.UsersResponse{}, errs.New(400, "query not found", nil)
+	}
+
+	limit := request.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	usersModel, err := c.userRepo.SearchUsers(request.Query, limit)
+	if err != nil {
+		return view.UsersResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	for _, userModel := range usersModel {
+		usersView = append(usersView, userToView(userModel))
+	}
+
+	return usersView, nil
+}
+
+// isDuplicateKey reports whether a write failed on a unique index.
+func isDuplicateKey(err error) bool {
+	var writeException mongo.WriteException
+	if !errors.As(err, &writeException) {
+		return false
+	}
+
+	for _, writeError := range writeException.WriteErrors {
+		if writeError.Code == 11000 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func userToView(user model.User) view.UserProfile {
+	return view.UserProfile{
+		ID:          user.ID.Hex(),
+		UserName:    user.UserName,
+		DisplayName: user.DisplayName,
+		Avatar:      user.Avatar,
+		Bio:         user.Bio,
+		Status:      user.Status,
+		IsBot:       user.Bot,
+	}
+}
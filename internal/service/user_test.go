@@ -0,0 +1,120 @@
+package service_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUser(t *testing.T) {
+	assert := assert.New(t)
+	testObj := service.NewChatService(userRepoMock, chatRepoMock, messageRepoMock)
+
+	userResponse, err := testObj.GetUser(view.UserRequest{UserID: userModel.ID.Hex()})
+	assert.NoError(err)
+	assert.Equal(userModel.ID.Hex(), userResponse.ID)
+	assert.Equal(userModel.UserName, userResponse.UserName)
+
+	userErrRepoMock := new(mocks.UserRepository)
+	userErrRepoMock.On("FindUserByID", "incorrect id").Return(model.User{}, errors.New("incorrect id"))
+	testObj = service.NewChatService(userErrRepoMock, chatRepoMock, messageRepoMock)
+	userResponse, err = testObj.GetUser(view.UserRequest{UserID: "incorrect id"})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(404, responseError.Status)
+	}
+	assert.Empty(userResponse)
+}
+
+func TestUpdateUser(t *testing.T) {
+	assert := assert.New(t)
+
+	displayName := "Test User"
+	status := "on vacation"
+	updatedModel := userModel
+	updatedModel.DisplayName = displayName
+	updatedModel.Status = status
+
+	userProfileRepoMock := new(mocks.UserRepository)
+	userProfileRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userProfileRepoMock.On("UpdateUser", updatedModel).Return(nil)
+	testObj := service.NewChatService(userProfileRepoMock, chatRepoMock, messageRepoMock)
+
+	updateRequest := view.UpdateUserRequest{
+		UserID:      userModel.ID.Hex(),
+		DisplayName: &displayName,
+		Status:      &status,
+	}
+
+	userResponse, err := testObj.UpdateUser(updateRequest)
+	assert.NoError(err)
+	assert.Equal(displayName, userResponse.DisplayName)
+	assert.Equal(status, userResponse.Status)
+	userProfileRepoMock.AssertCalled(t, "UpdateUser", updatedModel)
+
+	longBio := strings.Repeat("a", 501)
+	userResponse, err = testObj.UpdateUser(view.UpdateUserRequest{UserID: userModel.ID.Hex(), Bio: &longBio})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+	assert.Empty(userResponse)
+}
+
+func TestLookupUsers(t *testing.T) {
+	assert := assert.New(t)
+
+	otherModel := model.User{ID: primitive.NewObjectID(), UserName: "Other", DisplayName: "Other User"}
+	userLookupRepoMock := new(mocks.UserRepository)
+	userLookupRepoMock.On("FindUsersByIDs", []primitive.ObjectID{userModel.ID, otherModel.ID}).Return([]model.User{userModel, otherModel}, nil)
+	testObj := service.NewChatService(userLookupRepoMock, chatRepoMock, messageRepoMock)
+
+	usersResponse, err := testObj.LookupUsers(view.LookupUsersRequest{UsersID: []string{userModel.ID.Hex(), otherModel.ID.Hex()}})
+	assert.NoError(err)
+	assert.Len(usersResponse, 2)
+	assert.Equal(otherModel.DisplayName, usersResponse[1].DisplayName)
+
+	usersResponse, err = testObj.LookupUsers(view.LookupUsersRequest{UsersID: []string{"incorrect id"}})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+	assert.Empty(usersResponse)
+}
+
+func TestSearchUsers(t *testing.T) {
+	assert := assert.New(t)
+
+	userSearchRepoMock := new(mocks.UserRepository)
+	userSearchRepoMock.On("SearchUsers", "te", int64(20)).Return([]model.User{userModel}, nil)
+	testObj := service.NewChatService(userSearchRepoMock, chatRepoMock, messageRepoMock)
+
+	usersResponse, err := testObj.SearchUsers(view.SearchUsersRequest{Query: "te"})
+	assert.NoError(err)
+	assert.Equal(userModel.ID.Hex(), usersResponse[0].ID)
+	assert.Equal(userModel.UserName, usersResponse[0].UserName)
+
+	userErrRepoMock := new(mocks.UserRepository)
+	userErrRepoMock.On("SearchUsers", "te", int64(50)).Return([]model.User{}, errors.New("internal db error"))
+	testObj = service.NewChatService(userErrRepoMock, chatRepoMock, messageRepoMock)
+	usersResponse, err = testObj.SearchUsers(view.SearchUsersRequest{Query: "te", Limit: 500})
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(500, responseError.Status)
+	}
+	assert.Empty(usersResponse)
+}
@@ -0,0 +1,372 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/view"
+)
+
+const (
+	maxChatWebhooks     = 10
+	webhookFailuresPage = 100
+)
+
+// WebhookSender delivers webhook events in the background.
+type WebhookSender interface {
+	Send(hook model.Webhook, event string, payload []byte)
+}
+
+// WithWebhooks delivers chat events to the webhooks of the chats and to the
+// global webhooks, which receive the events of every chat.
+func WithWebhooks(sender WebhookSender, global ...model.Webhook) Option {
+	return func(c *ChatService) {
+		c.webhooks = sender
+		c.globalHooks = global
+	}
+}
+
+// AddWebhook subscribes a URL to the events of the chat. Only the owner
+// manages the webhooks of a chat; the secret is returned this time only.
+func (c *ChatService) AddWebhook(request view.NewWebhookRequest) (view.Webhook, error) {
+	if err := checkWebhookURL(request.URL); err != nil {
+		return view.Webhook{}, err
+	}
+
+	for _, event := range request.Events {
+		if !isWebhookEvent(event) {
+			return view.Webhook{}, errs.New(400, fmt.Sprintf("unknown event %q", event), nil)
+		}
+	}
+
+	chat, user, err := c.findWebhookChat(request.ChatID, request.UserID)
+	if err != nil {
+		return view.Webhook{}, err
+	}
+
+	hooks, err := c.chatRepo.FindWebhooks(chat.ID)
+	if err != nil {
+		return view.Webhook{}, errs.New(500, "internal server error", err)
+	}
+
+	if len(hooks) >= maxChatWebhooks {
+		return view.Webhook{}, errs.New(409, fmt.Sprintf("a chat can have at most %d webhooks", maxChatWebhooks), nil)
+	}
+
+	secret, err := newInviteToken()
+	if err != nil {
+		return view.Webhook{}, errs.New(500, "internal server error", err)
+	}
+
+	hook := model.Webhook{
+		Chat:      chat.ID,
+		Creator:   user.ID,
+		URL:       request.URL,
+		Secret:    secret,
+		Events:    request.Events,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	id, err := c.chatRepo.InsertWebhook(hook)
+	if err != nil {
+		return view.Webhook{}, errs.New(500, "internal server error", err)
+	}
+	hook.ID, _ = primitive.ObjectIDFromHex(id)
+
+	hookView := webhookToView(hook)
+	hookView.Secret = hook.Secret
+
+	return hookView, nil
+}
+
+func (c *ChatService) GetWebhooks(request view.WebhooksRequest) (view.WebhooksResponse, error) {
+	hooksView := view.WebhooksResponse{}
+
+	chat, _, err := c.findWebhookChat(request.ChatID, request.UserID)
+	if err != nil {
+		return view.WebhooksResponse{}, err
+	}
+
+	hooks, err := c.chatRepo.FindWebhooks(chat.ID)
+	if err != nil {
+		return view.WebhooksResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	for _, hook := range hooks {
+		hooksView = append(hooksView, webhookToView(hook))
+	}
+
+	return hooksView, nil
+}
+
+func (c *ChatService) DeleteWebhook(request view.DeleteWebhookRequest) (view.DeleteWebhookResponse, error) {
+	hook, err := c.chatRepo.FindWebhookByID(request.WebhookID)
+	if err != nil {
+		return view.DeleteWebhookResponse{}, errs.New(404, "webhook not found", err)
+	}
+
+	if _, _, err := c.findWebhookChat(hook.Chat.Hex(), request.UserID); err != nil {
+		return view.DeleteWebhookResponse{}, err
+	}
+
+	if err := c.chatRepo.DeleteWebhook(hook); err != nil {
+		return view.DeleteWebhookResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	return view.DeleteWebhookResponse{ID: hook.ID.Hex(), Deleted: true}, nil
+}
+
+// GetWebhookFailures lists the latest deliveries to the chat webhooks that
+// failed for good.
+func (c *ChatService) GetWebhookFailures(request view.WebhooksRequest) (view.WebhookFailuresResponse, error) {
+	failuresView := view.WebhookFailuresResponse{}
+
+	chat, _, err := c.findWebhookChat(request.ChatID, request.UserID)
+	if err != nil {
+		return view.WebhookFailuresResponse{}, err
+	}
+
+	failures, err := c.chatRepo.FindWebhookFailures(chat.ID, webhookFailuresPage)
+	if err != nil {
+		return view.WebhookFailuresResponse{}, errs.New(500, "internal server error", err)
+	}
+
+	for _, failure := range failures {
+		failuresView = append(failuresView, view.WebhookFailure{
+			ID:        failure.ID.Hex(),
+			WebhookID: failure.Webhook.Hex(),
+			URL:       failure.URL,
+			Event:     failure.Event,
+			Payload:   failure.Payload,
+			Attempts:  failure.Attempts,
+			Error:     failure.Error,
+			FailedAt:  failure.FailedAt.Time().UTC().Format(time.RFC3339),
+		})
+	}
+
+	return failuresView, nil
+}
+
+func (c *ChatService) findWebhookChat(chatID string, userID string) (model.Chat, model.User, error) {
+	chat, err := c.findChat(chatID)
+	if err != nil {
+		return model.Chat{}, model.User{}, err
+	}
+
+	user, err := c.findUser(userID)
+	if err != nil {
+		return model.Chat{}, model.User{}, err
+	}
+
+	if chatOwner(chat) != user.ID {
+		return model.Chat{}, model.User{}, errs.New(403, "only the owner can manage webhooks", nil)
+	}
+
+	return chat, user, nil
+}
+
+// notify sends the event to the subscribed webhooks of the chat, of the bots
+// in it other than the actor, and to the global ones. Looking the webhooks
+// up happens in the background too, so webhooks never slow down the request
+// that caused the event.
+func (c *ChatService) notify(chat model.Chat, actor primitive.ObjectID, event string, data interface{}) {
+	if c.webhooks == nil {
+		return
+	}
+
+	payload, ok := webhookPayload(event, data)
+	if !ok {
+		return
+	}
+
+	go c.sendWebhooks(chat, actor, event, payload)
+}
+
+func (c *ChatService) sendWebhooks(chat model.Chat, actor primitive.ObjectID, event string, payload []byte) {
+	hooks := c.globalHooks
+	if !chat.ID.IsZero() {
+		chatHooks, err := c.chatRepo.FindWebhooks(chat.ID)
+		if err != nil {
+			log.Printf("webhooks of chat %s not found: %s", chat.ID.Hex(), err)
+		}
+		hooks = append(chatHooks, hooks...)
+	}
+
+	var bots []primitive.ObjectID
+	for _, member := range chat.Users {
+		if member.Bot && member.ID != actor {
+			bots = append(bots, member.ID)
+		}
+	}
+
+	if len(bots) > 0 {
+		botHooks, err := c.chatRepo.FindBotWebhooks(bots)
+		if err != nil {
+			log.Printf("webhooks of the bots in chat %s not found: %s", chat.ID.Hex(), err)
+		}
+		hooks = append(hooks, botHooks...)
+	}
+
+	for _, hook := range hooks {
+		if hook.Subscribed(event) {
+			c.webhooks.Send(hook, event, payload)
+		}
+	}
+}
+
+// notifyBot sends the event to the webhooks of the bot only.
+func (c *ChatService) notifyBot(bot model.User, event string, data interface{}) {
+	if c.webhooks == nil {
+		return
+	}
+
+	payload, ok := webhookPayload(event, data)
+	if !ok {
+		return
+	}
+
+	go func() {
+		hooks, err := c.chatRepo.FindBotWebhooks([]primitive.ObjectID{bot.ID})
+		if err != nil {
+			log.Printf("webhooks of bot %s not found: %s", bot.ID.Hex(), err)
+		}
+
+		for _, hook := range hooks {
+			if hook.Subscribed(event) {
+				c.webhooks.Send(hook, event, payload)
+			}
+		}
+	}()
+}
+
+func webhookPayload(event string, data interface{}) ([]byte, bool) {
+	payload, err := json.Marshal(view.WebhookEvent{
+		ID:        primitive.NewObjectID().Hex(),
+		Event:     event,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Data:      data,
+	})
+	if err != nil {
+		log.Printf("failed to encode %s webhook event: %s", event, err)
+		return nil, false
+	}
+
+	return payload, true
+}
+
+// messageCreated tells the other members of the chat and the webhooks about
+// a message that was just stored under id. Whom to alert about it is looked
+// up in the background, like the webhooks, so it never slows down sending.
+func (c *ChatService) messageCreated(chat model.Chat, id string, message model.Message) {
+	if c.events == nil && c.webhooks == nil {
+		return
+	}
+
+	message.ID, _ = primitive.ObjectIDFromHex(id)
+	message.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	c.publish(chat, model.Event{
+		Type:      model.EventMessage,
+		Chat:      chat.ID,
+		User:      message.Author,
+		Message:   &message,
+		ExpiresAt: time.Now().Add(messageEventTTL),
+	})
+
+	go c.alert(chat, message)
+}
+
+// alert sends a notification event to the members to alert about the
+// message, following their notification settings, and the message.created
+// webhooks, which list them.
+func (c *ChatService) alert(chat model.Chat, message model.Message) {
+	// Without the settings nobody is alerted, rather than the muted too.
+	recipients, err := c.NotificationRecipients(chat, message)
+	if err != nil {
+		log.Printf("notification settings of chat %s not found: %s", chat.ID.Hex(), err)
+	}
+
+	alerted := make([]primitive.ObjectID, 0, len(recipients))
+	notifyIDs := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		alerted = append(alerted, recipient.ID)
+		notifyIDs = append(notifyIDs, recipient.ID.Hex())
+	}
+
+	if c.events != nil && len(alerted) > 0 {
+		c.events.Publish(alerted, model.Event{
+			Type:      model.EventNotification,
+			Chat:      chat.ID,
+			User:      message.Author,
+			Message:   &message,
+			ExpiresAt: time.Now().Add(messageEventTTL),
+		})
+	}
+
+	if c.webhooks == nil {
+		return
+	}
+
+	payload, ok := webhookPayload(model.WebhookMessageCreated, view.WebhookMessage{
+		Message:   messageToView(message),
+		NotifyIDs: notifyIDs,
+	})
+	if ok {
+		c.sendWebhooks(chat, message.Author, model.WebhookMessageCreated, payload)
+	}
+}
+
+func newChatToWebhook(id string, chat view.NewChatRequest, users []model.User) view.WebhookChat {
+	chatView := view.WebhookChat{ID: id, Name: chat.Name, Public: chat.Public}
+	for _, user := range users {
+		chatView.UsersID = append(chatView.UsersID, user.ID.Hex())
+	}
+
+	if len(users) > 0 {
+		chatView.CreatorID = users[0].ID.Hex()
+	}
+
+	return chatView
+}
+
+func isWebhookEvent(event string) bool {
+	for _, known := range model.WebhookEvents {
+		if event == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkWebhookURL(link string) error {
+	hookURL, err := url.Parse(link)
+	if err != nil || (hookURL.Scheme != "http" && hookURL.Scheme != "https") || hookURL.Host == "" {
+		return errs.New(400, "url must be an absolute http or https URL", err)
+	}
+
+	return nil
+}
+
+func webhookToView(hook model.Webhook) view.Webhook {
+	events := hook.Events
+	if len(events) == 0 {
+		events = model.WebhookEvents
+	}
+
+	return view.Webhook{
+		ID:        hook.ID.Hex(),
+		ChatID:    hook.Chat.Hex(),
+		CreatorID: hook.Creator.Hex(),
+		URL:       hook.URL,
+		Events:    events,
+		CreatedAt: hook.CreatedAt.Time().String(),
+	}
+}
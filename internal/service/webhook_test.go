@@ -0,0 +1,120 @@
+package service_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/errs"
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/repository/mocks"
+	"github.com/flaambe/avito/internal/service"
+	"github.com/flaambe/avito/internal/view"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAddWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	memberModel := model.User{ID: primitive.NewObjectID(), UserName: "Member"}
+	memberChatModel := chatModel
+	memberChatModel.Users = []model.User{userModel, memberModel}
+
+	userWebhookRepoMock := new(mocks.UserRepository)
+	userWebhookRepoMock.On("FindUserByID", userModel.ID.Hex()).Return(userModel, nil)
+	userWebhookRepoMock.On("FindUserByID", memberModel.ID.Hex()).Return(memberModel, nil)
+	chatWebhookRepoMock := new(mocks.ChatRepository)
+	chatWebhookRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(memberChatModel, nil)
+	chatWebhookRepoMock.On("FindWebhooks", chatModel.ID).Return([]model.Webhook{}, nil)
+	chatWebhookRepoMock.On("InsertWebhook", mock.Anything).Return(primitive.NewObjectID().Hex(), nil)
+	testObj := service.NewChatService(userWebhookRepoMock, chatWebhookRepoMock, messageRepoMock)
+
+	webhookRequest := view.NewWebhookRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		URL:    "https://ci.example.com/hook",
+	}
+
+	webhookResponse, err := testObj.AddWebhook(webhookRequest)
+	assert.NoError(err)
+	assert.NotEmpty(webhookResponse.ID)
+	assert.NotEmpty(webhookResponse.Secret)
+	assert.Equal(model.WebhookEvents, webhookResponse.Events)
+
+	webhookErrRequest := webhookRequest
+	webhookErrRequest.Events = []string{"message.deleted"}
+	_, err = testObj.AddWebhook(webhookErrRequest)
+	assert.Error(err)
+	var responseError *errs.ResponseError
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+
+	webhookErrRequest = webhookRequest
+	webhookErrRequest.URL = "ftp://ci.example.com/hook"
+	_, err = testObj.AddWebhook(webhookErrRequest)
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(400, responseError.Status)
+	}
+
+	// Members that don't own the chat can't add webhooks.
+	webhookErrRequest = webhookRequest
+	webhookErrRequest.UserID = memberModel.ID.Hex()
+	_, err = testObj.AddWebhook(webhookErrRequest)
+	assert.Error(err)
+	if errors.As(err, &responseError) {
+		assert.Equal(403, responseError.Status)
+	}
+	chatWebhookRepoMock.AssertNumberOfCalls(t, "InsertWebhook", 1)
+}
+
+func TestWebhookEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	joinedHook := model.Webhook{ID: primitive.NewObjectID(), Chat: chatModel.ID, Events: []string{model.WebhookMemberJoined}}
+	chatHook := model.Webhook{ID: primitive.NewObjectID(), Chat: chatModel.ID}
+	globalHook := model.Webhook{URL: "https://tools.example.com/chat", Events: []string{model.WebhookMessageCreated}}
+
+	chatWebhookRepoMock := new(mocks.ChatRepository)
+	chatWebhookRepoMock.On("FindChatByID", chatModel.ID.Hex()).Return(chatModel, nil)
+	chatWebhookRepoMock.On("FindWebhooks", chatModel.ID).Return([]model.Webhook{joinedHook, chatHook}, nil)
+	chatWebhookRepoMock.On("FindChatNotificationSettings", chatModel).Return([]model.NotificationSettings{}, nil)
+
+	sent := make(chan model.Webhook, 3)
+	senderMock := new(mocks.WebhookSender)
+	senderMock.On("Send", mock.Anything, model.WebhookMessageCreated, mock.Anything).Return().Run(func(args mock.Arguments) {
+		var event view.WebhookEvent
+		assert.NoError(json.Unmarshal(args.Get(2).([]byte), &event))
+		assert.Equal(model.WebhookMessageCreated, event.Event)
+		assert.Equal(messageModel.Text, event.Data.(map[string]interface{})["text"])
+		assert.Equal([]interface{}{}, event.Data.(map[string]interface{})["notify"])
+
+		sent <- args.Get(0).(model.Webhook)
+	})
+	testObj := service.NewChatService(userRepoMock, chatWebhookRepoMock, messageRepoMock, service.WithWebhooks(senderMock, globalHook))
+
+	_, err := testObj.AddMessage(view.NewMessageRequest{
+		ChatID: chatModel.ID.Hex(),
+		UserID: userModel.ID.Hex(),
+		Text:   messageModel.Text,
+	})
+	assert.NoError(err)
+
+	var hooks []model.Webhook
+	for i := 0; i < 2; i++ {
+		select {
+		case hook := <-sent:
+			hooks = append(hooks, hook)
+		case <-time.After(time.Second):
+			t.Fatal("webhook was not sent")
+		}
+	}
+	assert.ElementsMatch([]model.Webhook{chatHook, globalHook}, hooks)
+	senderMock.AssertNumberOfCalls(t, "Send", 2)
+}
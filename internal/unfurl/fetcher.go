@@ -0,0 +1,248 @@
+// Package unfurl fetches link previews from the Open Graph and HTML metadata
+// of web pages.
+package unfurl
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/netguard"
+)
+
+const (
+	maxBodySize  = 512 << 10
+	maxRedirects = 3
+	maxCacheSize = 10000
+	maxTextSize  = 300
+)
+
+// ErrForbiddenAddress is returned for links that resolve to loopback,
+// private or otherwise internal addresses.
+var ErrForbiddenAddress = netguard.ErrForbiddenAddress
+
+// Fetcher fetches previews over HTTP. It only connects to public addresses,
+// checked after DNS resolution so that rebinding can't reach internal hosts,
+// bounds every fetch by a timeout and a body size, and caches the results.
+type Fetcher struct {
+	client *http.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+type cached struct {
+	preview model.Preview
+	err     error
+	expires time.Time
+}
+
+// New returns a Fetcher whose fetches take at most timeout and whose results
+// are cached for ttl.
+func New(timeout time.Duration, ttl time.Duration) *Fetcher {
+	return newFetcher(timeout, ttl, netguard.IsPublic)
+}
+
+func newFetcher(timeout time.Duration, ttl time.Duration, allow func(net.IP) bool) *Fetcher {
+	return &Fetcher{
+		client: &http.Client{
+			Transport: netguard.Transport(timeout, allow),
+			Timeout:   timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("unfurl: stopped after %d redirects", maxRedirects)
+				}
+
+				return checkScheme(req.URL)
+			},
+		},
+		ttl:   ttl,
+		cache: make(map[string]cached),
+	}
+}
+
+// Fetch returns the preview of the page at link.
+func (f *Fetcher) Fetch(ctx context.Context, link string) (model.Preview, error) {
+	if preview, err, ok := f.cached(link); ok {
+		return preview, err
+	}
+
+	preview, err := f.fetch(ctx, link)
+	if ctx.Err() == nil {
+		f.store(link, preview, err)
+	}
+
+	return preview, err
+}
+
+func (f *Fetcher) fetch(ctx context.Context, link string) (model.Preview, error) {
+	page, err := url.Parse(link)
+	if err != nil {
+		return model.Preview{}, err
+	}
+
+	if err := checkScheme(page); err != nil {
+		return model.Preview{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, page.String(), nil)
+	if err != nil {
+		return model.Preview{}, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "ChatLinkPreview/1.0")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return model.Preview{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return model.Preview{}, fmt.Errorf("unfurl: %s returned %s", link, resp.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return model.Preview{}, fmt.Errorf("unfurl: %s is not a web page", link)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return model.Preview{}, err
+	}
+
+	preview := parse(string(body), resp.Request.URL)
+	preview.URL = link
+
+	return preview, nil
+}
+
+func (f *Fetcher) cached(link string) (model.Preview, error, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.cache[link]
+	if !ok || time.Now().After(entry.expires) {
+		return model.Preview{}, nil, false
+	}
+
+	return entry.preview, entry.err, true
+}
+
+func (f *Fetcher) store(link string, preview model.Preview, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if len(f.cache) >= maxCacheSize {
+		for key, entry := range f.cache {
+			if now.After(entry.expires) {
+				delete(f.cache, key)
+			}
+		}
+	}
+
+	// Still full of live entries: make room at random.
+	for key := range f.cache {
+		if len(f.cache) < maxCacheSize {
+			break
+		}
+		delete(f.cache, key)
+	}
+
+	f.cache[link] = cached{preview: preview, err: err, expires: now.Add(f.ttl)}
+}
+
+var (
+	titleTag = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	metaTag  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttr = regexp.MustCompile(`(?s)([a-zA-Z:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// parse reads the Open Graph tags of the page and falls back to its title
+// and description.
+func parse(page string, base *url.URL) model.Preview {
+	meta := make(map[string]string)
+	for _, tag := range metaTag.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, attr := range metaAttr.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(attr[1])] = html.UnescapeString(attr[2] + attr[3])
+		}
+
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+
+		key = strings.ToLower(key)
+		if _, ok := meta[key]; !ok && key != "" {
+			meta[key] = attrs["content"]
+		}
+	}
+
+	preview := model.Preview{
+		Title:       first(meta["og:title"], meta["twitter:title"]),
+		Description: first(meta["og:description"], meta["twitter:description"], meta["description"]),
+	}
+
+	if preview.Title == "" {
+		if match := titleTag.FindStringSubmatch(page); match != nil {
+			preview.Title = html.UnescapeString(match[1])
+		}
+	}
+
+	preview.Title = clean(preview.Title)
+	preview.Description = clean(preview.Description)
+
+	if image := first(meta["og:image"], meta["twitter:image"]); image != "" {
+		if ref, err := base.Parse(image); err == nil && checkScheme(ref) == nil {
+			preview.Image = ref.String()
+		}
+	}
+
+	return preview
+}
+
+func checkScheme(link *url.URL) error {
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return fmt.Errorf("unfurl: scheme %q is not allowed", link.Scheme)
+	}
+
+	return nil
+}
+
+func first(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// clean collapses whitespace and cuts the text to a card-sized length.
+func clean(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	runes := []rune(text)
+	if len(runes) > maxTextSize {
+		return string(runes[:maxTextSize-1]) + "…"
+	}
+
+	return text
+}
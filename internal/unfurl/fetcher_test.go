@@ -0,0 +1,77 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flaambe/avito/internal/model"
+)
+
+func TestFetch(t *testing.T) {
+	assert := assert.New(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><head><title>Fallback</title>
+<meta property="og:title" content="Tom &amp; Jerry">
+<meta content='A  cartoon
+about a cat' name="description">
+<meta property="og:image" content="/cover.png">
+</head></html>`))
+		case "/plain":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("hello"))
+		case "/redirect":
+			http.Redirect(w, r, "/redirect", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	testObj := newFetcher(time.Second, time.Minute, func(net.IP) bool { return true })
+
+	preview, err := testObj.Fetch(context.Background(), server.URL+"/page")
+	assert.NoError(err)
+	assert.Equal(model.Preview{
+		URL:         server.URL + "/page",
+		Title:       "Tom & Jerry",
+		Description: "A cartoon about a cat",
+		Image:       server.URL + "/cover.png",
+	}, preview)
+
+	// The second fetch is served from the cache.
+	_, err = testObj.Fetch(context.Background(), server.URL+"/page")
+	assert.NoError(err)
+	assert.Equal(1, requests)
+
+	_, err = testObj.Fetch(context.Background(), server.URL+"/plain")
+	assert.Error(err)
+	_, err = testObj.Fetch(context.Background(), server.URL+"/missing")
+	assert.Error(err)
+	_, err = testObj.Fetch(context.Background(), server.URL+"/redirect")
+	assert.Error(err)
+	_, err = testObj.Fetch(context.Background(), "file:///etc/passwd")
+	assert.Error(err)
+}
+
+func TestFetchInternalAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("internal address was fetched")
+	}))
+	defer server.Close()
+
+	_, err := New(time.Second, time.Minute).Fetch(context.Background(), server.URL)
+	assert.True(t, errors.Is(err, ErrForbiddenAddress), err)
+}
@@ -0,0 +1,73 @@
+package view
+
+type NewBotRequest struct {
+	UserID      string `json:"user"`
+	UserName    string `json:"username"`
+	DisplayName string `json:"display_name"`
+}
+
+// NewBotResponse carries the first API key of the bot, which is not shown
+// again.
+type NewBotResponse struct {
+	ID  string `json:"id"`
+	Key BotKey `json:"key"`
+}
+
+type BotRequest struct {
+	BotID  string `json:"bot"`
+	UserID string `json:"user"`
+}
+
+type RevokeBotKeyRequest struct {
+	BotID  string `json:"bot"`
+	UserID string `json:"user"`
+	KeyID  string `json:"key"`
+}
+
+type AddBotToChatRequest struct {
+	ChatID string `json:"chat"`
+	UserID string `json:"user"`
+	BotID  string `json:"bot"`
+}
+
+// BotKey carries the key itself only when it is created.
+type BotKey struct {
+	ID        string `json:"id"`
+	Key       string `json:"key,omitempty"`
+	Prefix    string `json:"prefix"`
+	CreatedAt string `json:"created_at"`
+}
+
+type RevokeBotKeyResponse struct {
+	ID      string `json:"id"`
+	Revoked bool   `json:"revoked"`
+}
+
+// The requests of the bot API name no user: the bot is the owner of the
+// API key in the Authorization header.
+
+type BotChatRequest struct {
+	ChatID string `json:"chat"`
+	HTML   bool   `json:"html"`
+}
+
+type BotMessageRequest struct {
+	ChatID string   `json:"chat"`
+	Text   string   `json:"text"`
+	TTL    int64    `json:"ttl"`
+	Poll   *NewPoll `json:"poll,omitempty"`
+}
+
+type BotPollEventsRequest struct {
+	Device  string `json:"device"`
+	Timeout int    `json:"timeout"`
+}
+
+// BotWebhookRequest points the events of the bot at a URL, an empty URL
+// removes the webhook.
+type BotWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type BotKeysResponse []BotKey
@@ -3,30 +3,113 @@ package view
 type User struct {
 	ID       string `json:"id"`
 	UserName string `json:"name"`
+	IsBot    bool   `json:"is_bot,omitempty"`
+	Presence string `json:"presence,omitempty"`
+	LastSeen string `json:"last_seen,omitempty"`
 }
 
 type Chat struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	Users     []User `json:"users"`
-	CreatedAt string `json:"created_at"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Avatar      string `json:"avatar"`
+	Owner       string `json:"owner"`
+	Public      bool   `json:"public"`
+	Direct      bool   `json:"direct"`
+	Users       []User `json:"users"`
+	Archived    bool   `json:"archived"`
+	CreatedAt   string `json:"created_at"`
+
+	RetentionDays int                   `json:"retention_days"`
+	Notifications *NotificationSettings `json:"notifications,omitempty"`
+	Draft         *Draft                `json:"draft,omitempty"`
 }
 
+// NewChatRequest creates a direct chat between exactly two users when Direct
+// is set.
 type NewChatRequest struct {
 	Name    string   `json:"name"`
 	UsersID []string `json:"users"`
+	Public  bool     `json:"public"`
+	Direct  bool     `json:"direct"`
+}
+
+type UpdateChatRequest struct {
+	ChatID        string  `json:"chat"`
+	UserID        string  `json:"user"`
+	Name          *string `json:"name"`
+	Description   *string `json:"description"`
+	Avatar        *string `json:"avatar"`
+	Public        *bool   `json:"public"`
+	RetentionDays *int    `json:"retention_days"`
+}
+
+type ArchiveChatRequest struct {
+	ChatID   string `json:"chat"`
+	UserID   string `json:"user"`
+	Archived bool   `json:"archived"`
+}
+
+type DeleteChatRequest struct {
+	ChatID string `json:"chat"`
+	UserID string `json:"user"`
+}
+
+type LeaveChatRequest struct {
+	ChatID string `json:"chat"`
+	UserID string `json:"user"`
 }
 
 type ChatsRequest struct {
+	UserID          string `json:"user"`
+	IncludeArchived bool   `json:"include_archived"`
+}
+
+type DiscoverChatsRequest struct {
+	Query string `json:"query"`
+	Limit int64  `json:"limit"`
+}
+
+type JoinChatRequest struct {
+	ChatID string `json:"chat"`
 	UserID string `json:"user"`
 }
 
 type MessagesRequest struct {
 	СhatID string `json:"chat"`
+	UserID string `json:"user"`
+	HTML   bool   `json:"html"`
 }
 
 type NewChatResponse struct {
 	ID string `json:"id"`
 }
 
+type ArchiveChatResponse struct {
+	ID       string `json:"id"`
+	Archived bool   `json:"archived"`
+}
+
+type LeaveChatResponse struct {
+	ID   string `json:"id"`
+	Left bool   `json:"left"`
+}
+
+type DeleteChatResponse struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Deleted int64  `json:"deleted_messages"`
+}
+
+type PublicChat struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Avatar      string `json:"avatar"`
+	Members     int    `json:"members"`
+	CreatedAt   string `json:"created_at"`
+}
+
 type ChatsResponse []Chat
+
+type DiscoverChatsResponse []PublicChat
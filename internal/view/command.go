@@ -0,0 +1,38 @@
+package view
+
+type Command struct {
+	Name        string `json:"name"`
+	Usage       string `json:"usage,omitempty"`
+	Description string `json:"description"`
+	BotID       string `json:"bot,omitempty"`
+}
+
+type CommandsRequest struct {
+	ChatID string `json:"chat"`
+	UserID string `json:"user"`
+}
+
+// CommandCall is sent to the bot serving the command, in the command event
+// and in the command.invoked webhook.
+type CommandCall struct {
+	ID      string   `json:"id"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Text    string   `json:"text"`
+	ChatID  string   `json:"chat"`
+	UserID  string   `json:"user"`
+}
+
+type BotCommandsRequest struct {
+	Commands []Command `json:"commands"`
+}
+
+// BotCommandResponse answers the command call with the given ID, only to the
+// user who ran it when ephemeral.
+type BotCommandResponse struct {
+	CallID    string `json:"call"`
+	Text      string `json:"text"`
+	Ephemeral bool   `json:"ephemeral"`
+}
+
+type CommandsResponse []Command
@@ -0,0 +1,20 @@
+package view
+
+type Draft struct {
+	ChatID    string `json:"chat"`
+	Text      string `json:"text"`
+	ReplyTo   string `json:"reply_to,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+type SaveDraftRequest struct {
+	ChatID  string `json:"chat"`
+	UserID  string `json:"user"`
+	Text    string `json:"text"`
+	ReplyTo string `json:"reply_to"`
+}
+
+type DraftRequest struct {
+	ChatID string `json:"chat"`
+	UserID string `json:"user"`
+}
@@ -0,0 +1,29 @@
+package view
+
+// PollEventsRequest names the device polling, so that each device of the
+// user gets every event.
+type PollEventsRequest struct {
+	UserID  string `json:"user"`
+	Device  string `json:"device"`
+	Timeout int    `json:"timeout"`
+}
+
+type TypingRequest struct {
+	ChatID string `json:"chat"`
+	UserID string `json:"user"`
+}
+
+type TypingResponse struct {
+	ExpiresAt string `json:"expires_at"`
+}
+
+type Event struct {
+	Type      string       `json:"type"`
+	ChatID    string       `json:"chat"`
+	UserID    string       `json:"user"`
+	Message   *Message     `json:"message,omitempty"`
+	Command   *CommandCall `json:"command,omitempty"`
+	ExpiresAt string       `json:"expires_at,omitempty"`
+}
+
+type EventsResponse []Event
@@ -0,0 +1,32 @@
+package view
+
+// ExportRecord is one line of a personal data export.
+type ExportRecord struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// ExportBlock is a user the exported user blocked.
+type ExportBlock struct {
+	UserID    string `json:"user"`
+	CreatedAt string `json:"created_at"`
+}
+
+type ExportNotificationSettings struct {
+	ChatID string `json:"chat"`
+	NotificationSettings
+}
+
+// ExportBot is a bot the exported user owns, with its API keys but never the
+// keys themselves.
+type ExportBot struct {
+	UserProfile
+	Keys []BotKey `json:"keys"`
+}
+
+// ExportVote lists the options the exported user chose in a poll.
+type ExportVote struct {
+	MessageID string `json:"message"`
+	ChatID    string `json:"chat"`
+	Options   []int  `json:"options"`
+}
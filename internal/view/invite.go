@@ -0,0 +1,36 @@
+package view
+
+type Invite struct {
+	Token     string `json:"token"`
+	ChatID    string `json:"chat"`
+	CreatorID string `json:"creator"`
+	MaxUses   int    `json:"max_uses"`
+	Remaining int    `json:"remaining"`
+	Revoked   bool   `json:"revoked"`
+	ExpiresAt string `json:"expires_at"`
+	CreatedAt string `json:"created_at"`
+}
+
+type NewInviteRequest struct {
+	ChatID    string `json:"chat"`
+	UserID    string `json:"user"`
+	MaxUses   int    `json:"max_uses"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type InvitesRequest struct {
+	ChatID string `json:"chat"`
+	UserID string `json:"user"`
+}
+
+type RevokeInviteRequest struct {
+	Token  string `json:"token"`
+	UserID string `json:"user"`
+}
+
+type RedeemInviteRequest struct {
+	Token  string `json:"token"`
+	UserID string `json:"user"`
+}
+
+type InvitesResponse []Invite
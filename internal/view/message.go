@@ -4,18 +4,75 @@ type NewMessageRequest struct {
 	ChatID string `json:"chat"`
 	UserID string `json:"author"`
 	Text   string `json:"text"`
+	TTL    int64  `json:"ttl"`
+
+	Poll *NewPoll `json:"poll,omitempty"`
 }
 
+// NewMessageResponse has no ID for slash commands that post nothing. Their
+// answer, if any, is the ephemeral message only the caller sees.
 type NewMessageResponse struct {
-	ID string `json:"id"`
+	ID        string   `json:"id"`
+	Ephemeral *Message `json:"ephemeral,omitempty"`
 }
 
 type Message struct {
 	ID        string `json:"id"`
 	ChatID    string `json:"chat"`
 	AuthorID  string `json:"author"`
+	IsBot     bool   `json:"is_bot"`
+	Type      string `json:"type"`
 	Text      string `json:"text"`
 	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+
+	Entities []Entity `json:"entities,omitempty"`
+	HTML     string   `json:"html,omitempty"`
+
+	ForwardedFrom *ForwardedFrom `json:"forwarded_from,omitempty"`
+	Poll          *Poll          `json:"poll,omitempty"`
+	System        *SystemEvent   `json:"system,omitempty"`
+
+	Previews []Preview `json:"previews,omitempty"`
+}
+
+type SystemEvent struct {
+	Event string `json:"event"`
+	By    string `json:"by,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Field string `json:"field,omitempty"`
+	Via   string `json:"via,omitempty"`
+}
+
+type Entity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	URL    string `json:"url,omitempty"`
+}
+
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+type ForwardedFrom struct {
+	MessageID string `json:"message"`
+	ChatID    string `json:"chat"`
+	AuthorID  string `json:"author"`
+}
+
+type ForwardMessagesRequest struct {
+	FromChatID string   `json:"from_chat"`
+	ChatID     string   `json:"chat"`
+	UserID     string   `json:"user"`
+	MessagesID []string `json:"messages"`
+}
+
+type ForwardMessagesResponse struct {
+	IDs []string `json:"ids"`
 }
 
 type MessagesResponse []Message
@@ -0,0 +1,18 @@
+package view
+
+type NotificationSettings struct {
+	Mode       string `json:"mode"`
+	MutedUntil string `json:"muted_until,omitempty"`
+}
+
+type NotificationSettingsRequest struct {
+	ChatID string `json:"chat"`
+	UserID string `json:"user"`
+}
+
+type UpdateNotificationSettingsRequest struct {
+	ChatID     string `json:"chat"`
+	UserID     string `json:"user"`
+	Mode       string `json:"mode"`
+	MutedUntil string `json:"muted_until"`
+}
@@ -0,0 +1,31 @@
+package view
+
+type NewPoll struct {
+	Question  string   `json:"question"`
+	Options   []string `json:"options"`
+	Multiple  bool     `json:"multiple"`
+	Anonymous bool     `json:"anonymous"`
+	ClosesAt  string   `json:"closes_at"`
+}
+
+type Poll struct {
+	Question  string       `json:"question"`
+	Options   []PollOption `json:"options"`
+	Multiple  bool         `json:"multiple"`
+	Anonymous bool         `json:"anonymous"`
+	ClosesAt  string       `json:"closes_at,omitempty"`
+	Closed    bool         `json:"closed"`
+	Voters    int          `json:"voters"`
+}
+
+type PollOption struct {
+	Text   string   `json:"text"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"`
+}
+
+type VoteRequest struct {
+	MessageID string `json:"message"`
+	UserID    string `json:"user"`
+	Options   []int  `json:"options"`
+}
@@ -0,0 +1,35 @@
+package view
+
+type ScheduledMessage struct {
+	ID       string `json:"id"`
+	ChatID   string `json:"chat"`
+	AuthorID string `json:"author"`
+	Text     string `json:"text"`
+	TTL      int64  `json:"ttl"`
+	SendAt   string `json:"send_at"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+type ScheduleMessageRequest struct {
+	ChatID string `json:"chat"`
+	UserID string `json:"author"`
+	Text   string `json:"text"`
+	TTL    int64  `json:"ttl"`
+	SendAt string `json:"send_at"`
+}
+
+type UpdateScheduledMessageRequest struct {
+	ID     string  `json:"id"`
+	UserID string  `json:"user"`
+	Text   *string `json:"text"`
+	TTL    *int64  `json:"ttl"`
+	SendAt *string `json:"send_at"`
+}
+
+type ScheduledMessageRequest struct {
+	ID     string `json:"id"`
+	UserID string `json:"user"`
+}
+
+type ScheduledMessagesResponse []ScheduledMessage
@@ -8,6 +8,55 @@ type UserRequest struct {
 	UserID string `json:"user"`
 }
 
+type UpdateUserRequest struct {
+	UserID      string  `json:"user"`
+	DisplayName *string `json:"display_name"`
+	Avatar      *string `json:"avatar"`
+	Bio         *string `json:"bio"`
+	Status      *string `json:"status"`
+}
+
+type LookupUsersRequest struct {
+	UsersID []string `json:"users"`
+}
+
+type BlockUserRequest struct {
+	UserID    string `json:"user"`
+	BlockedID string `json:"blocked"`
+}
+
+type SearchUsersRequest struct {
+	Query string `json:"query"`
+	Limit int64  `json:"limit"`
+}
+
 type NewUserResponse struct {
 	ID string `json:"id"`
 }
+
+type BlockUserResponse struct {
+	ID      string `json:"id"`
+	Blocked bool   `json:"blocked"`
+}
+
+type DeleteUserResponse struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Stage    string `json:"stage"`
+	Policy   string `json:"policy"`
+	Messages int64  `json:"messages"`
+}
+
+type UserProfile struct {
+	ID          string `json:"id"`
+	UserName    string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Avatar      string `json:"avatar"`
+	Bio         string `json:"bio"`
+	Status      string `json:"status"`
+	IsBot       bool   `json:"is_bot"`
+	Presence    string `json:"presence,omitempty"`
+	LastSeen    string `json:"last_seen,omitempty"`
+}
+
+type UsersResponse []UserProfile
@@ -0,0 +1,104 @@
+package view
+
+// Webhook carries its secret only in the response that creates it.
+type Webhook struct {
+	ID        string   `json:"id"`
+	ChatID    string   `json:"chat"`
+	CreatorID string   `json:"creator"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"created_at"`
+}
+
+type NewWebhookRequest struct {
+	ChatID string   `json:"chat"`
+	UserID string   `json:"user"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type WebhooksRequest struct {
+	ChatID string `json:"chat"`
+	UserID string `json:"user"`
+}
+
+type DeleteWebhookRequest struct {
+	WebhookID string `json:"webhook"`
+	UserID    string `json:"user"`
+}
+
+type WebhookFailure struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhook"`
+	URL       string `json:"url"`
+	Event     string `json:"event"`
+	Payload   string `json:"payload"`
+	Attempts  int    `json:"attempts"`
+	Error     string `json:"error"`
+	FailedAt  string `json:"failed_at"`
+}
+
+// WebhookEvent is the body POSTed to webhooks. Data is a WebhookMessage for
+// message.created, a WebhookChat for chat.created and a WebhookMember for
+// member.joined.
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt string      `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookMessage lists the members to notify about the message, following
+// their notification settings.
+type WebhookMessage struct {
+	Message
+	NotifyIDs []string `json:"notify"`
+}
+
+type WebhookChat struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Public    bool     `json:"public"`
+	CreatorID string   `json:"creator"`
+	UsersID   []string `json:"users"`
+}
+
+type WebhookMember struct {
+	ChatID string `json:"chat"`
+	UserID string `json:"user"`
+	Via    string `json:"via,omitempty"`
+}
+
+type DeleteWebhookResponse struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+}
+
+type IncomingWebhook struct {
+	ID        string `json:"id"`
+	ChatID    string `json:"chat"`
+	CreatorID string `json:"creator"`
+	BotID     string `json:"bot"`
+	Token     string `json:"token"`
+	CreatedAt string `json:"created_at"`
+}
+
+// NewIncomingWebhookRequest names the bot the webhook posts as.
+type NewIncomingWebhookRequest struct {
+	ChatID  string `json:"chat"`
+	UserID  string `json:"user"`
+	BotName string `json:"bot_name"`
+}
+
+// IncomingWebhookMessage is the body external systems POST to
+// /hooks/{token}.
+type IncomingWebhookMessage struct {
+	Text string `json:"text"`
+}
+
+type WebhooksResponse []Webhook
+
+type IncomingWebhooksResponse []IncomingWebhook
+
+type WebhookFailuresResponse []WebhookFailure
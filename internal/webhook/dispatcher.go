@@ -0,0 +1,225 @@
+// Package webhook delivers chat events to webhooks over HTTP.
+//
+// Every delivery is a POST of the JSON event with these headers:
+//
+//	X-Webhook-Event      the event, e.g. message.created
+//	X-Webhook-Delivery   an ID that stays the same across retries
+//	X-Webhook-Timestamp  the Unix time the attempt was signed at
+//	X-Webhook-Signature  sha256= and the hex HMAC-SHA256 of the timestamp,
+//	                     a dot and the body, keyed with the webhook secret
+//
+// Receivers should check the signature with Sign and reject old timestamps.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/netguard"
+)
+
+const (
+	queueSize      = 1000
+	requestTimeout = 10 * time.Second
+	maxBackoff     = 10 * time.Minute
+	maxRedirects   = 3
+)
+
+// FailureStore records the deliveries that ran out of attempts.
+type FailureStore interface {
+	InsertWebhookFailure(failure model.WebhookFailure) error
+}
+
+// Dispatcher delivers events in the background. Failed attempts are retried
+// with exponential backoff and dead-lettered after the last one.
+type Dispatcher struct {
+	client   *http.Client
+	store    FailureStore
+	queue    chan *delivery
+	attempts int
+	backoff  time.Duration
+	now      func() time.Time
+}
+
+type delivery struct {
+	id       string
+	hook     model.Webhook
+	event    string
+	payload  []byte
+	attempts int
+}
+
+// New returns a Dispatcher that makes up to attempts attempts per delivery,
+// waiting backoff before the first retry and doubling it after each one.
+// Webhook URLs are set by users, so only public addresses are posted to.
+func New(store FailureStore, attempts int, backoff time.Duration) *Dispatcher {
+	return newDispatcher(store, attempts, backoff, netguard.IsPublic)
+}
+
+func newDispatcher(store FailureStore, attempts int, backoff time.Duration, allow func(net.IP) bool) *Dispatcher {
+	return &Dispatcher{
+		client: &http.Client{
+			Transport: netguard.Transport(requestTimeout, allow),
+			Timeout:   requestTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return fmt.Errorf("redirect to scheme %q is not allowed", req.URL.Scheme)
+				}
+
+				return nil
+			},
+		},
+		store:    store,
+		queue:    make(chan *delivery, queueSize),
+		attempts: attempts,
+		backoff:  backoff,
+		now:      time.Now,
+	}
+}
+
+// Start runs the delivery workers until stop is closed. Retries that are
+// still waiting then are dropped.
+func (d *Dispatcher) Start(workers int, stop <-chan struct{}) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case next := <-d.queue:
+					d.deliver(next)
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Send queues the event for the webhook and returns right away.
+func (d *Dispatcher) Send(hook model.Webhook, event string, payload []byte) {
+	d.enqueue(&delivery{
+		id:      primitive.NewObjectID().Hex(),
+		hook:    hook,
+		event:   event,
+		payload: payload,
+	})
+}
+
+func (d *Dispatcher) enqueue(next *delivery) {
+	select {
+	case d.queue <- next:
+	default:
+		d.fail(next, "delivery queue is full")
+	}
+}
+
+func (d *Dispatcher) deliver(next *delivery) {
+	next.attempts++
+
+	retry, err := d.post(next)
+	if err == nil {
+		return
+	}
+
+	if !retry || next.attempts >= d.attempts {
+		d.fail(next, err.Error())
+		return
+	}
+
+	time.AfterFunc(d.delay(next.attempts), func() {
+		d.enqueue(next)
+	})
+}
+
+// post makes one attempt and reports whether a failure is worth retrying.
+// Servers that reject the request itself won't accept it later either.
+func (d *Dispatcher) post(next *delivery) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, next.hook.URL, bytes.NewReader(next.payload))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ChatWebhooks/1.0")
+	req.Header.Set("X-Webhook-Event", next.event)
+	req.Header.Set("X-Webhook-Delivery", next.id)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(next.hook.Secret, timestamp, next.payload))
+
+	resp, err := d.client.Do(req)
+	if errors.Is(err, netguard.ErrForbiddenAddress) {
+		return false, netguard.ErrForbiddenAddress
+	}
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("webhook returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+}
+
+func (d *Dispatcher) delay(attempts int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+
+	return delay
+}
+
+func (d *Dispatcher) fail(next *delivery, reason string) {
+	failure := model.WebhookFailure{
+		Webhook:  next.hook.ID,
+		Chat:     next.hook.Chat,
+		URL:      next.hook.URL,
+		Event:    next.event,
+		Payload:  string(next.payload),
+		Attempts: next.attempts,
+		Error:    reason,
+		FailedAt: primitive.NewDateTimeFromTime(d.now()),
+	}
+
+	if err := d.store.InsertWebhookFailure(failure); err != nil {
+		log.Printf("failed to record webhook failure for %s: %s", next.hook.URL, err)
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 signature of a delivery.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flaambe/avito/internal/model"
+	"github.com/flaambe/avito/internal/netguard"
+)
+
+type failureStore struct {
+	failures chan model.WebhookFailure
+}
+
+func (s *failureStore) InsertWebhookFailure(failure model.WebhookFailure) error {
+	s.failures <- failure
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	delivered := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		n := calls[r.URL.Path]
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			body, _ := ioutil.ReadAll(r.Body)
+			timestamp, _ := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+			assert.Equal("sha256="+Sign("secret", timestamp, body), r.Header.Get("X-Webhook-Signature"))
+			assert.Equal(`{"ok":true}`, string(body))
+			delivered <- r
+		case "/down":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer server.Close()
+
+	store := &failureStore{failures: make(chan model.WebhookFailure, 2)}
+	testObj := newDispatcher(store, 3, time.Millisecond, func(net.IP) bool { return true })
+	stop := make(chan struct{})
+	defer close(stop)
+	testObj.Start(2, stop)
+
+	testObj.Send(model.Webhook{URL: server.URL + "/flaky", Secret: "secret"}, model.WebhookMessageCreated, []byte(`{"ok":true}`))
+	select {
+	case r := <-delivered:
+		assert.Equal(model.WebhookMessageCreated, r.Header.Get("X-Webhook-Event"))
+	case <-time.After(time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	// Server errors are retried until the attempts run out, other errors
+	// are dead-lettered right away.
+	testObj.Send(model.Webhook{URL: server.URL + "/down"}, model.WebhookChatCreated, []byte(`{}`))
+	testObj.Send(model.Webhook{URL: server.URL + "/gone"}, model.WebhookChatCreated, []byte(`{}`))
+
+	failures := map[string]model.WebhookFailure{}
+	for i := 0; i < 2; i++ {
+		select {
+		case failure := <-store.failures:
+			failures[failure.URL] = failure
+		case <-time.After(time.Second):
+			t.Fatal("failure was not recorded")
+		}
+	}
+	assert.Equal(3, failures[server.URL+"/down"].Attempts)
+	assert.Equal(1, failures[server.URL+"/gone"].Attempts)
+	assert.Equal(`{}`, failures[server.URL+"/gone"].Payload)
+}
+
+func TestDelay(t *testing.T) {
+	testObj := New(nil, 20, time.Second)
+
+	assert.Equal(t, time.Second, testObj.delay(1))
+	assert.Equal(t, 4*time.Second, testObj.delay(3))
+	assert.Equal(t, maxBackoff, testObj.delay(15))
+}
+
+func TestDispatcherInternalAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("internal address was posted to")
+	}))
+	defer server.Close()
+
+	store := &failureStore{failures: make(chan model.WebhookFailure, 1)}
+	testObj := New(store, 3, time.Millisecond)
+	stop := make(chan struct{})
+	defer close(stop)
+	testObj.Start(1, stop)
+
+	// Internal addresses are dead-lettered without retries.
+	testObj.Send(model.Webhook{URL: server.URL}, model.WebhookChatCreated, []byte(`{}`))
+	select {
+	case failure := <-store.failures:
+		assert.Equal(t, 1, failure.Attempts)
+		assert.Equal(t, netguard.ErrForbiddenAddress.Error(), failure.Error)
+	case <-time.After(time.Second):
+		t.Fatal("failure was not recorded")
+	}
+}